@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+
+	"github.com/spf13/cobra"
+
+	"github.com/authgear/authgear-once-license-server/pkg/keygen"
+	"github.com/authgear/authgear-once-license-server/pkg/slogging"
+	pkgstripe "github.com/authgear/authgear-once-license-server/pkg/stripe"
+)
+
+var backfillLicenseeEmailDryRun bool
+
+var backfillLicenseeEmailCmd = &cobra.Command{
+	Use:   "backfill-licensee-email",
+	Short: "Store the email of the Stripe customer on licenses issued without it",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx := cmd.Context()
+		deps := GetDependencies(ctx)
+
+		getEmail := func(ctx context.Context, customerID string) (string, error) {
+			customer, err := pkgstripe.GetCustomer(ctx, deps.StripeClient, customerID)
+			if err != nil {
+				return "", err
+			}
+			return customer.Email, nil
+		}
+
+		_, err := backfillLicenseeEmail(ctx, deps.KeygenClient, getEmail, backfillLicenseeEmailDryRun)
+		return err
+	},
+}
+
+func init() {
+	backfillLicenseeEmailCmd.Flags().BoolVar(&backfillLicenseeEmailDryRun, "dry-run", false, "Log the licenses to be updated without updating them")
+	rootCmd.AddCommand(backfillLicenseeEmailCmd)
+}
+
+// backfillLicenseeEmail stores the licensee email on every license that has a Stripe customer but no licensee email.
+// A failure of a single license is logged and skipped, so that the command can be re-run to pick it up.
+func backfillLicenseeEmail(
+	ctx context.Context,
+	client *keygen.Client,
+	getEmail func(ctx context.Context, customerID string) (string, error),
+	dryRun bool,
+) (updated int, err error) {
+	logger := slogging.GetLogger(ctx)
+
+	licenses, err := client.ListLicenses(ctx, keygen.ListLicensesOptions{})
+	if err != nil {
+		slogging.Error(ctx, logger, "failed to list licenses",
+			"error", err)
+		return
+	}
+
+	for _, license := range licenses {
+		if license.Metadata.StripeCustomerID == "" || license.Metadata.LicenseeEmail != "" {
+			continue
+		}
+
+		logger := logger.With(
+			"keygen_license_id", license.ID,
+			"stripe_customer_id", license.Metadata.StripeCustomerID,
+		)
+
+		email, getErr := getEmail(ctx, license.Metadata.StripeCustomerID)
+		if getErr != nil {
+			slogging.Error(ctx, logger, "failed to get customer email",
+				"error", getErr)
+			continue
+		}
+		if email == "" {
+			slogging.Warn(ctx, logger, "customer has no email")
+			continue
+		}
+
+		if dryRun {
+			slogging.Info(ctx, logger, "would backfill licensee email")
+			updated++
+			continue
+		}
+
+		// Only the licensee email is set, the rest of the metadata is kept as is.
+		_, updateErr := client.UpdateLicenseMetadata(ctx, keygen.UpdateLicenseMetadataOptions{
+			LicenseID: license.ID,
+			Metadata: keygen.LicenseMetadata{
+				LicenseeEmail: email,
+			},
+		})
+		if updateErr != nil {
+			slogging.Error(ctx, logger, "failed to backfill licensee email",
+				"error", updateErr)
+			continue
+		}
+		slogging.Info(ctx, logger, "backfilled licensee email")
+		updated++
+	}
+
+	slogging.Info(ctx, logger, "backfill licensee email completed",
+		"updated", updated,
+		"dry_run", dryRun)
+	return
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/authgear/authgear-once-license-server/pkg/keygen"
+	"github.com/authgear/authgear-once-license-server/pkg/keygen/keygentest"
+)
+
+func TestBackfillLicenseeEmail(t *testing.T) {
+	emails := map[string]string{
+		"cus_1": "user1@example.com",
+		"cus_3": "user3@example.com",
+	}
+	getEmail := func(ctx context.Context, customerID string) (string, error) {
+		email, ok := emails[customerID]
+		if !ok {
+			return "", errors.New("no such customer")
+		}
+		return email, nil
+	}
+
+	tests := []struct {
+		name            string
+		dryRun          bool
+		expectedUpdated int
+		expectedEmails  map[string]string
+	}{
+		{
+			name:            "dry run",
+			dryRun:          true,
+			expectedUpdated: 2,
+			expectedEmails: map[string]string{
+				"KEY-1": "",
+				"KEY-2": "",
+				"KEY-3": "",
+				"KEY-4": "existing@example.com",
+				"KEY-5": "",
+			},
+		},
+		{
+			name:            "backfill",
+			expectedUpdated: 2,
+			expectedEmails: map[string]string{
+				"KEY-1": "user1@example.com",
+				"KEY-2": "",
+				"KEY-3": "user3@example.com",
+				"KEY-4": "existing@example.com",
+				"KEY-5": "",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := keygentest.NewServer()
+			defer server.Close()
+			server.AddLicense(keygentest.License{Key: "KEY-1", Metadata: keygen.LicenseMetadata{StripeCustomerID: "cus_1"}})
+			// The customer cannot be retrieved.
+			server.AddLicense(keygentest.License{Key: "KEY-2", Metadata: keygen.LicenseMetadata{StripeCustomerID: "cus_2"}})
+			server.AddLicense(keygentest.License{
+				Key:      "KEY-3",
+				Metadata: keygen.LicenseMetadata{StripeCustomerID: "cus_3", StripeCheckoutSessionID: "cs_3"},
+				// Metadata added by hand.
+				ExtraMetadata: map[string]any{"note": "enterprise customer"},
+			})
+			server.AddLicense(keygentest.License{Key: "KEY-4", Metadata: keygen.LicenseMetadata{StripeCustomerID: "cus_4", LicenseeEmail: "existing@example.com"}})
+			// The license was not issued through Stripe.
+			server.AddLicense(keygentest.License{Key: "KEY-5"})
+
+			client := keygen.NewClient(server.Client(), server.Config())
+			updated, err := backfillLicenseeEmail(context.Background(), client, getEmail, tt.dryRun)
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if updated != tt.expectedUpdated {
+				t.Errorf("expected %v updated, got %v", tt.expectedUpdated, updated)
+			}
+
+			for key, expected := range tt.expectedEmails {
+				l, _ := server.GetLicense(key)
+				if l.Metadata.LicenseeEmail != expected {
+					t.Errorf("%v: expected licensee email %q, got %q", key, expected, l.Metadata.LicenseeEmail)
+				}
+			}
+
+			// Other metadata is preserved.
+			l, _ := server.GetLicense("KEY-3")
+			if l.Metadata.StripeCheckoutSessionID != "cs_3" || l.ExtraMetadata["note"] != "enterprise customer" {
+				t.Errorf("expected metadata to be preserved, got %+v, %+v", l.Metadata, l.ExtraMetadata)
+			}
+		})
+	}
+}
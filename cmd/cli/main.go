@@ -2,9 +2,11 @@ package main
 
 import (
 	"context"
+	"crypto/ed25519"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"html/template"
 	"log/slog"
 	"net"
 	"net/http"
@@ -12,6 +14,7 @@ import (
 	"os"
 	"strconv"
 	"time"
+	"unicode"
 
 	"github.com/getsentry/sentry-go"
 	sentryslog "github.com/getsentry/sentry-go/slog"
@@ -19,15 +22,20 @@ import (
 	slogmulti "github.com/samber/slog-multi"
 	"github.com/spf13/cobra"
 	"github.com/stripe/stripe-go/v82/client"
-	"gopkg.in/gomail.v2"
 
+	"github.com/authgear/authgear-once-license-server/pkg/catalog"
 	"github.com/authgear/authgear-once-license-server/pkg/emailtemplate"
+	"github.com/authgear/authgear-once-license-server/pkg/expiryreminder"
 	"github.com/authgear/authgear-once-license-server/pkg/httpmiddleware"
 	"github.com/authgear/authgear-once-license-server/pkg/installationscript"
+	"github.com/authgear/authgear-once-license-server/pkg/jobqueue"
 	"github.com/authgear/authgear-once-license-server/pkg/keygen"
+	"github.com/authgear/authgear-once-license-server/pkg/licensecache"
+	"github.com/authgear/authgear-once-license-server/pkg/licensefile"
+	"github.com/authgear/authgear-once-license-server/pkg/mailer"
 	"github.com/authgear/authgear-once-license-server/pkg/slogging"
-	"github.com/authgear/authgear-once-license-server/pkg/smtp"
 	pkgstripe "github.com/authgear/authgear-once-license-server/pkg/stripe"
+	"github.com/authgear/authgear-once-license-server/pkg/webhookevent"
 )
 
 const indexHTML = `<!DOCTYPE html>
@@ -43,6 +51,24 @@ const indexHTML = `<!DOCTYPE html>
 </html>
 `
 
+// renewHTML is the page of the renewal link in the expiry reminder email.
+// Opening the link only shows the page, so that a link scanner or a prefetch does not create a checkout session.
+// The checkout session is created when the form is submitted.
+var renewHTML = template.Must(template.New("renew").Parse(`<!DOCTYPE html>
+<html>
+<head>
+	<meta name="viewport" content="width=device-width, initial-scale=1" />
+</head>
+<body>
+	<p>Renew the license {{ .LicenseKey }}.</p>
+	<form action="/v1/stripe/checkout/renew" method="POST">
+		<input type="hidden" name="license_key" value="{{ .LicenseKey }}" />
+		<button type="submit">Checkout</button>
+	</form>
+</body>
+</html>
+`))
+
 var jsonResponseBadRequest = map[string]any{
 	"error": map[string]any{
 		"code": "bad_request",
@@ -67,14 +93,89 @@ var jsonResponseLicenseKeyAlreadyActivated = map[string]any{
 	},
 }
 
+var jsonResponseLicenseKeyNotActivated = map[string]any{
+	"error": map[string]any{
+		"code": "license_key_not_activated",
+	},
+}
+
+var jsonResponseMachineNotFound = map[string]any{
+	"error": map[string]any{
+		"code": "machine_not_found",
+	},
+}
+
+var jsonResponseLicenseSuspended = map[string]any{
+	"error": map[string]any{
+		"code": "license_suspended",
+	},
+}
+
+var jsonResponseLicenseBanned = map[string]any{
+	"error": map[string]any{
+		"code": "license_banned",
+	},
+}
+
+var jsonResponseLicenseOverdue = map[string]any{
+	"error": map[string]any{
+		"code": "license_overdue",
+	},
+}
+
+var jsonResponseLicenseTooManyMachines = map[string]any{
+	"error": map[string]any{
+		"code": "license_too_many_machines",
+	},
+}
+
+var jsonResponseLicenseScopeMismatch = map[string]any{
+	"error": map[string]any{
+		"code": "license_scope_mismatch",
+	},
+}
+
+var jsonResponseLicenseInvalid = map[string]any{
+	"error": map[string]any{
+		"code": "license_invalid",
+	},
+}
+
+var jsonResponseServiceUnavailable = map[string]any{
+	"error": map[string]any{
+		"code": "service_unavailable",
+	},
+}
+
 func NewLicenseResponse(l *keygen.LicenseID) map[string]any {
 	return map[string]any{
 		"data": l,
 	}
 }
 
+func NewLicenseFileResponse(f *licensefile.LicenseFile) map[string]any {
+	return map[string]any{
+		"data": f,
+	}
+}
+
+// annotationNoDependencies marks a command that does not need Dependencies,
+// so that it runs without the configuration of the server.
+const annotationNoDependencies = "no-dependencies"
+
 var rootCmd = &cobra.Command{
 	Use: "authgear-once-license-server",
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		if cmd.Annotations[annotationNoDependencies] == "true" {
+			return nil
+		}
+		dependencies, err := newDependencies()
+		if err != nil {
+			return err
+		}
+		cmd.SetContext(context.WithValue(cmd.Context(), dependenciesKey, dependencies))
+		return nil
+	},
 }
 
 var serveCmd = &cobra.Command{
@@ -87,13 +188,17 @@ var serveCmd = &cobra.Command{
 
 		mux.HandleFunc("GET /{$}", Handler_root)
 		mux.HandleFunc("GET /install/{license_key}", Handler_install)
-		mux.HandleFunc("/v1/license/activate", MakeHandler_v1_license(keygen.ActivateLicense))
-		mux.HandleFunc("/v1/license/check", MakeHandler_v1_license(keygen.CheckLicense))
+		mux.HandleFunc("/v1/license/activate", Handler_v1_license_activate)
+		mux.HandleFunc("/v1/license/check", MakeHandler_v1_license(keygen.LicenseBackend.CheckLicense))
+		mux.HandleFunc("/v1/license/deactivate", MakeHandler_v1_license(keygen.LicenseBackend.DeactivateLicense))
+		mux.HandleFunc("/v1/license/file", Handler_v1_license_file)
 		mux.HandleFunc("/v1/stripe/checkout", Handler_v1_stripe_checkout)
+		mux.HandleFunc("/v1/stripe/checkout/renew", Handler_v1_stripe_checkout_renew)
 		mux.HandleFunc("/v1/stripe/webhook", Handler_v1_stripe_webhook)
 
 		ctx := cmd.Context()
 		logger := slogging.GetLogger(ctx)
+
 		server := &http.Server{
 			Addr:    ":8200",
 			Handler: maxbytes(cors(mux)),
@@ -102,7 +207,26 @@ var serveCmd = &cobra.Command{
 			},
 		}
 
+		// The server stops if the worker fails, for example, when another worker is running.
+		workerErr := make(chan error, 1)
+		if worker := GetDependencies(ctx).WebhookWorker; worker != nil && serveWorker {
+			go func() {
+				err := worker.Run(ctx)
+				if err != nil {
+					slogging.Error(ctx, logger, "failed to run worker",
+						"error", err)
+					workerErr <- err
+					_ = server.Close()
+				}
+			}()
+		}
+
 		err := server.ListenAndServe()
+		select {
+		case err := <-workerErr:
+			return err
+		default:
+		}
 		if err != nil {
 			slogging.Error(ctx, logger, "failed to start server",
 				"error", err)
@@ -112,7 +236,10 @@ var serveCmd = &cobra.Command{
 	},
 }
 
+var serveWorker bool
+
 func init() {
+	serveCmd.Flags().BoolVar(&serveWorker, "worker", true, "Handle the enqueued Stripe webhook events in this process")
 	rootCmd.AddCommand(serveCmd)
 }
 
@@ -121,19 +248,32 @@ type dependenciesKeyType struct{}
 var dependenciesKey = dependenciesKeyType{}
 
 type Dependencies struct {
-	HTTPClient                                          *http.Client
 	StripeClient                                        *client.API
-	SMTPDialer                                          *gomail.Dialer
-	SMTPSender                                          string
+	Mailer                                              mailer.Mailer
+	MailSender                                          string
 	StripeCheckoutSessionSuccessURL                     string
 	StripeCheckoutSessionCancelURL                      string
-	StripeCheckoutSessionPriceID                        string
+	Catalog                                             *catalog.Catalog
 	StripeWebhookSigningSecret                          string
 	StripeCheckoutSessionMetadataMarkerValue            string
 	AUTHGEAR_ONCE_PUBLIC_URL_SCHEME                     string
 	AUTHGEAR_ONCE_ONCE_COMMAND_DOWNLOAD_URL_GO_TEMPLATE string
 	AUTHGEAR_ONCE_ONCE_COMMAND_IMAGE_OVERRIDE           string
-	KeygenConfig                                        keygen.KeygenConfig
+	LicenseBackend                                      keygen.LicenseBackend
+	KeygenClient                                        *keygen.Client
+	LicenseFileSigningKey                               ed25519.PrivateKey
+	// LicenseFileValidity is how long a license file is valid. 0 means licensefile.DefaultValidity.
+	LicenseFileValidity time.Duration
+	// WebhookQueue and WebhookWorker are optional.
+	// When they are nil, webhook events are handled in the webhook request.
+	WebhookQueue  *jobqueue.DirQueue
+	WebhookWorker *jobqueue.Worker
+	// WebhookEventStore is optional.
+	// When it is nil, webhook events are not recorded nor deduplicated.
+	WebhookEventStore webhookevent.Store
+	// ExpiryReminderStore is optional.
+	// It is required by the remind-expiry command only.
+	ExpiryReminderStore expiryreminder.Store
 }
 
 func ConstructFullURL(r *http.Request) *url.URL {
@@ -226,61 +366,221 @@ func Handler_install(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func MakeHandler_v1_license(f func(ctx context.Context, httpClient *http.Client, opts keygen.LicenseOptions) (*keygen.LicenseID, error)) http.HandlerFunc {
+func MakeHandler_v1_license(f func(backend keygen.LicenseBackend, ctx context.Context, opts keygen.LicenseOptions) (*keygen.LicenseID, error)) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		defer r.Body.Close()
 
-		ctx := r.Context()
-		logger := slogging.GetLogger(ctx)
-		deps := GetDependencies(ctx)
-
-		err := r.ParseForm()
-		if err != nil {
-			WriteJSON(w, jsonResponseBadRequest, http.StatusBadRequest)
+		_, licenseID, ok := handleLicense(w, r, f, false)
+		if !ok {
 			return
 		}
 
-		licenseKey := r.FormValue("license_key")
-		fingerprint := r.FormValue("fingerprint")
-		if licenseKey == "" || fingerprint == "" {
+		WriteJSON(w, NewLicenseResponse(licenseID), http.StatusOK)
+	}
+}
+
+// Handler_v1_license_activate activates the license, and records the machine details, if any.
+func Handler_v1_license_activate(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	_, licenseID, ok := handleLicense(w, r, keygen.LicenseBackend.ActivateLicense, true)
+	if !ok {
+		return
+	}
+
+	WriteJSON(w, NewLicenseResponse(licenseID), http.StatusOK)
+}
+
+// handleLicense parses the form, calls f, and resolves the licensee email.
+// The machine details are parsed only if withMachine is true,
+// so that an invalid one does not fail the requests that do not record it.
+// When ok is false, the error response has been written.
+func handleLicense(w http.ResponseWriter, r *http.Request, f func(backend keygen.LicenseBackend, ctx context.Context, opts keygen.LicenseOptions) (*keygen.LicenseID, error), withMachine bool) (opts keygen.LicenseOptions, licenseID *keygen.LicenseID, ok bool) {
+	ctx := r.Context()
+	logger := slogging.GetLogger(ctx)
+	deps := GetDependencies(ctx)
+
+	err := r.ParseForm()
+	if err != nil {
+		WriteJSON(w, jsonResponseBadRequest, http.StatusBadRequest)
+		return
+	}
+
+	licenseKey := r.FormValue("license_key")
+	fingerprint := r.FormValue("fingerprint")
+	if licenseKey == "" || fingerprint == "" {
+		WriteJSON(w, jsonResponseBadRequest, http.StatusBadRequest)
+		return
+	}
+
+	opts = keygen.LicenseOptions{
+		LicenseKey:  licenseKey,
+		Fingerprint: fingerprint,
+	}
+	if withMachine {
+		machine, valid := parseMachineDetails(r.Form)
+		if !valid {
 			WriteJSON(w, jsonResponseBadRequest, http.StatusBadRequest)
 			return
 		}
+		opts.Machine = machine
+	}
 
-		licenseID, err := f(ctx, deps.HTTPClient, keygen.LicenseOptions{
-			KeygenConfig: deps.KeygenConfig,
-			LicenseKey:   licenseKey,
-			Fingerprint:  fingerprint,
-		})
+	licenseID, err = f(deps.LicenseBackend, ctx, opts)
+	if err != nil {
+		switch {
+		case errors.Is(err, keygen.ErrServiceUnavailable):
+			slogging.Error(ctx, logger, "keygen is unavailable",
+				"error", err)
+			WriteJSON(w, jsonResponseServiceUnavailable, http.StatusServiceUnavailable)
+			return
+		case errors.Is(err, keygen.ErrLicenseKeyNotFound):
+			WriteJSON(w, jsonResponseLicenseKeyNotFound, http.StatusNotFound)
+			return
+		case errors.Is(err, keygen.ErrMachineNotFound):
+			WriteJSON(w, jsonResponseMachineNotFound, http.StatusNotFound)
+			return
+		case errors.Is(err, keygen.ErrLicenseKeyAlreadyActivated):
+			WriteJSON(w, jsonResponseLicenseKeyAlreadyActivated, http.StatusForbidden)
+			return
+		case errors.Is(err, keygen.ErrLicenseKeyNotActivated):
+			WriteJSON(w, jsonResponseLicenseKeyNotActivated, http.StatusForbidden)
+			return
+		case errors.Is(err, keygen.ErrLicenseSuspended):
+			WriteJSON(w, jsonResponseLicenseSuspended, http.StatusForbidden)
+			return
+		case errors.Is(err, keygen.ErrLicenseBanned):
+			WriteJSON(w, jsonResponseLicenseBanned, http.StatusForbidden)
+			return
+		case errors.Is(err, keygen.ErrLicenseOverdue):
+			WriteJSON(w, jsonResponseLicenseOverdue, http.StatusForbidden)
+			return
+		case errors.Is(err, keygen.ErrLicenseTooManyMachines):
+			WriteJSON(w, jsonResponseLicenseTooManyMachines, http.StatusForbidden)
+			return
+		case errors.Is(err, keygen.ErrLicenseScopeMismatch):
+			WriteJSON(w, jsonResponseLicenseScopeMismatch, http.StatusForbidden)
+			return
+		case errors.Is(err, keygen.ErrLicenseInvalid):
+			WriteJSON(w, jsonResponseLicenseInvalid, http.StatusForbidden)
+			return
+		default:
+			slogging.Error(ctx, logger, "unexpected error",
+				"error", err)
+			WriteJSON(w, jsonResponseInternalServerError, http.StatusInternalServerError)
+			return
+		}
+	}
+	// The licensee email is stored on the license at issuance.
+	// Licenses issued before that are not backfilled yet, so we fall back to Stripe.
+	// The email is informational, so a failure of Stripe does not fail the request.
+	if licenseID.LicenseeEmail == nil && licenseID.StripeCustomerID != "" {
+		customer, err := pkgstripe.GetCustomer(ctx, deps.StripeClient, licenseID.StripeCustomerID)
 		if err != nil {
-			switch {
-			case errors.Is(err, keygen.ErrLicenseKeyNotFound):
-				WriteJSON(w, jsonResponseLicenseKeyNotFound, http.StatusNotFound)
-				return
-			case errors.Is(err, keygen.ErrLicenseKeyAlreadyActivated):
-				WriteJSON(w, jsonResponseLicenseKeyAlreadyActivated, http.StatusForbidden)
-				return
-			default:
-				slogging.Error(ctx, logger, "unexpected error",
-					"error", err)
-				WriteJSON(w, jsonResponseInternalServerError, http.StatusInternalServerError)
-				return
-			}
+			slogging.Error(ctx, logger, "failed to get licensee email from stripe",
+				"stripe_customer_id", licenseID.StripeCustomerID,
+				"error", err)
+		} else {
+			licenseID.LicenseeEmail = &customer.Email
+		}
+	}
+
+	ok = true
+	return
+}
+
+// parseMachineDetails parses the optional machine details sent by the authgear-once command.
+// It returns nil if none of them is present.
+func parseMachineDetails(form url.Values) (machine *keygen.MachineDetails, ok bool) {
+	hostname := form.Get("hostname")
+	platform := form.Get("platform")
+	cores := form.Get("cores")
+	onceVersion := form.Get("once_version")
+
+	if hostname == "" && platform == "" && cores == "" && onceVersion == "" {
+		ok = true
+		return
+	}
+
+	isValidString := func(s string, maxLength int) bool {
+		if len(s) > maxLength {
+			return false
 		}
-		if licenseID.StripeCustomerID != "" {
-			customer, err := pkgstripe.GetCustomer(ctx, deps.StripeClient, licenseID.StripeCustomerID)
-			if err != nil {
-				slogging.Error(ctx, logger, "unexpected error",
-					"error", err)
-				WriteJSON(w, jsonResponseInternalServerError, http.StatusInternalServerError)
-				return
+		for _, r := range s {
+			if !unicode.IsPrint(r) {
+				return false
 			}
+		}
+		return true
+	}
 
-			licenseID.LicenseeEmail = &customer.Email
+	// The maximum length of a hostname is 253.
+	if !isValidString(hostname, 253) || !isValidString(platform, 64) || !isValidString(onceVersion, 64) {
+		return
+	}
+
+	machine = &keygen.MachineDetails{
+		Hostname:    hostname,
+		Platform:    platform,
+		OnceVersion: onceVersion,
+	}
+	if cores != "" {
+		n, err := strconv.Atoi(cores)
+		if err != nil || n <= 0 || n > 4096 {
+			machine = nil
+			return
 		}
+		machine.Cores = n
+	}
 
-		WriteJSON(w, NewLicenseResponse(licenseID), http.StatusOK)
+	ok = true
+	return
+}
+
+// Handler_v1_license_file activates the license, and returns a signed license file.
+// The authgear-once command verifies the license file locally until expire_at or valid_until, whichever is earlier,
+// so that it works in a network that cannot reach this server after setup.
+func Handler_v1_license_file(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	ctx := r.Context()
+	logger := slogging.GetLogger(ctx)
+	deps := GetDependencies(ctx)
+
+	opts, licenseID, ok := handleLicense(w, r, keygen.LicenseBackend.ActivateLicense, true)
+	if !ok {
+		return
+	}
+
+	if deps.LicenseFileSigningKey == nil {
+		slogging.Error(ctx, logger, "AUTHGEAR_ONCE_LICENSE_FILE_SIGNING_KEY is not set")
+		WriteJSON(w, jsonResponseInternalServerError, http.StatusInternalServerError)
+		return
+	}
+
+	validity := deps.LicenseFileValidity
+	if validity == 0 {
+		validity = licensefile.DefaultValidity
 	}
+	issuedAt := time.Now().UTC()
+	f, err := licensefile.Sign(deps.LicenseFileSigningKey, licensefile.Payload{
+		LicenseKey:    opts.LicenseKey,
+		Fingerprint:   opts.Fingerprint,
+		ExpireAt:      licenseID.ExpireAt,
+		IsActivated:   licenseID.IsActivated,
+		IsExpired:     licenseID.IsExpired,
+		LicenseeEmail: licenseID.LicenseeEmail,
+		IssuedAt:      issuedAt,
+		ValidUntil:    issuedAt.Add(validity),
+	})
+	if err != nil {
+		slogging.Error(ctx, logger, "failed to sign license file",
+			"error", err)
+		WriteJSON(w, jsonResponseInternalServerError, http.StatusInternalServerError)
+		return
+	}
+
+	WriteJSON(w, NewLicenseFileResponse(f), http.StatusOK)
 }
 
 func Handler_v1_stripe_checkout(w http.ResponseWriter, r *http.Request) {
@@ -291,11 +591,103 @@ func Handler_v1_stripe_checkout(w http.ResponseWriter, r *http.Request) {
 	deps := GetDependencies(ctx)
 	stripeClient := deps.StripeClient
 
+	err := r.ParseForm()
+	if err != nil {
+		http.Error(w, "failed to parse form", http.StatusBadRequest)
+		return
+	}
+
+	plan := deps.Catalog.DefaultPlan()
+	if planID := r.FormValue("plan"); planID != "" {
+		var ok bool
+		plan, ok = deps.Catalog.GetPlanByID(planID)
+		if !ok {
+			http.Error(w, "unknown plan", http.StatusBadRequest)
+			return
+		}
+	}
+
 	checkoutSession, err := pkgstripe.NewCheckoutSession(ctx, stripeClient, &pkgstripe.CheckoutSessionParams{
 		MarkerValue: deps.StripeCheckoutSessionMetadataMarkerValue,
 		SuccessURL:  deps.StripeCheckoutSessionSuccessURL,
 		CancelURL:   deps.StripeCheckoutSessionCancelURL,
-		PriceID:     deps.StripeCheckoutSessionPriceID,
+		PriceID:     plan.StripePriceID,
+	})
+	if err != nil {
+		slogging.Error(ctx, logger, "failed to create checkout session",
+			"error", err)
+		http.Error(w, "failed to create checkout session", http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, checkoutSession.URL, http.StatusSeeOther)
+}
+
+// Handler_v1_stripe_checkout_renew creates a checkout session that renews the license of license_key.
+func Handler_v1_stripe_checkout_renew(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	ctx := r.Context()
+	logger := slogging.GetLogger(ctx)
+	deps := GetDependencies(ctx)
+	stripeClient := deps.StripeClient
+
+	err := r.ParseForm()
+	if err != nil {
+		http.Error(w, "failed to parse form", http.StatusBadRequest)
+		return
+	}
+
+	licenseKey := r.FormValue("license_key")
+	if licenseKey == "" {
+		http.Error(w, "license_key is required", http.StatusBadRequest)
+		return
+	}
+
+	license, err := deps.LicenseBackend.GetLicense(ctx, keygen.GetLicenseOptions{
+		LicenseIDOrKey: licenseKey,
+	})
+	if err != nil {
+		if errors.Is(err, keygen.ErrLicenseKeyNotFound) {
+			http.Error(w, "license key not found", http.StatusNotFound)
+			return
+		}
+		slogging.Error(ctx, logger, "failed to get license",
+			"error", err)
+		http.Error(w, "failed to get license", http.StatusInternalServerError)
+		return
+	}
+
+	// Keygen renews the license by the duration of its policy,
+	// so the price must be the renewal price of the plan of the policy.
+	plan, ok := deps.Catalog.GetPlanByKeygenPolicyID(license.PolicyID)
+	if !ok {
+		slogging.Error(ctx, logger, "policy of license is not in the catalog",
+			"keygen_policy_id", license.PolicyID)
+		http.Error(w, "policy of license is not in the catalog", http.StatusInternalServerError)
+		return
+	}
+	priceID := plan.RenewalStripePriceID()
+
+	if r.Method != http.MethodPost {
+		w.Header().Set("Content-Type", "text/html")
+		w.Header().Set("Cache-Control", "no-store")
+		err = renewHTML.Execute(w, struct{ LicenseKey string }{
+			LicenseKey: licenseKey,
+		})
+		if err != nil {
+			slogging.Error(ctx, logger, "failed to render renewal page",
+				"error", err)
+		}
+		return
+	}
+
+	checkoutSession, err := pkgstripe.NewCheckoutSession(ctx, stripeClient, &pkgstripe.CheckoutSessionParams{
+		MarkerValue:    deps.StripeCheckoutSessionMetadataMarkerValue,
+		SuccessURL:     deps.StripeCheckoutSessionSuccessURL,
+		CancelURL:      deps.StripeCheckoutSessionCancelURL,
+		PriceID:        priceID,
+		RenewLicenseID: license.ID,
 	})
 	if err != nil {
 		slogging.Error(ctx, logger, "failed to create checkout session",
@@ -315,6 +707,12 @@ func Handler_v1_stripe_webhook(w http.ResponseWriter, r *http.Request) {
 	logger := slogging.GetLogger(ctx)
 	deps := GetDependencies(ctx)
 
+	// When the queue is configured, the event is handled by the worker.
+	if deps.WebhookQueue != nil {
+		enqueueWebhookEvent(w, r)
+		return
+	}
+
 	e, err := pkgstripe.ConstructEvent(ctx, deps.StripeClient, r, pkgstripe.ConstructEventOptions{
 		SigningSecret: deps.StripeWebhookSigningSecret,
 		MarkerValue:   deps.StripeCheckoutSessionMetadataMarkerValue,
@@ -335,13 +733,55 @@ func Handler_v1_stripe_webhook(w http.ResponseWriter, r *http.Request) {
 		}
 		return
 	}
-	logger = logger.With("stripe_event_id", e.ID)
+
+	serveWebhookEvent(w, r, e)
+}
+
+// serveWebhookEvent handles a resolved event, either in the webhook request or in the worker.
+func serveWebhookEvent(w http.ResponseWriter, r *http.Request, e *pkgstripe.Event) {
+	ctx := r.Context()
+	logger := slogging.GetLogger(ctx)
+
+	logger = logger.With("stripe_event_id", e.ID, "stripe_event_type", e.Type)
 	slogging.Info(ctx, logger, "handling event")
 
-	checkoutSessionID := pkgstripe.GetEventDataID(e)
+	checkoutSessionID := e.CheckoutSession.ID
 	logger = logger.With("stripe_checkout_session_id", checkoutSessionID)
+	ctx = slogging.WithLogger(ctx, logger)
+	r = r.WithContext(ctx)
+
+	processWebhookEvent(w, r, e)
+}
 
-	customerID, ok := pkgstripe.GetCustomerID(e)
+// handleWebhookEvent performs the license action of the event.
+func handleWebhookEvent(w http.ResponseWriter, r *http.Request, e *pkgstripe.Event) {
+	ctx := r.Context()
+	logger := slogging.GetLogger(ctx)
+
+	switch action := pkgstripe.GetLicenseAction(e); action {
+	case pkgstripe.LicenseActionIssue:
+		handleLicenseIssuance(w, r, e)
+	case pkgstripe.LicenseActionRenew:
+		handleLicenseRenewal(w, r, e)
+	case pkgstripe.LicenseActionSuspend, pkgstripe.LicenseActionReinstate:
+		handleLicenseSuspension(w, r, e, action)
+	case pkgstripe.LicenseActionNotifyPaymentFailed:
+		handlePaymentFailure(w, r, e)
+	default:
+		// Ignore the event by returning 200
+		slogging.Info(ctx, logger, "ignore event without license action")
+		setWebhookEventOutcome(w, webhookevent.OutcomeIgnored)
+	}
+}
+
+func handleLicenseIssuance(w http.ResponseWriter, r *http.Request, e *pkgstripe.Event) {
+	ctx := r.Context()
+	logger := slogging.GetLogger(ctx)
+	deps := GetDependencies(ctx)
+
+	checkoutSessionID := e.CheckoutSession.ID
+
+	customerID, ok := pkgstripe.GetCustomerID(e.Event)
 	if !ok {
 		slogging.Error(ctx, logger, "customer id not found")
 		http.Error(w, "customer id not found", http.StatusInternalServerError)
@@ -349,40 +789,80 @@ func Handler_v1_stripe_webhook(w http.ResponseWriter, r *http.Request) {
 	}
 	logger = logger.With("stripe_customer_id", customerID)
 
-	email, ok := pkgstripe.GetCustomerEmail(e)
+	email, ok := pkgstripe.GetCustomerEmail(e.Event)
 	if !ok {
 		slogging.Error(ctx, logger, "customer email not found")
 		http.Error(w, "customer email not found", http.StatusInternalServerError)
 		return
 	}
 
-	licenseKey, err := keygen.CreateLicenseKey(ctx, deps.HTTPClient, keygen.CreateLicenseKeyOptions{
-		KeygenConfig:            deps.KeygenConfig,
+	priceID, ok := pkgstripe.GetPriceID(e)
+	if !ok {
+		slogging.Error(ctx, logger, "price id not found")
+		http.Error(w, "price id not found", http.StatusInternalServerError)
+		return
+	}
+	logger = logger.With("stripe_price_id", priceID)
+
+	plan, ok := deps.Catalog.GetPlanByStripePriceID(priceID)
+	if !ok {
+		slogging.Error(ctx, logger, "price is not in the catalog")
+		http.Error(w, "price is not in the catalog", http.StatusInternalServerError)
+		return
+	}
+	logger = logger.With("plan_id", plan.ID)
+
+	// Stripe retries the webhook when we fail to send the email.
+	// So we reuse the license key created for the checkout session, if any.
+	var licenseKey string
+	license, err := deps.LicenseBackend.GetLicenseByStripeCheckoutSessionID(ctx, keygen.GetLicenseByStripeCheckoutSessionIDOptions{
 		StripeCheckoutSessionID: checkoutSessionID,
-		StripeCustomerID:        customerID,
 	})
-	if err != nil {
-		slogging.Error(ctx, logger, "failed to create license key",
+	switch {
+	case err == nil:
+		slogging.Info(ctx, logger, "reuse license key created for checkout session")
+		licenseKey = license.Key
+		setWebhookEventLicenseID(w, license.ID)
+	case errors.Is(err, keygen.ErrLicenseKeyNotFound):
+		licenseKey, err = deps.LicenseBackend.CreateLicenseKey(ctx, keygen.CreateLicenseKeyOptions{
+			PolicyID:                plan.KeygenPolicyID,
+			StripeCheckoutSessionID: checkoutSessionID,
+			StripeCustomerID:        customerID,
+			LicenseeEmail:           email,
+		})
+		if err != nil {
+			slogging.Error(ctx, logger, "failed to create license key",
+				"error", err)
+			http.Error(w, "failed to create license key", http.StatusInternalServerError)
+			return
+		}
+	default:
+		slogging.Error(ctx, logger, "failed to search license key",
 			"error", err)
-		http.Error(w, "failed to create license key", http.StatusInternalServerError)
+		http.Error(w, "failed to search license key", http.StatusInternalServerError)
 		return
 	}
 
 	u := ConstructFullURL(r)
 	u.Path = fmt.Sprintf("/install/%v", licenseKey)
 
-	htmlBody := emailtemplate.RenderInstallationEmail(emailtemplate.InstallationEmailData{
+	locale := emailtemplate.ResolveLocale(pkgstripe.GetCustomerLocale(e))
+	logger = logger.With("locale", locale)
+	emailData := emailtemplate.InstallationEmailData{
 		InstallationOneliner: fmt.Sprintf(`/bin/sh -c "$(curl -fsSL %v)"`, u.String()),
-	})
+		PlanName:             plan.Name,
+		Locale:               locale,
+	}
 
-	opts := smtp.EmailOptions{
-		Sender:   deps.SMTPSender,
-		Subject:  "Installing Authgear ONCE",
-		HTMLBody: htmlBody,
+	opts := mailer.EmailOptions{
+		Sender:   deps.MailSender,
+		Subject:  emailtemplate.InstallationEmailSubject(locale),
+		HTMLBody: emailtemplate.RenderInstallationEmail(emailData),
+		TextBody: emailtemplate.RenderInstallationEmailText(emailData),
 		To:       email,
 	}
 
-	err = smtp.SendEmail(deps.SMTPDialer, opts)
+	err = deps.Mailer.SendEmail(ctx, opts)
 	if err != nil {
 		slogging.Error(ctx, logger, "failed to send email",
 			"error", err)
@@ -393,56 +873,435 @@ func Handler_v1_stripe_webhook(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func main() {
-	err := godotenv.Load()
-	if err != nil && !errors.Is(err, os.ErrNotExist) {
-		panic(err)
+// handleLicenseRenewal extends the expiry of the license the checkout session was created for,
+// and sends a confirmation email.
+func handleLicenseRenewal(w http.ResponseWriter, r *http.Request, e *pkgstripe.Event) {
+	ctx := r.Context()
+	logger := slogging.GetLogger(ctx)
+	deps := GetDependencies(ctx)
+
+	checkoutSessionID := e.CheckoutSession.ID
+
+	licenseID, _ := pkgstripe.GetRenewLicenseID(e)
+	logger = logger.With("keygen_license_id", licenseID)
+	setWebhookEventLicenseID(w, licenseID)
+
+	email, ok := pkgstripe.GetCustomerEmail(e.Event)
+	if !ok {
+		slogging.Error(ctx, logger, "customer email not found")
+		http.Error(w, "customer email not found", http.StatusInternalServerError)
+		return
 	}
 
-	err = sentry.Init(sentry.ClientOptions{
-		Dsn:              os.Getenv("AUTHGEAR_ONCE_SENTRY_SDN"),
-		AttachStacktrace: true,
-		EnableTracing:    false,
+	license, err := deps.LicenseBackend.GetLicense(ctx, keygen.GetLicenseOptions{
+		LicenseIDOrKey: licenseID,
 	})
 	if err != nil {
-		panic(err)
+		slogging.Error(ctx, logger, "failed to get license",
+			"error", err)
+		http.Error(w, "failed to get license", http.StatusInternalServerError)
+		return
+	}
+
+	// Stripe retries the webhook when we fail to renew the license or send the email.
+	// So we record the expiry before renewing the license,
+	// and renew the license only if this checkout session has not changed the expiry yet.
+	// Only the renewal fields are set, the rest of the metadata is kept as is.
+	if license.Metadata.LastRenewalStripeCheckoutSessionID != checkoutSessionID {
+		license, err = deps.LicenseBackend.UpdateLicenseMetadata(ctx, keygen.UpdateLicenseMetadataOptions{
+			LicenseID: license.ID,
+			Metadata: keygen.LicenseMetadata{
+				LastRenewalStripeCheckoutSessionID: checkoutSessionID,
+				LastRenewalPreviousExpiry:          license.Expiry,
+			},
+		})
+		if err != nil {
+			slogging.Error(ctx, logger, "failed to record renewal",
+				"error", err)
+			http.Error(w, "failed to record renewal", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if !isSameExpiry(license.Expiry, license.Metadata.LastRenewalPreviousExpiry) {
+		slogging.Info(ctx, logger, "license was already renewed by checkout session")
+	} else {
+		license, err = deps.LicenseBackend.RenewLicense(ctx, keygen.LicenseActionOptions{
+			LicenseID: license.ID,
+		})
+		if err != nil {
+			slogging.Error(ctx, logger, "failed to renew license",
+				"error", err)
+			http.Error(w, "failed to renew license", http.StatusInternalServerError)
+			return
+		}
+		slogging.Info(ctx, logger, "renewed license",
+			"expiry", license.Expiry)
+	}
+
+	var expireAt string
+	if license.Expiry != nil {
+		expireAt = license.Expiry.UTC().Format(time.DateOnly)
+	}
+	emailData := emailtemplate.RenewalEmailData{
+		LicenseKey: license.Key,
+		ExpireAt:   expireAt,
+	}
+
+	opts := mailer.EmailOptions{
+		Sender:   deps.MailSender,
+		Subject:  "Your Authgear ONCE license has been renewed",
+		HTMLBody: emailtemplate.RenderRenewalEmail(emailData),
+		TextBody: emailtemplate.RenderRenewalEmailText(emailData),
+		To:       email,
 	}
-	defer sentry.Flush(2 * time.Second)
 
-	stripeClient := pkgstripe.NewClient(os.Getenv("AUTHGEAR_ONCE_STRIPE_SECRET_KEY"))
-	smtpPort, err := strconv.Atoi(os.Getenv("AUTHGEAR_ONCE_SMTP_PORT"))
+	err = deps.Mailer.SendEmail(ctx, opts)
 	if err != nil {
-		panic(err)
+		slogging.Error(ctx, logger, "failed to send email",
+			"error", err)
+		http.Error(w, "failed to send email", http.StatusInternalServerError)
+	} else {
+		slogging.Info(ctx, logger, "sent renewal confirmation to checkout session")
+		// Return 200 implicitly.
+	}
+}
+
+// isSameExpiry reports whether a and b are the same expiry. nil means the license does not expire yet.
+func isSameExpiry(a *time.Time, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return a.Equal(*b)
+}
+
+// handlePaymentFailure tells the customer that the delayed payment of the checkout session has failed.
+func handlePaymentFailure(w http.ResponseWriter, r *http.Request, e *pkgstripe.Event) {
+	ctx := r.Context()
+	logger := slogging.GetLogger(ctx)
+	deps := GetDependencies(ctx)
+
+	email, ok := pkgstripe.GetCustomerEmail(e.Event)
+	if !ok {
+		slogging.Error(ctx, logger, "customer email not found")
+		http.Error(w, "customer email not found", http.StatusInternalServerError)
+		return
+	}
+
+	_, isRenewal := pkgstripe.GetRenewLicenseID(e)
+
+	// The plan name is informational, so an unknown price does not fail the notification.
+	var planName string
+	if priceID, ok := pkgstripe.GetPriceID(e); ok {
+		if plan, ok := deps.Catalog.GetPlanByStripePriceID(priceID); ok {
+			planName = plan.Name
+		}
+	}
+
+	emailData := emailtemplate.PaymentFailedEmailData{
+		IsRenewal: isRenewal,
+		PlanName:  planName,
+	}
+
+	opts := mailer.EmailOptions{
+		Sender:   deps.MailSender,
+		Subject:  "Your payment for Authgear ONCE has failed",
+		HTMLBody: emailtemplate.RenderPaymentFailedEmail(emailData),
+		TextBody: emailtemplate.RenderPaymentFailedEmailText(emailData),
+		To:       email,
+	}
+
+	err := deps.Mailer.SendEmail(ctx, opts)
+	if err != nil {
+		slogging.Error(ctx, logger, "failed to send email",
+			"error", err)
+		http.Error(w, "failed to send email", http.StatusInternalServerError)
+	} else {
+		slogging.Info(ctx, logger, "sent payment failure notice to checkout session")
+		// Return 200 implicitly.
+	}
+}
+
+// handleLicenseSuspension suspends the license of the checkout session when the payment is refunded or disputed,
+// and reinstates it when the dispute is won.
+// getLicenseOfCheckoutSession returns the license issued by the checkout session of the event,
+// or the license renewed by it, so that a refund or a dispute of a renewal suspends the license too.
+func getLicenseOfCheckoutSession(ctx context.Context, e *pkgstripe.Event) (*keygen.License, error) {
+	deps := GetDependencies(ctx)
+	if licenseID, ok := pkgstripe.GetRenewLicenseID(e); ok {
+		return deps.LicenseBackend.GetLicense(ctx, keygen.GetLicenseOptions{
+			LicenseIDOrKey: licenseID,
+		})
+	}
+	return deps.LicenseBackend.GetLicenseByStripeCheckoutSessionID(ctx, keygen.GetLicenseByStripeCheckoutSessionIDOptions{
+		StripeCheckoutSessionID: e.CheckoutSession.ID,
+	})
+}
+
+func handleLicenseSuspension(w http.ResponseWriter, r *http.Request, e *pkgstripe.Event, action pkgstripe.LicenseAction) {
+	ctx := r.Context()
+	logger := slogging.GetLogger(ctx)
+	deps := GetDependencies(ctx)
+
+	license, err := getLicenseOfCheckoutSession(ctx, e)
+	if err != nil {
+		if errors.Is(err, keygen.ErrLicenseKeyNotFound) {
+			// Ignore the event by returning 200
+			slogging.Info(ctx, logger, "ignore event because no license was issued or renewed by checkout session")
+			return
+		}
+		slogging.Error(ctx, logger, "failed to search license key",
+			"error", err)
+		http.Error(w, "failed to search license key", http.StatusInternalServerError)
+		return
+	}
+	logger = logger.With("keygen_license_id", license.ID)
+	setWebhookEventLicenseID(w, license.ID)
+
+	switch action {
+	case pkgstripe.LicenseActionSuspend:
+		if license.Suspended {
+			slogging.Info(ctx, logger, "license is already suspended")
+			return
+		}
+		err = deps.LicenseBackend.SuspendLicense(ctx, keygen.LicenseActionOptions{
+			LicenseID: license.ID,
+		})
+		if err != nil {
+			slogging.Error(ctx, logger, "failed to suspend license",
+				"error", err)
+			http.Error(w, "failed to suspend license", http.StatusInternalServerError)
+			return
+		}
+		slogging.Info(ctx, logger, "suspended license")
+	case pkgstripe.LicenseActionReinstate:
+		if !license.Suspended {
+			slogging.Info(ctx, logger, "license is not suspended")
+			return
+		}
+		err = deps.LicenseBackend.ReinstateLicense(ctx, keygen.LicenseActionOptions{
+			LicenseID: license.ID,
+		})
+		if err != nil {
+			slogging.Error(ctx, logger, "failed to reinstate license",
+				"error", err)
+			http.Error(w, "failed to reinstate license", http.StatusInternalServerError)
+			return
+		}
+		slogging.Info(ctx, logger, "reinstated license")
+	}
+}
+
+// getenvDuration parses the environment variable with time.ParseDuration.
+// It returns defaultValue if the environment variable is not set.
+func getenvDuration(name string, defaultValue time.Duration) time.Duration {
+	v := os.Getenv(name)
+	if v == "" {
+		return defaultValue
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		panic(fmt.Errorf("%v: %w", name, err))
+	}
+	return d
+}
+
+// getenvInt parses the environment variable with strconv.Atoi.
+// It returns defaultValue if the environment variable is not set.
+func getenvInt(name string, defaultValue int) int {
+	v := os.Getenv(name)
+	if v == "" {
+		return defaultValue
+	}
+	i, err := strconv.Atoi(v)
+	if err != nil {
+		panic(fmt.Errorf("%v: %w", name, err))
+	}
+	return i
+}
+
+// getMailSender returns AUTHGEAR_ONCE_MAIL_SENDER.
+// AUTHGEAR_ONCE_SMTP_SENDER is read if it is not set, for the configurations before every transport had a sender.
+func getMailSender() string {
+	if v := os.Getenv("AUTHGEAR_ONCE_MAIL_SENDER"); v != "" {
+		return v
+	}
+	return os.Getenv("AUTHGEAR_ONCE_SMTP_SENDER")
+}
+
+// newMailer returns the mailer selected by AUTHGEAR_ONCE_MAIL_TRANSPORT.
+// It panics if the configuration is invalid.
+func newMailer() mailer.Mailer {
+	switch transport := os.Getenv("AUTHGEAR_ONCE_MAIL_TRANSPORT"); transport {
+	case "", "smtp":
+		return mailer.NewSMTPMailer(mailer.NewSMTPMailerOptions{
+			SMTPHost:     os.Getenv("AUTHGEAR_ONCE_SMTP_HOST"),
+			SMTPPort:     getenvInt("AUTHGEAR_ONCE_SMTP_PORT", 587),
+			SMTPUsername: os.Getenv("AUTHGEAR_ONCE_SMTP_USERNAME"),
+			SMTPPassword: os.Getenv("AUTHGEAR_ONCE_SMTP_PASSWORD"),
+		})
+	case "http":
+		return &mailer.HTTPMailer{
+			HTTPClient: &http.Client{
+				Timeout: getenvDuration("AUTHGEAR_ONCE_MAIL_HTTP_TIMEOUT", 30*time.Second),
+			},
+			Endpoint: os.Getenv("AUTHGEAR_ONCE_MAIL_HTTP_ENDPOINT"),
+			Token:    os.Getenv("AUTHGEAR_ONCE_MAIL_HTTP_TOKEN"),
+		}
+	case "file":
+		dir := os.Getenv("AUTHGEAR_ONCE_MAIL_FILE_DIR")
+		if dir == "" {
+			panic(fmt.Errorf("AUTHGEAR_ONCE_MAIL_FILE_DIR must be set when AUTHGEAR_ONCE_MAIL_TRANSPORT is file"))
+		}
+		return mailer.NewFileMailer(dir)
+	case "log":
+		return mailer.LogMailer{}
+	default:
+		panic(fmt.Errorf("AUTHGEAR_ONCE_MAIL_TRANSPORT: unknown transport %q", transport))
+	}
+}
+
+// newDependencies reads the configuration of the server from the environment.
+// It panics if the configuration cannot be parsed.
+func newDependencies() (dependencies Dependencies, err error) {
+	stripeClient := pkgstripe.NewClient(os.Getenv("AUTHGEAR_ONCE_STRIPE_SECRET_KEY"), pkgstripe.ClientOptions{
+		Timeout:           getenvDuration("AUTHGEAR_ONCE_STRIPE_TIMEOUT", 30*time.Second),
+		MaxNetworkRetries: int64(getenvInt("AUTHGEAR_ONCE_STRIPE_MAX_NETWORK_RETRIES", 2)),
+	})
+
+	// When AUTHGEAR_ONCE_CATALOG is not specified, the catalog consists of a single plan.
+	var productCatalog *catalog.Catalog
+	if v := os.Getenv("AUTHGEAR_ONCE_CATALOG"); v != "" {
+		productCatalog, err = catalog.ParseCatalog(v)
+		if err != nil {
+			panic(err)
+		}
+	} else {
+		productCatalog = &catalog.Catalog{
+			Plans: []catalog.Plan{
+				{
+					ID:                   "default",
+					StripePriceID:        os.Getenv("AUTHGEAR_ONCE_STRIPE_CHECKOUT_SESSION_PRICE_ID"),
+					KeygenPolicyID:       os.Getenv("AUTHGEAR_ONCE_KEYGEN_POLICY_ID"),
+					StripeRenewalPriceID: os.Getenv("AUTHGEAR_ONCE_STRIPE_CHECKOUT_SESSION_RENEWAL_PRICE_ID"),
+				},
+			},
+		}
+	}
+
+	var keygenDebugRawResponse bool
+	if v := os.Getenv("AUTHGEAR_ONCE_KEYGEN_DEBUG_RAW_RESPONSE"); v != "" {
+		keygenDebugRawResponse, err = strconv.ParseBool(v)
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	var licenseFileSigningKey ed25519.PrivateKey
+	if v := os.Getenv("AUTHGEAR_ONCE_LICENSE_FILE_SIGNING_KEY"); v != "" {
+		licenseFileSigningKey, err = licensefile.ParseSigningKey(v)
+		if err != nil {
+			panic(err)
+		}
 	}
 
-	smtpDialer := smtp.NewDialer(smtp.NewDialerOptions{
-		SMTPHost:     os.Getenv("AUTHGEAR_ONCE_SMTP_HOST"),
-		SMTPPort:     smtpPort,
-		SMTPUsername: os.Getenv("AUTHGEAR_ONCE_SMTP_USERNAME"),
-		SMTPPassword: os.Getenv("AUTHGEAR_ONCE_SMTP_PASSWORD"),
+	emailMailer := newMailer()
+
+	keygenClient := keygen.NewClient(&http.Client{}, keygen.KeygenConfig{
+		Endpoint:                os.Getenv("AUTHGEAR_ONCE_KEYGEN_ENDPOINT"),
+		AdminToken:              os.Getenv("AUTHGEAR_ONCE_KEYGEN_ADMIN_TOKEN"),
+		Timeout:                 getenvDuration("AUTHGEAR_ONCE_KEYGEN_TIMEOUT", keygen.DefaultTimeout),
+		MaxRetries:              getenvInt("AUTHGEAR_ONCE_KEYGEN_MAX_RETRIES", keygen.DefaultMaxRetries),
+		CircuitBreakerThreshold: getenvInt("AUTHGEAR_ONCE_KEYGEN_CIRCUIT_BREAKER_THRESHOLD", keygen.DefaultCircuitBreakerThreshold),
+		CircuitBreakerCooldown:  getenvDuration("AUTHGEAR_ONCE_KEYGEN_CIRCUIT_BREAKER_COOLDOWN", keygen.DefaultCircuitBreakerCooldown),
+		DebugRawResponse:        keygenDebugRawResponse,
 	})
 
-	dependencies := Dependencies{
-		HTTPClient:                               &http.Client{},
+	var licenseBackend keygen.LicenseBackend = keygenClient
+
+	// When AUTHGEAR_ONCE_LICENSE_CACHE_FILE is specified, /v1/license/check serves the last known status during a Keygen outage.
+	if v := os.Getenv("AUTHGEAR_ONCE_LICENSE_CACHE_FILE"); v != "" {
+		gracePeriod := getenvDuration("AUTHGEAR_ONCE_LICENSE_CACHE_GRACE_PERIOD", 72*time.Hour)
+		licenseBackend = licensecache.NewBackend(
+			licenseBackend,
+			licensecache.NewFileStore(v, gracePeriod),
+			gracePeriod,
+		)
+	}
+
+	var webhookQueue *jobqueue.DirQueue
+	var webhookWorker *jobqueue.Worker
+	if v := os.Getenv("AUTHGEAR_ONCE_WEBHOOK_QUEUE_DIR"); v != "" {
+		webhookQueue, err = jobqueue.NewDirQueue(v)
+		if err != nil {
+			panic(err)
+		}
+		webhookWorker = &jobqueue.Worker{
+			Queue:        webhookQueue,
+			Handler:      handleWebhookJob,
+			MaxAttempts:  getenvInt("AUTHGEAR_ONCE_WEBHOOK_JOB_MAX_ATTEMPTS", jobqueue.DefaultMaxAttempts),
+			BaseBackoff:  getenvDuration("AUTHGEAR_ONCE_WEBHOOK_JOB_BASE_BACKOFF", jobqueue.DefaultBaseBackoff),
+			MaxBackoff:   getenvDuration("AUTHGEAR_ONCE_WEBHOOK_JOB_MAX_BACKOFF", jobqueue.DefaultMaxBackoff),
+			PollInterval: jobqueue.DefaultPollInterval,
+		}
+	}
+
+	var webhookEventStore webhookevent.Store
+	if v := os.Getenv("AUTHGEAR_ONCE_WEBHOOK_EVENT_LOG_FILE"); v != "" {
+		webhookEventStore = webhookevent.NewFileStore(v)
+	}
+
+	var expiryReminderStore expiryreminder.Store
+	if v := os.Getenv("AUTHGEAR_ONCE_EXPIRY_REMINDER_LOG_FILE"); v != "" {
+		expiryReminderStore = expiryreminder.NewFileStore(v)
+	}
+
+	dependencies = Dependencies{
 		StripeClient:                             stripeClient,
-		SMTPDialer:                               smtpDialer,
-		SMTPSender:                               os.Getenv("AUTHGEAR_ONCE_SMTP_SENDER"),
+		Mailer:                                   emailMailer,
+		MailSender:                               getMailSender(),
 		StripeCheckoutSessionSuccessURL:          os.Getenv("AUTHGEAR_ONCE_STRIPE_CHECKOUT_SESSION_SUCCESS_URL"),
 		StripeCheckoutSessionCancelURL:           os.Getenv("AUTHGEAR_ONCE_STRIPE_CHECKOUT_SESSION_CANCEL_URL"),
-		StripeCheckoutSessionPriceID:             os.Getenv("AUTHGEAR_ONCE_STRIPE_CHECKOUT_SESSION_PRICE_ID"),
+		Catalog:                                  productCatalog,
 		StripeWebhookSigningSecret:               os.Getenv("AUTHGEAR_ONCE_STRIPE_WEBHOOK_SIGNING_SECRET"),
 		StripeCheckoutSessionMetadataMarkerValue: os.Getenv("AUTHGEAR_ONCE_STRIPE_CHECKOUT_SESSION_METADATA_MARKER_VALUE"),
 		AUTHGEAR_ONCE_PUBLIC_URL_SCHEME:          os.Getenv("AUTHGEAR_ONCE_PUBLIC_URL_SCHEME"),
 		AUTHGEAR_ONCE_ONCE_COMMAND_DOWNLOAD_URL_GO_TEMPLATE: os.Getenv("AUTHGEAR_ONCE_ONCE_COMMAND_DOWNLOAD_URL_GO_TEMPLATE"),
 		AUTHGEAR_ONCE_ONCE_COMMAND_IMAGE_OVERRIDE:           os.Getenv("AUTHGEAR_ONCE_ONCE_COMMAND_IMAGE_OVERRIDE"),
-		KeygenConfig: keygen.KeygenConfig{
-			Endpoint:   os.Getenv("AUTHGEAR_ONCE_KEYGEN_ENDPOINT"),
-			AdminToken: os.Getenv("AUTHGEAR_ONCE_KEYGEN_ADMIN_TOKEN"),
-			PolicyID:   os.Getenv("AUTHGEAR_ONCE_KEYGEN_POLICY_ID"),
-		},
+		LicenseBackend:        licenseBackend,
+		KeygenClient:          keygenClient,
+		WebhookQueue:          webhookQueue,
+		WebhookWorker:         webhookWorker,
+		WebhookEventStore:     webhookEventStore,
+		ExpiryReminderStore:   expiryReminderStore,
+		LicenseFileSigningKey: licenseFileSigningKey,
+		LicenseFileValidity:   getenvDuration("AUTHGEAR_ONCE_LICENSE_FILE_VALIDITY", licensefile.DefaultValidity),
+	}
+
+	if dependencies.StripeCheckoutSessionMetadataMarkerValue == "" {
+		err = errors.New("AUTHGEAR_ONCE_STRIPE_CHECKOUT_SESSION_METADATA_MARKER_VALUE must be set")
+		return
+	}
+	return
+}
+
+func main() {
+	err := godotenv.Load()
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		panic(err)
+	}
+
+	err = sentry.Init(sentry.ClientOptions{
+		Dsn:              os.Getenv("AUTHGEAR_ONCE_SENTRY_SDN"),
+		AttachStacktrace: true,
+		EnableTracing:    false,
+	})
+	if err != nil {
+		panic(err)
 	}
+	defer sentry.Flush(2 * time.Second)
+
 	ctx := context.Background()
-	ctx = context.WithValue(ctx, dependenciesKey, dependencies)
 
 	textHandler := slog.NewTextHandler(os.Stderr, nil)
 	sentryHandler := sentryslog.Option{
@@ -454,11 +1313,6 @@ func main() {
 
 	ctx = slogging.WithLogger(ctx, logger)
 
-	if dependencies.StripeCheckoutSessionMetadataMarkerValue == "" {
-		slogging.Error(ctx, logger, "AUTHGEAR_ONCE_STRIPE_CHECKOUT_SESSION_METADATA_MARKER_VALUE must be set")
-		os.Exit(1)
-	}
-
 	if err := rootCmd.ExecuteContext(ctx); err != nil {
 		slogging.Error(ctx, logger, "root command completed with error",
 			"error", err)
@@ -0,0 +1,948 @@
+package main
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stripe/stripe-go/v82"
+	"github.com/stripe/stripe-go/v82/client"
+
+	"github.com/authgear/authgear-once-license-server/pkg/catalog"
+	"github.com/authgear/authgear-once-license-server/pkg/keygen"
+	"github.com/authgear/authgear-once-license-server/pkg/keygen/keygentest"
+	"github.com/authgear/authgear-once-license-server/pkg/licensefile"
+	"github.com/authgear/authgear-once-license-server/pkg/mailer"
+	pkgstripe "github.com/authgear/authgear-once-license-server/pkg/stripe"
+)
+
+type fakeLicense struct {
+	ID                      string
+	Key                     string
+	PolicyID                string
+	Fingerprint             string
+	Machine                 *keygen.MachineDetails
+	Suspended               bool
+	Expiry                  *time.Time
+	StripeCheckoutSessionID string
+	StripeCustomerID        string
+	Metadata                keygen.LicenseMetadata
+}
+
+// fakeLicenseBackend is an in-memory keygen.LicenseBackend.
+// Each license can be activated by at most 1 machine.
+type fakeLicenseBackend struct {
+	mu       sync.Mutex
+	licenses map[string]*fakeLicense
+}
+
+var _ keygen.LicenseBackend = (*fakeLicenseBackend)(nil)
+
+// fakeMailer keeps the emails instead of sending them.
+type fakeMailer struct {
+	mu     sync.Mutex
+	emails []mailer.EmailOptions
+}
+
+var _ mailer.Mailer = (*fakeMailer)(nil)
+
+func (m *fakeMailer) SendEmail(ctx context.Context, options mailer.EmailOptions) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.emails = append(m.emails, options)
+	return nil
+}
+
+func (m *fakeMailer) Recipients() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var recipients []string
+	for _, e := range m.emails {
+		recipients = append(recipients, e.To)
+	}
+	return recipients
+}
+
+func newFakeLicenseBackend(licenses ...*fakeLicense) *fakeLicenseBackend {
+	b := &fakeLicenseBackend{
+		licenses: map[string]*fakeLicense{},
+	}
+	for _, l := range licenses {
+		b.licenses[l.Key] = l
+	}
+	return b
+}
+
+func (b *fakeLicenseBackend) CreateLicenseKey(ctx context.Context, opts keygen.CreateLicenseKeyOptions) (licenseKey string, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	n := len(b.licenses) + 1
+	l := &fakeLicense{
+		ID:                      fmt.Sprintf("license-%v", n),
+		Key:                     fmt.Sprintf("KEY-%v", n),
+		StripeCheckoutSessionID: opts.StripeCheckoutSessionID,
+		StripeCustomerID:        opts.StripeCustomerID,
+	}
+	b.licenses[l.Key] = l
+	licenseKey = l.Key
+	return
+}
+
+func (b *fakeLicenseBackend) GetLicenseByStripeCheckoutSessionID(ctx context.Context, opts keygen.GetLicenseByStripeCheckoutSessionIDOptions) (license *keygen.License, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, l := range b.licenses {
+		if l.StripeCheckoutSessionID == opts.StripeCheckoutSessionID {
+			license = &keygen.License{
+				ID:        l.ID,
+				Key:       l.Key,
+				Suspended: l.Suspended,
+			}
+			return
+		}
+	}
+	err = keygen.ErrLicenseKeyNotFound
+	return
+}
+
+func (b *fakeLicenseBackend) SuspendLicense(ctx context.Context, opts keygen.LicenseActionOptions) (err error) {
+	return b.setSuspended(opts.LicenseID, true)
+}
+
+func (b *fakeLicenseBackend) ReinstateLicense(ctx context.Context, opts keygen.LicenseActionOptions) (err error) {
+	return b.setSuspended(opts.LicenseID, false)
+}
+
+func (b *fakeLicenseBackend) GetLicense(ctx context.Context, opts keygen.GetLicenseOptions) (license *keygen.License, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	l, err := b.find(opts.LicenseIDOrKey)
+	if err != nil {
+		return
+	}
+	license = l.license()
+	return
+}
+
+// RenewLicense extends the expiry by 1 year.
+func (b *fakeLicenseBackend) RenewLicense(ctx context.Context, opts keygen.LicenseActionOptions) (license *keygen.License, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	l, err := b.find(opts.LicenseID)
+	if err != nil {
+		return
+	}
+	if l.Expiry != nil {
+		expiry := l.Expiry.AddDate(1, 0, 0)
+		l.Expiry = &expiry
+	}
+	license = l.license()
+	return
+}
+
+func (b *fakeLicenseBackend) UpdateLicenseMetadata(ctx context.Context, opts keygen.UpdateLicenseMetadataOptions) (license *keygen.License, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	l, err := b.find(opts.LicenseID)
+	if err != nil {
+		return
+	}
+	// Merge as keygen.Client does, the fields of zero value are left unchanged.
+	patch, err := json.Marshal(opts.Metadata)
+	if err != nil {
+		return
+	}
+	err = json.Unmarshal(patch, &l.Metadata)
+	if err != nil {
+		return
+	}
+	license = l.license()
+	return
+}
+
+func (b *fakeLicenseBackend) find(licenseIDOrKey string) (l *fakeLicense, err error) {
+	for _, l = range b.licenses {
+		if l.ID == licenseIDOrKey || l.Key == licenseIDOrKey {
+			return
+		}
+	}
+	l = nil
+	err = keygen.ErrLicenseKeyNotFound
+	return
+}
+
+func (l *fakeLicense) license() *keygen.License {
+	return &keygen.License{
+		ID:        l.ID,
+		Key:       l.Key,
+		PolicyID:  l.PolicyID,
+		Expiry:    l.Expiry,
+		Suspended: l.Suspended,
+		Metadata:  l.Metadata,
+	}
+}
+
+func (b *fakeLicenseBackend) setSuspended(licenseID string, suspended bool) (err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, l := range b.licenses {
+		if l.ID == licenseID {
+			l.Suspended = suspended
+			return
+		}
+	}
+	err = keygen.ErrLicenseKeyNotFound
+	return
+}
+
+func (b *fakeLicenseBackend) ValidateLicenseKey(ctx context.Context, opts keygen.LicenseOptions) (licenseID *keygen.LicenseID, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.validate(opts)
+}
+
+func (b *fakeLicenseBackend) validate(opts keygen.LicenseOptions) (licenseID *keygen.LicenseID, err error) {
+	l, ok := b.licenses[opts.LicenseKey]
+	if !ok {
+		err = keygen.ErrLicenseKeyNotFound
+		return
+	}
+	if l.Suspended {
+		err = keygen.ErrLicenseSuspended
+		return
+	}
+	if l.Fingerprint != "" && l.Fingerprint != opts.Fingerprint {
+		err = keygen.ErrLicenseKeyAlreadyActivated
+		return
+	}
+
+	licenseID = &keygen.LicenseID{
+		ID:                      l.ID,
+		IsActivated:             l.Fingerprint != "",
+		StripeCheckoutSessionID: l.StripeCheckoutSessionID,
+		StripeCustomerID:        l.StripeCustomerID,
+	}
+	return
+}
+
+func (b *fakeLicenseBackend) ActivateLicense(ctx context.Context, opts keygen.LicenseOptions) (licenseID *keygen.LicenseID, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	licenseID, err = b.validate(opts)
+	if err != nil {
+		return
+	}
+	if !licenseID.IsActivated {
+		b.licenses[opts.LicenseKey].Fingerprint = opts.Fingerprint
+		b.licenses[opts.LicenseKey].Machine = opts.Machine
+	}
+	return b.validate(opts)
+}
+
+func (b *fakeLicenseBackend) CheckLicense(ctx context.Context, opts keygen.LicenseOptions) (licenseID *keygen.LicenseID, err error) {
+	return b.ValidateLicenseKey(ctx, opts)
+}
+
+func (b *fakeLicenseBackend) DeactivateLicense(ctx context.Context, opts keygen.LicenseOptions) (licenseID *keygen.LicenseID, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	licenseID, err = b.validate(opts)
+	if err != nil {
+		if errors.Is(err, keygen.ErrLicenseKeyAlreadyActivated) {
+			err = errors.Join(keygen.ErrMachineNotFound, err)
+		}
+		return
+	}
+	if !licenseID.IsActivated {
+		err = keygen.ErrLicenseKeyNotActivated
+		return
+	}
+	b.licenses[opts.LicenseKey].Fingerprint = ""
+	b.licenses[opts.LicenseKey].Machine = nil
+	return b.validate(opts)
+}
+
+func TestMakeHandler_v1_license(t *testing.T) {
+	tests := []struct {
+		name           string
+		f              func(backend keygen.LicenseBackend, ctx context.Context, opts keygen.LicenseOptions) (*keygen.LicenseID, error)
+		licenses       []*fakeLicense
+		form           url.Values
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name:           "missing fingerprint",
+			f:              keygen.LicenseBackend.ActivateLicense,
+			form:           url.Values{"license_key": {"KEY-1"}},
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   `{"error":{"code":"bad_request"}}`,
+		},
+		{
+			name:           "activate unknown license key",
+			f:              keygen.LicenseBackend.ActivateLicense,
+			form:           url.Values{"license_key": {"KEY-1"}, "fingerprint": {"fg1"}},
+			expectedStatus: http.StatusNotFound,
+			expectedBody:   `{"error":{"code":"license_key_not_found"}}`,
+		},
+		{
+			name:           "activate",
+			f:              keygen.LicenseBackend.ActivateLicense,
+			licenses:       []*fakeLicense{{ID: "license-1", Key: "KEY-1"}},
+			form:           url.Values{"license_key": {"KEY-1"}, "fingerprint": {"fg1"}},
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"data":{"expire_at":null,"is_activated":true,"is_expired":false,"licensee_email":null}}`,
+		},
+		{
+			name:           "activate on another machine",
+			f:              keygen.LicenseBackend.ActivateLicense,
+			licenses:       []*fakeLicense{{ID: "license-1", Key: "KEY-1", Fingerprint: "fg1"}},
+			form:           url.Values{"license_key": {"KEY-1"}, "fingerprint": {"fg2"}},
+			expectedStatus: http.StatusForbidden,
+			expectedBody:   `{"error":{"code":"license_key_already_activated"}}`,
+		},
+		{
+			name:           "check license pending activation",
+			f:              keygen.LicenseBackend.CheckLicense,
+			licenses:       []*fakeLicense{{ID: "license-1", Key: "KEY-1"}},
+			form:           url.Values{"license_key": {"KEY-1"}, "fingerprint": {"fg1"}},
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"data":{"expire_at":null,"is_activated":false,"is_expired":false,"licensee_email":null}}`,
+		},
+		{
+			name:           "check suspended license",
+			f:              keygen.LicenseBackend.CheckLicense,
+			licenses:       []*fakeLicense{{ID: "license-1", Key: "KEY-1", Fingerprint: "fg1", Suspended: true}},
+			form:           url.Values{"license_key": {"KEY-1"}, "fingerprint": {"fg1"}},
+			expectedStatus: http.StatusForbidden,
+			expectedBody:   `{"error":{"code":"license_suspended"}}`,
+		},
+		{
+			name:           "deactivate",
+			f:              keygen.LicenseBackend.DeactivateLicense,
+			licenses:       []*fakeLicense{{ID: "license-1", Key: "KEY-1", Fingerprint: "fg1"}},
+			form:           url.Values{"license_key": {"KEY-1"}, "fingerprint": {"fg1"}},
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"data":{"expire_at":null,"is_activated":false,"is_expired":false,"licensee_email":null}}`,
+		},
+		{
+			name:           "deactivate license pending activation",
+			f:              keygen.LicenseBackend.DeactivateLicense,
+			licenses:       []*fakeLicense{{ID: "license-1", Key: "KEY-1"}},
+			form:           url.Values{"license_key": {"KEY-1"}, "fingerprint": {"fg1"}},
+			expectedStatus: http.StatusForbidden,
+			expectedBody:   `{"error":{"code":"license_key_not_activated"}}`,
+		},
+		{
+			name:           "deactivate another machine",
+			f:              keygen.LicenseBackend.DeactivateLicense,
+			licenses:       []*fakeLicense{{ID: "license-1", Key: "KEY-1", Fingerprint: "fg1"}},
+			form:           url.Values{"license_key": {"KEY-1"}, "fingerprint": {"fg2"}},
+			expectedStatus: http.StatusNotFound,
+			expectedBody:   `{"error":{"code":"machine_not_found"}}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.WithValue(context.Background(), dependenciesKey, Dependencies{
+				LicenseBackend: newFakeLicenseBackend(tt.licenses...),
+			})
+
+			req := httptest.NewRequest("POST", "/", strings.NewReader(tt.form.Encode())).WithContext(ctx)
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			rec := httptest.NewRecorder()
+
+			MakeHandler_v1_license(tt.f).ServeHTTP(rec, req)
+
+			if rec.Code != tt.expectedStatus {
+				t.Errorf("expected status %d; got %d", tt.expectedStatus, rec.Code)
+			}
+			if !json.Valid(rec.Body.Bytes()) {
+				t.Fatalf("expected JSON response; got %v", rec.Body.String())
+			}
+			if got := rec.Body.String(); got != tt.expectedBody {
+				t.Errorf("expected body %v; got %v", tt.expectedBody, got)
+			}
+		})
+	}
+}
+
+func TestParseMachineDetails(t *testing.T) {
+	tests := []struct {
+		name       string
+		form       url.Values
+		expected   *keygen.MachineDetails
+		expectedOK bool
+	}{
+		{
+			name:       "absent",
+			form:       url.Values{},
+			expected:   nil,
+			expectedOK: true,
+		},
+		{
+			name: "all",
+			form: url.Values{"hostname": {"auth.example.com"}, "platform": {"linux/amd64"}, "cores": {"4"}, "once_version": {"v1.0.0"}},
+			expected: &keygen.MachineDetails{
+				Hostname:    "auth.example.com",
+				Platform:    "linux/amd64",
+				Cores:       4,
+				OnceVersion: "v1.0.0",
+			},
+			expectedOK: true,
+		},
+		{
+			name:       "some",
+			form:       url.Values{"once_version": {"v1.0.0"}},
+			expected:   &keygen.MachineDetails{OnceVersion: "v1.0.0"},
+			expectedOK: true,
+		},
+		{
+			name: "cores not a number",
+			form: url.Values{"cores": {"four"}},
+		},
+		{
+			name: "zero cores",
+			form: url.Values{"cores": {"0"}},
+		},
+		{
+			name: "hostname too long",
+			form: url.Values{"hostname": {strings.Repeat("a", 254)}},
+		},
+		{
+			name: "control character",
+			form: url.Values{"platform": {"linux\n"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := parseMachineDetails(tt.form)
+			if ok != tt.expectedOK {
+				t.Fatalf("expected ok %v; got %v", tt.expectedOK, ok)
+			}
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("expected %v; got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestMakeHandler_v1_license_activate_machine(t *testing.T) {
+	backend := newFakeLicenseBackend(&fakeLicense{ID: "license-1", Key: "KEY-1"})
+	ctx := context.WithValue(context.Background(), dependenciesKey, Dependencies{
+		LicenseBackend: backend,
+	})
+
+	form := url.Values{"license_key": {"KEY-1"}, "fingerprint": {"fg1"}, "hostname": {"auth.example.com"}, "cores": {"2"}}
+	req := httptest.NewRequest("POST", "/", strings.NewReader(form.Encode())).WithContext(ctx)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec := httptest.NewRecorder()
+
+	Handler_v1_license_activate(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status %d; got %d", http.StatusOK, rec.Code)
+	}
+	expected := &keygen.MachineDetails{Hostname: "auth.example.com", Cores: 2}
+	if got := backend.licenses["KEY-1"].Machine; !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected machine %v; got %v", expected, got)
+	}
+}
+
+// TestMakeHandler_v1_license_invalid_machine tests that invalid machine details only fail activation.
+func TestMakeHandler_v1_license_invalid_machine(t *testing.T) {
+	tests := []struct {
+		name           string
+		handler        http.HandlerFunc
+		expectedStatus int
+	}{
+		{"activate", Handler_v1_license_activate, http.StatusBadRequest},
+		{"check", MakeHandler_v1_license(keygen.LicenseBackend.CheckLicense), http.StatusOK},
+		{"deactivate", MakeHandler_v1_license(keygen.LicenseBackend.DeactivateLicense), http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.WithValue(context.Background(), dependenciesKey, Dependencies{
+				LicenseBackend: newFakeLicenseBackend(&fakeLicense{ID: "license-1", Key: "KEY-1", Fingerprint: "fg1"}),
+			})
+
+			form := url.Values{"license_key": {"KEY-1"}, "fingerprint": {"fg1"}, "hostname": {"auth\nexample.com"}, "cores": {"-1"}}
+			req := httptest.NewRequest("POST", "/", strings.NewReader(form.Encode())).WithContext(ctx)
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			rec := httptest.NewRecorder()
+
+			tt.handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.expectedStatus {
+				t.Errorf("expected status %d; got %d: %v", tt.expectedStatus, rec.Code, rec.Body.String())
+			}
+		})
+	}
+}
+
+// TestMakeHandler_v1_license_keygen runs the handlers with keygen.Client against the fake Keygen server.
+func TestMakeHandler_v1_license_keygen(t *testing.T) {
+	server := keygentest.NewServer(keygentest.Policy{ID: "policy-1", MaxMachines: 1})
+	defer server.Close()
+	l := server.AddLicense(keygentest.License{PolicyID: "policy-1"})
+
+	ctx := context.WithValue(context.Background(), dependenciesKey, Dependencies{
+		LicenseBackend: keygen.NewClient(server.Client(), server.Config()),
+	})
+
+	steps := []struct {
+		f              func(backend keygen.LicenseBackend, ctx context.Context, opts keygen.LicenseOptions) (*keygen.LicenseID, error)
+		fingerprint    string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{keygen.LicenseBackend.CheckLicense, "fg1", http.StatusOK, `{"data":{"expire_at":null,"is_activated":false,"is_expired":false,"licensee_email":null}}`},
+		{keygen.LicenseBackend.ActivateLicense, "fg1", http.StatusOK, `{"data":{"expire_at":null,"is_activated":true,"is_expired":false,"licensee_email":null}}`},
+		{keygen.LicenseBackend.ActivateLicense, "fg2", http.StatusForbidden, `{"error":{"code":"license_key_already_activated"}}`},
+		{keygen.LicenseBackend.DeactivateLicense, "fg2", http.StatusNotFound, `{"error":{"code":"machine_not_found"}}`},
+		{keygen.LicenseBackend.DeactivateLicense, "fg1", http.StatusOK, `{"data":{"expire_at":null,"is_activated":false,"is_expired":false,"licensee_email":null}}`},
+		{keygen.LicenseBackend.ActivateLicense, "fg2", http.StatusOK, `{"data":{"expire_at":null,"is_activated":true,"is_expired":false,"licensee_email":null}}`},
+	}
+
+	for i, step := range steps {
+		form := url.Values{"license_key": {l.Key}, "fingerprint": {step.fingerprint}}
+		req := httptest.NewRequest("POST", "/", strings.NewReader(form.Encode())).WithContext(ctx)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rec := httptest.NewRecorder()
+
+		MakeHandler_v1_license(step.f).ServeHTTP(rec, req)
+
+		if rec.Code != step.expectedStatus {
+			t.Errorf("step %d: expected status %d; got %d", i, step.expectedStatus, rec.Code)
+		}
+		if got := rec.Body.String(); got != step.expectedBody {
+			t.Errorf("step %d: expected body %v; got %v", i, step.expectedBody, got)
+		}
+	}
+}
+
+func TestMakeHandler_v1_license_licensee_email(t *testing.T) {
+	server := keygentest.NewServer(keygentest.Policy{ID: "policy-1", MaxMachines: 1})
+	defer server.Close()
+	l := server.AddLicense(keygentest.License{
+		PolicyID: "policy-1",
+		Metadata: keygen.LicenseMetadata{
+			StripeCustomerID: "cus_1",
+			LicenseeEmail:    "user@example.com",
+		},
+	})
+
+	// StripeClient is nil, so the handler would panic if it looked up the email from Stripe.
+	ctx := context.WithValue(context.Background(), dependenciesKey, Dependencies{
+		LicenseBackend: keygen.NewClient(server.Client(), server.Config()),
+	})
+
+	form := url.Values{"license_key": {l.Key}, "fingerprint": {"fg1"}}
+	req := httptest.NewRequest("POST", "/", strings.NewReader(form.Encode())).WithContext(ctx)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec := httptest.NewRecorder()
+
+	MakeHandler_v1_license(keygen.LicenseBackend.CheckLicense).ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Errorf("expected status %d; got %d", http.StatusOK, rec.Code)
+	}
+	expectedBody := `{"data":{"expire_at":null,"is_activated":false,"is_expired":false,"licensee_email":"user@example.com"}}`
+	if got := rec.Body.String(); got != expectedBody {
+		t.Errorf("expected body %v; got %v", expectedBody, got)
+	}
+}
+
+func TestMakeHandler_v1_license_service_unavailable(t *testing.T) {
+	server := keygentest.NewServer()
+	// Keygen is unreachable.
+	server.Close()
+
+	ctx := context.WithValue(context.Background(), dependenciesKey, Dependencies{
+		LicenseBackend: keygen.NewClient(server.Client(), server.Config()),
+	})
+
+	form := url.Values{"license_key": {"KEY-1"}, "fingerprint": {"fg1"}}
+	req := httptest.NewRequest("POST", "/", strings.NewReader(form.Encode())).WithContext(ctx)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec := httptest.NewRecorder()
+
+	MakeHandler_v1_license(keygen.LicenseBackend.CheckLicense).ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected status %d; got %d", http.StatusServiceUnavailable, rec.Code)
+	}
+	expectedBody := `{"error":{"code":"service_unavailable"}}`
+	if got := rec.Body.String(); got != expectedBody {
+		t.Errorf("expected body %v; got %v", expectedBody, got)
+	}
+}
+
+func TestHandler_v1_license_file(t *testing.T) {
+	privateKey := ed25519.NewKeyFromSeed([]byte(strings.Repeat("a", ed25519.SeedSize)))
+
+	ctx := context.WithValue(context.Background(), dependenciesKey, Dependencies{
+		LicenseBackend:        newFakeLicenseBackend(&fakeLicense{ID: "license-1", Key: "KEY-1"}),
+		LicenseFileSigningKey: privateKey,
+	})
+
+	form := url.Values{"license_key": {"KEY-1"}, "fingerprint": {"fg1"}}
+	req := httptest.NewRequest("POST", "/", strings.NewReader(form.Encode())).WithContext(ctx)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec := httptest.NewRecorder()
+
+	Handler_v1_license_file(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status %d; got %d", http.StatusOK, rec.Code)
+	}
+
+	var resp struct {
+		Data licensefile.LicenseFile `json:"data"`
+	}
+	err := json.Unmarshal(rec.Body.Bytes(), &resp)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	payload, err := licensefile.Verify(&resp.Data, licensefile.VerifyOptions{
+		PublicKey:   privateKey.Public().(ed25519.PublicKey),
+		Fingerprint: "fg1",
+		Now:         time.Now(),
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if payload.LicenseKey != "KEY-1" || !payload.IsActivated {
+		t.Errorf("unexpected payload %v", payload)
+	}
+	if validity := payload.ValidUntil.Sub(payload.IssuedAt); validity != licensefile.DefaultValidity {
+		t.Errorf("expected license file to be valid for %v, got %v", licensefile.DefaultValidity, validity)
+	}
+}
+
+func TestHandler_v1_stripe_checkout_renew(t *testing.T) {
+	// The fake Stripe API records the price of the created checkout session.
+	var priceID string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = r.ParseForm()
+		priceID = r.PostForm.Get("line_items[0][price]")
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"id":"cs_1","object":"checkout.session","url":"https://checkout.stripe.com/c/pay/cs_1"}`))
+	}))
+	defer server.Close()
+	stripeClient := client.New("sk_test", stripe.NewBackendsWithConfig(&stripe.BackendConfig{
+		URL: stripe.String(server.URL),
+	}))
+
+	productCatalog := &catalog.Catalog{
+		Plans: []catalog.Plan{
+			{ID: "1y", StripePriceID: "price_1y", KeygenPolicyID: "policy_1y"},
+			{ID: "3y", StripePriceID: "price_3y", KeygenPolicyID: "policy_3y", StripeRenewalPriceID: "price_3y_renewal"},
+		},
+	}
+
+	tests := []struct {
+		name            string
+		method          string
+		query           url.Values
+		expectedStatus  int
+		expectedBody    string
+		expectedPriceID string
+	}{
+		{
+			name:           "missing license key",
+			method:         "POST",
+			query:          url.Values{},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "unknown license key",
+			method:         "POST",
+			query:          url.Values{"license_key": {"KEY-4"}},
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name:            "price of the plan",
+			method:          "POST",
+			query:           url.Values{"license_key": {"KEY-1"}},
+			expectedStatus:  http.StatusSeeOther,
+			expectedPriceID: "price_1y",
+		},
+		{
+			name:            "renewal price of the plan",
+			method:          "POST",
+			query:           url.Values{"license_key": {"KEY-3"}},
+			expectedStatus:  http.StatusSeeOther,
+			expectedPriceID: "price_3y_renewal",
+		},
+		{
+			name:           "policy not in the catalog",
+			method:         "POST",
+			query:          url.Values{"license_key": {"KEY-2"}},
+			expectedStatus: http.StatusInternalServerError,
+		},
+		{
+			name:           "GET shows the page without creating a checkout session",
+			method:         "GET",
+			query:          url.Values{"license_key": {"KEY-3"}},
+			expectedStatus: http.StatusOK,
+			expectedBody:   `<input type="hidden" name="license_key" value="KEY-3" />`,
+		},
+		{
+			name:           "GET of unknown license key",
+			method:         "GET",
+			query:          url.Values{"license_key": {"KEY-4"}},
+			expectedStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			priceID = ""
+			ctx := context.WithValue(context.Background(), dependenciesKey, Dependencies{
+				LicenseBackend: newFakeLicenseBackend(
+					&fakeLicense{ID: "license-1", Key: "KEY-1", PolicyID: "policy_1y"},
+					&fakeLicense{ID: "license-2", Key: "KEY-2", PolicyID: "policy_legacy"},
+					&fakeLicense{ID: "license-3", Key: "KEY-3", PolicyID: "policy_3y"},
+				),
+				StripeClient: stripeClient,
+				Catalog:      productCatalog,
+			})
+
+			var req *http.Request
+			if tt.method == "POST" {
+				req = httptest.NewRequest("POST", "/", strings.NewReader(tt.query.Encode()))
+				req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			} else {
+				req = httptest.NewRequest(tt.method, "/?"+tt.query.Encode(), nil)
+			}
+			req = req.WithContext(ctx)
+			rec := httptest.NewRecorder()
+
+			Handler_v1_stripe_checkout_renew(rec, req)
+
+			if rec.Code != tt.expectedStatus {
+				t.Errorf("expected status %d; got %d", tt.expectedStatus, rec.Code)
+			}
+			if body := rec.Body.String(); !strings.Contains(body, tt.expectedBody) {
+				t.Errorf("expected body to contain %q; got %q", tt.expectedBody, body)
+			}
+			if priceID != tt.expectedPriceID {
+				t.Errorf("expected price %q; got %q", tt.expectedPriceID, priceID)
+			}
+		})
+	}
+}
+
+func TestHandleLicenseRenewal_retry(t *testing.T) {
+	expiry := time.Date(2025, 5, 1, 0, 0, 0, 0, time.UTC)
+	expectedExpiry := expiry.AddDate(1, 0, 0)
+
+	tests := []struct {
+		name                      string
+		failUpdateLicenseMetadata int
+		failRenewLicense          int
+		expectedDeliveries        int
+	}{
+		{"no failure", 0, 0, 1},
+		{"failed to record renewal", 1, 0, 2},
+		{"failed to renew", 0, 1, 2},
+		{"failed to record renewal and to renew", 1, 1, 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backend := &flakyLicenseBackend{
+				fakeLicenseBackend: newFakeLicenseBackend(&fakeLicense{
+					ID:     "license-1",
+					Key:    "KEY-1",
+					Expiry: &expiry,
+					Metadata: keygen.LicenseMetadata{
+						StripeCheckoutSessionID:            "cs_1",
+						LicenseeEmail:                      "user@example.com",
+						LastRenewalStripeCheckoutSessionID: "cs_previous",
+					},
+				}),
+				failUpdateLicenseMetadata: tt.failUpdateLicenseMetadata,
+				failRenewLicense:          tt.failRenewLicense,
+			}
+			emailMailer := &fakeMailer{}
+			ctx := context.WithValue(context.Background(), dependenciesKey, Dependencies{
+				LicenseBackend: backend,
+				Mailer:         emailMailer,
+				MailSender:     "noreply@example.com",
+			})
+
+			e := pkgstripe.NewCheckoutSessionCompletedEvent(newTestCheckoutSession("cs_renew", stripe.CheckoutSessionPaymentStatusPaid, map[string]string{
+				pkgstripe.MetadataKeyRenewLicenseID: "license-1",
+			}))
+			deliver := func() int {
+				req := httptest.NewRequest("POST", "/v1/stripe/webhook", nil).WithContext(ctx)
+				rec := httptest.NewRecorder()
+				handleLicenseRenewal(rec, req, e)
+				return rec.Code
+			}
+
+			// Stripe delivers the event again until it succeeds.
+			deliveries := 1
+			for deliver() != http.StatusOK {
+				deliveries++
+				if deliveries > tt.expectedDeliveries {
+					t.Fatalf("expected %d deliveries to succeed", tt.expectedDeliveries)
+				}
+			}
+			if deliveries != tt.expectedDeliveries {
+				t.Errorf("expected %d deliveries; got %d", tt.expectedDeliveries, deliveries)
+			}
+
+			// A redelivery of a handled event does not renew the license again.
+			if code := deliver(); code != http.StatusOK {
+				t.Errorf("expected status %d; got %d", http.StatusOK, code)
+			}
+
+			license, err := backend.GetLicense(ctx, keygen.GetLicenseOptions{LicenseIDOrKey: "license-1"})
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if !license.Expiry.Equal(expectedExpiry) {
+				t.Errorf("expected expiry %v; got %v", expectedExpiry, license.Expiry)
+			}
+			// Recording the renewal keeps the rest of the metadata.
+			if license.Metadata.StripeCheckoutSessionID != "cs_1" || license.Metadata.LicenseeEmail != "user@example.com" {
+				t.Errorf("expected metadata to be preserved, got %+v", license.Metadata)
+			}
+			if got := len(emailMailer.emails); got != 2 {
+				t.Errorf("expected 2 emails; got %d", got)
+			}
+		})
+	}
+}
+
+func TestHandleLicenseSuspension(t *testing.T) {
+	tests := []struct {
+		name              string
+		checkoutSession   *stripe.CheckoutSession
+		expectedSuspended bool
+	}{
+		{
+			name:              "checkout session of the license",
+			checkoutSession:   &stripe.CheckoutSession{ID: "cs_1"},
+			expectedSuspended: true,
+		},
+		{
+			name: "renewal checkout session",
+			checkoutSession: &stripe.CheckoutSession{
+				ID: "cs_renew",
+				Metadata: map[string]string{
+					pkgstripe.MetadataKeyRenewLicenseID: "license-1",
+				},
+			},
+			expectedSuspended: true,
+		},
+		{
+			name:              "checkout session without license",
+			checkoutSession:   &stripe.CheckoutSession{ID: "cs_other"},
+			expectedSuspended: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backend := newFakeLicenseBackend(&fakeLicense{
+				ID:                      "license-1",
+				Key:                     "KEY-1",
+				StripeCheckoutSessionID: "cs_1",
+			})
+			ctx := context.WithValue(context.Background(), dependenciesKey, Dependencies{
+				LicenseBackend: backend,
+			})
+
+			e := newRefundEvent("evt_1", true)
+			e.CheckoutSession = tt.checkoutSession
+
+			req := httptest.NewRequest("POST", "/v1/stripe/webhook", nil).WithContext(ctx)
+			rec := httptest.NewRecorder()
+			handleLicenseSuspension(rec, req, e, pkgstripe.LicenseActionSuspend)
+
+			if rec.Code != http.StatusOK {
+				t.Errorf("expected status %d; got %d", http.StatusOK, rec.Code)
+			}
+			if got := backend.licenses["KEY-1"].Suspended; got != tt.expectedSuspended {
+				t.Errorf("expected suspended %v; got %v", tt.expectedSuspended, got)
+			}
+		})
+	}
+}
+
+func TestHandleLicenseIssuance_locale(t *testing.T) {
+	tests := []struct {
+		name            string
+		locale          string
+		country         string
+		expectedSubject string
+	}{
+		{"default", "", "", "Installing Authgear ONCE"},
+		{"checkout locale", "ja", "US", "Authgear ONCE のインストール方法"},
+		{"customer country", "auto", "HK", "安裝 Authgear ONCE"},
+		{"unsupported locale", "de", "DE", "Installing Authgear ONCE"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			emailMailer := &fakeMailer{}
+			ctx := context.WithValue(context.Background(), dependenciesKey, Dependencies{
+				LicenseBackend: newFakeLicenseBackend(),
+				Mailer:         emailMailer,
+				MailSender:     "noreply@example.com",
+				Catalog: &catalog.Catalog{
+					Plans: []catalog.Plan{{ID: "default", StripePriceID: "price_1", KeygenPolicyID: "policy-1"}},
+				},
+			})
+
+			sess := newTestCheckoutSession("cs_1", stripe.CheckoutSessionPaymentStatusPaid, nil)
+			sess.Locale = tt.locale
+			sess.CustomerDetails.Address = &stripe.Address{Country: tt.country}
+			sess.LineItems = &stripe.LineItemList{
+				Data: []*stripe.LineItem{{Price: &stripe.Price{ID: "price_1"}}},
+			}
+
+			req := httptest.NewRequest("POST", "/v1/stripe/webhook", nil).WithContext(ctx)
+			rec := httptest.NewRecorder()
+
+			handleLicenseIssuance(rec, req, pkgstripe.NewCheckoutSessionCompletedEvent(sess))
+
+			if rec.Code != http.StatusOK {
+				t.Fatalf("expected status %d; got %d: %v", http.StatusOK, rec.Code, rec.Body.String())
+			}
+			if len(emailMailer.emails) != 1 {
+				t.Fatalf("expected 1 email; got %d", len(emailMailer.emails))
+			}
+			if got := emailMailer.emails[0].Subject; got != tt.expectedSubject {
+				t.Errorf("expected subject %q; got %q", tt.expectedSubject, got)
+			}
+		})
+	}
+}
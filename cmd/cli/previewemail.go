@@ -0,0 +1,239 @@
+package main
+
+import (
+	"context"
+	"errors"
+	htmltemplate "html/template"
+	"io/fs"
+	"net"
+	"net/http"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/authgear/authgear-once-license-server/pkg/emailtemplate"
+	"github.com/authgear/authgear-once-license-server/pkg/slogging"
+)
+
+// emailPreview renders an email with sample data.
+type emailPreview struct {
+	Name string
+	// Localized is true if the email is translated to emailtemplate.SupportedLocales.
+	Localized bool
+	HTML      func(t *emailtemplate.Templates, locale string) (string, error)
+	Text      func(t *emailtemplate.Templates, locale string) (string, error)
+}
+
+const previewLicenseKey = "8ECE46-C5CB99-263245-93E5CC-AD0361-V3"
+
+var emailPreviews = []emailPreview{
+	{
+		Name:      "installation",
+		Localized: true,
+		HTML: func(t *emailtemplate.Templates, locale string) (string, error) {
+			return t.RenderInstallationEmail(previewInstallationEmailData(locale))
+		},
+		Text: func(t *emailtemplate.Templates, locale string) (string, error) {
+			return t.RenderInstallationEmailText(previewInstallationEmailData(locale))
+		},
+	},
+	{
+		Name: "renewal",
+		HTML: func(t *emailtemplate.Templates, locale string) (string, error) {
+			return t.RenderRenewalEmail(previewRenewalEmailData)
+		},
+		Text: func(t *emailtemplate.Templates, locale string) (string, error) {
+			return t.RenderRenewalEmailText(previewRenewalEmailData)
+		},
+	},
+	{
+		Name: "payment_failed",
+		HTML: func(t *emailtemplate.Templates, locale string) (string, error) {
+			return t.RenderPaymentFailedEmail(emailtemplate.PaymentFailedEmailData{PlanName: "3 years of updates"})
+		},
+		Text: func(t *emailtemplate.Templates, locale string) (string, error) {
+			return t.RenderPaymentFailedEmailText(emailtemplate.PaymentFailedEmailData{PlanName: "3 years of updates"})
+		},
+	},
+	{
+		Name: "payment_failed_renewal",
+		HTML: func(t *emailtemplate.Templates, locale string) (string, error) {
+			return t.RenderPaymentFailedEmail(emailtemplate.PaymentFailedEmailData{IsRenewal: true})
+		},
+		Text: func(t *emailtemplate.Templates, locale string) (string, error) {
+			return t.RenderPaymentFailedEmailText(emailtemplate.PaymentFailedEmailData{IsRenewal: true})
+		},
+	},
+	{
+		Name: "expiry_reminder",
+		HTML: func(t *emailtemplate.Templates, locale string) (string, error) {
+			return t.RenderExpiryReminderEmail(previewExpiryReminderEmailData(false))
+		},
+		Text: func(t *emailtemplate.Templates, locale string) (string, error) {
+			return t.RenderExpiryReminderEmailText(previewExpiryReminderEmailData(false))
+		},
+	},
+	{
+		Name: "expiry_reminder_expired",
+		HTML: func(t *emailtemplate.Templates, locale string) (string, error) {
+			return t.RenderExpiryReminderEmail(previewExpiryReminderEmailData(true))
+		},
+		Text: func(t *emailtemplate.Templates, locale string) (string, error) {
+			return t.RenderExpiryReminderEmailText(previewExpiryReminderEmailData(true))
+		},
+	},
+}
+
+func previewInstallationEmailData(locale string) emailtemplate.InstallationEmailData {
+	return emailtemplate.InstallationEmailData{
+		InstallationOneliner: `/bin/sh -c "$(curl -fsSL https://license.example.com/install/` + previewLicenseKey + `)"`,
+		PlanName:             "3 years of updates",
+		Locale:               locale,
+	}
+}
+
+var previewRenewalEmailData = emailtemplate.RenewalEmailData{
+	LicenseKey: previewLicenseKey,
+	ExpireAt:   "2026-05-29",
+}
+
+func previewExpiryReminderEmailData(expired bool) emailtemplate.ExpiryReminderEmailData {
+	return emailtemplate.ExpiryReminderEmailData{
+		LicenseKey: previewLicenseKey,
+		ExpireAt:   "2026-05-29",
+		Expired:    expired,
+		RenewURL:   "https://license.example.com/v1/stripe/checkout/renew?license_key=" + previewLicenseKey,
+	}
+}
+
+var previewEmailIndex = htmltemplate.Must(htmltemplate.New("").Parse(`<!doctype html>
+<html>
+<head>
+  <meta charset="UTF-8">
+  <title>Email previews</title>
+</head>
+<body style="font-family:sans-serif;">
+  <h1>Email previews</h1>
+  <ul>
+    {{- range $.Previews }}
+    <li>{{ .Name }}:
+      {{- $name := .Name }}
+      {{- if .Localized }}
+      {{- range $.Locales }}
+      {{ . }} (<a href="/preview/{{ $name }}?locale={{ . }}">HTML</a>, <a href="/preview/{{ $name }}?locale={{ . }}&amp;format=text">text</a>)
+      {{- end }}
+      {{- else }}
+      <a href="/preview/{{ $name }}">HTML</a>, <a href="/preview/{{ $name }}?format=text">text</a>
+      {{- end }}
+    </li>
+    {{- end }}
+  </ul>
+</body>
+</html>
+`))
+
+// newPreviewEmailHandler serves the previews of the templates in fsys.
+// The templates are parsed on every request, so that a change is shown on reload.
+func newPreviewEmailHandler(fsys fs.FS) http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("GET /{$}", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		err := previewEmailIndex.Execute(w, map[string]any{
+			"Previews": emailPreviews,
+			"Locales":  emailtemplate.SupportedLocales(),
+		})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	})
+
+	mux.HandleFunc("GET /preview/{name}", func(w http.ResponseWriter, r *http.Request) {
+		var preview *emailPreview
+		for i := range emailPreviews {
+			if emailPreviews[i].Name == r.PathValue("name") {
+				preview = &emailPreviews[i]
+			}
+		}
+		if preview == nil {
+			http.NotFound(w, r)
+			return
+		}
+
+		// Show the error in the browser, so that a broken template does not stop the server.
+		templates, err := emailtemplate.ParseFS(fsys)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		locale := r.URL.Query().Get("locale")
+		render, contentType := preview.HTML, "text/html; charset=utf-8"
+		if r.URL.Query().Get("format") == "text" {
+			render, contentType = preview.Text, "text/plain; charset=utf-8"
+		}
+
+		body, err := render(templates, locale)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", contentType)
+		_, _ = w.Write([]byte(body))
+	})
+
+	return mux
+}
+
+var (
+	previewEmailListen string
+	previewEmailDir    string
+)
+
+var previewEmailCmd = &cobra.Command{
+	Use:   "preview-email",
+	Short: "Serve the email templates with sample data for previewing in a browser",
+	Long:  "Serve the email templates with sample data for previewing in a browser. The templates are read from --dir on every request, so a change is shown on reload. Run make mjml after editing an .mjml file.",
+	Args:  cobra.NoArgs,
+	// It only needs the templates, so it runs without the configuration of the server.
+	Annotations: map[string]string{
+		annotationNoDependencies: "true",
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx := cmd.Context()
+		logger := slogging.GetLogger(ctx)
+
+		// Fail early if the directory is not the template directory.
+		_, err := emailtemplate.ParseFS(os.DirFS(previewEmailDir))
+		if err != nil {
+			return err
+		}
+
+		server := &http.Server{
+			Addr:    previewEmailListen,
+			Handler: newPreviewEmailHandler(os.DirFS(previewEmailDir)),
+			BaseContext: func(_ net.Listener) context.Context {
+				return ctx
+			},
+		}
+
+		go func() {
+			<-ctx.Done()
+			_ = server.Close()
+		}()
+
+		slogging.Info(ctx, logger, "serving email previews",
+			"url", "http://"+previewEmailListen)
+		err = server.ListenAndServe()
+		if errors.Is(err, http.ErrServerClosed) {
+			return nil
+		}
+		return err
+	},
+}
+
+func init() {
+	previewEmailCmd.Flags().StringVar(&previewEmailListen, "listen", "localhost:8201", "The address to listen on")
+	previewEmailCmd.Flags().StringVar(&previewEmailDir, "dir", "./pkg/emailtemplate", "The directory of the email templates")
+	rootCmd.AddCommand(previewEmailCmd)
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"io/fs"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestPreviewEmailHandler(t *testing.T) {
+	handler := newPreviewEmailHandler(os.DirFS("../../pkg/emailtemplate"))
+
+	tests := []struct {
+		name                string
+		path                string
+		expectedStatus      int
+		expectedContentType string
+		expectedBody        string
+	}{
+		{"index", "/", http.StatusOK, "text/html; charset=utf-8", `href="/preview/installation?locale=ja"`},
+		{"html", "/preview/installation?locale=ja", http.StatusOK, "text/html; charset=utf-8", `<html lang="ja"`},
+		{"text", "/preview/renewal?format=text", http.StatusOK, "text/plain; charset=utf-8", previewLicenseKey},
+		{"expired", "/preview/expiry_reminder_expired", http.StatusOK, "text/html; charset=utf-8", "/v1/stripe/checkout/renew"},
+		{"not found", "/preview/unknown", http.StatusNotFound, "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, httptest.NewRequest("GET", tt.path, nil))
+
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("expected status %v, got %v", tt.expectedStatus, w.Code)
+			}
+			if tt.expectedContentType != "" && w.Header().Get("Content-Type") != tt.expectedContentType {
+				t.Errorf("expected content type %v, got %v", tt.expectedContentType, w.Header().Get("Content-Type"))
+			}
+			if !strings.Contains(w.Body.String(), tt.expectedBody) {
+				t.Errorf("expected %q in %v", tt.expectedBody, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestPreviewEmailHandler_error(t *testing.T) {
+	fsys := fstest.MapFS{}
+	err := fs.WalkDir(os.DirFS("../../pkg/emailtemplate"), ".", func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		b, err := os.ReadFile("../../pkg/emailtemplate/" + path)
+		if err != nil {
+			return err
+		}
+		fsys[path] = &fstest.MapFile{Data: b}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	fsys["renewal_email.gotemplate"] = &fstest.MapFile{Data: []byte("{{ if }}")}
+
+	w := httptest.NewRecorder()
+	newPreviewEmailHandler(fsys).ServeHTTP(w, httptest.NewRequest("GET", "/preview/installation", nil))
+
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("expected status %v, got %v", http.StatusInternalServerError, w.Code)
+	}
+	if !strings.Contains(w.Body.String(), "renewal_email.gotemplate") {
+		t.Errorf("expected the template error, got %v", w.Body.String())
+	}
+}
+
+// TestPreviewEmailCmd_emptyEnvironment tests that preview-email only needs --listen and --dir,
+// and not the configuration of the server.
+func TestPreviewEmailCmd_emptyEnvironment(t *testing.T) {
+	for _, kv := range os.Environ() {
+		if k, _, _ := strings.Cut(kv, "="); strings.HasPrefix(k, "AUTHGEAR_ONCE_") {
+			t.Setenv(k, "")
+		}
+	}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	// cobra keeps the context of the last execution in the command.
+	defer previewEmailCmd.SetContext(nil)
+	defer rootCmd.SetArgs(nil)
+	done := make(chan error)
+	go func() {
+		rootCmd.SetArgs([]string{"preview-email", "--listen", addr, "--dir", "../../pkg/emailtemplate"})
+		done <- rootCmd.ExecuteContext(ctx)
+	}()
+
+	var resp *http.Response
+	for range 100 {
+		resp, err = http.Get("http://" + addr + "/preview/renewal")
+		if err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatalf("expected the previews to be served, got %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("expected status %v, got %v", http.StatusOK, resp.StatusCode)
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/stripe/stripe-go/v82"
+
+	"github.com/authgear/authgear-once-license-server/pkg/keygen"
+	"github.com/authgear/authgear-once-license-server/pkg/slogging"
+	pkgstripe "github.com/authgear/authgear-once-license-server/pkg/stripe"
+)
+
+type reconcileStatus string
+
+const (
+	// reconcileStatusOK means the checkout session has a license.
+	reconcileStatusOK reconcileStatus = "ok"
+	// reconcileStatusMissing means the checkout session has no license, and it was not issued.
+	reconcileStatusMissing reconcileStatus = "missing"
+	// reconcileStatusIssued means the missing license was issued, and the installation email was sent.
+	reconcileStatusIssued reconcileStatus = "issued"
+	// reconcileStatusSkipped means the checkout session does not issue a license.
+	reconcileStatusSkipped reconcileStatus = "skipped"
+	// reconcileStatusFailed means the checkout session could not be reconciled.
+	reconcileStatusFailed reconcileStatus = "failed"
+)
+
+type reconcileResult struct {
+	CheckoutSessionID string
+	CreatedAt         time.Time
+	CustomerEmail     string
+	Status            reconcileStatus
+	Detail            string
+}
+
+type reconcileOptions struct {
+	// Issue is true to issue the missing licenses. Otherwise, the missing licenses are only reported.
+	Issue bool
+	// Host is the public host of the server, used to construct the URL in the installation email.
+	Host string
+	// GetCheckoutSession retrieves a checkout session with its line items expanded.
+	GetCheckoutSession func(ctx context.Context, checkoutSessionID string) (*stripe.CheckoutSession, error)
+}
+
+// reconcileCheckoutSessions checks that every paid checkout session of a purchase has a license.
+func reconcileCheckoutSessions(ctx context.Context, sessions []*stripe.CheckoutSession, opts reconcileOptions) (results []reconcileResult) {
+	for _, sess := range sessions {
+		result := reconcileResult{
+			CheckoutSessionID: sess.ID,
+			CreatedAt:         time.Unix(sess.Created, 0).UTC(),
+		}
+		if sess.CustomerDetails != nil {
+			result.CustomerEmail = sess.CustomerDetails.Email
+		}
+		result.Status, result.Detail = reconcileCheckoutSession(ctx, sess, opts)
+		results = append(results, result)
+	}
+	return
+}
+
+func reconcileCheckoutSession(ctx context.Context, sess *stripe.CheckoutSession, opts reconcileOptions) (status reconcileStatus, detail string) {
+	logger := slogging.GetLogger(ctx).With("stripe_checkout_session_id", sess.ID)
+	ctx = slogging.WithLogger(ctx, logger)
+	deps := GetDependencies(ctx)
+
+	// Decide in the same way as the webhook would.
+	switch pkgstripe.GetLicenseAction(pkgstripe.NewCheckoutSessionCompletedEvent(sess)) {
+	case pkgstripe.LicenseActionIssue:
+		break
+	case pkgstripe.LicenseActionRenew:
+		return reconcileStatusSkipped, "renewal"
+	default:
+		return reconcileStatusSkipped, fmt.Sprintf("payment status is %v", sess.PaymentStatus)
+	}
+
+	license, err := deps.LicenseBackend.GetLicenseByStripeCheckoutSessionID(ctx, keygen.GetLicenseByStripeCheckoutSessionIDOptions{
+		StripeCheckoutSessionID: sess.ID,
+	})
+	switch {
+	case err == nil:
+		return reconcileStatusOK, license.ID
+	case errors.Is(err, keygen.ErrLicenseKeyNotFound):
+		break
+	default:
+		return reconcileStatusFailed, err.Error()
+	}
+
+	if !opts.Issue {
+		return reconcileStatusMissing, ""
+	}
+
+	// The listed checkout session does not have its line items, which tell the plan.
+	fullSess, err := opts.GetCheckoutSession(ctx, sess.ID)
+	if err != nil {
+		return reconcileStatusFailed, err.Error()
+	}
+
+	r := (&http.Request{
+		Method: "POST",
+		URL:    &url.URL{Path: "/v1/stripe/webhook"},
+		Host:   opts.Host,
+		Header: http.Header{},
+	}).WithContext(ctx)
+	w := &jobResponseWriter{header: http.Header{}}
+
+	handleLicenseIssuance(w, r, pkgstripe.NewCheckoutSessionCompletedEvent(fullSess))
+
+	if w.statusCode >= 400 {
+		return reconcileStatusFailed, strings.TrimSpace(w.body.String())
+	}
+	slogging.Info(ctx, logger, "issued missing license")
+	return reconcileStatusIssued, ""
+}
+
+// parseReconcileTime parses a date, or a date and time in RFC 3339.
+func parseReconcileTime(s string) (time.Time, error) {
+	if t, err := time.Parse(time.DateOnly, s); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, s)
+}
+
+var (
+	reconcileFrom  string
+	reconcileTo    string
+	reconcileIssue bool
+	reconcileHost  string
+)
+
+var reconcileCmd = &cobra.Command{
+	Use:   "reconcile",
+	Short: "Check that every paid checkout session has a license, and optionally issue the missing ones",
+	Long:  "Check that every paid checkout session has a license. Without --issue, it only reports the missing licenses.",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx := cmd.Context()
+		deps := GetDependencies(ctx)
+
+		from, err := parseReconcileTime(reconcileFrom)
+		if err != nil {
+			return fmt.Errorf("invalid --from: %w", err)
+		}
+		to := time.Now()
+		if reconcileTo != "" {
+			to, err = parseReconcileTime(reconcileTo)
+			if err != nil {
+				return fmt.Errorf("invalid --to: %w", err)
+			}
+		}
+		if reconcileIssue && reconcileHost == "" {
+			return errors.New("--host is required with --issue")
+		}
+
+		sessions, err := pkgstripe.ListCompletedCheckoutSessions(ctx, deps.StripeClient, pkgstripe.ListCompletedCheckoutSessionsOptions{
+			MarkerValue: deps.StripeCheckoutSessionMetadataMarkerValue,
+			CreatedFrom: from,
+			CreatedTo:   to,
+		})
+		if err != nil {
+			return err
+		}
+
+		results := reconcileCheckoutSessions(ctx, sessions, reconcileOptions{
+			Issue: reconcileIssue,
+			Host:  reconcileHost,
+			GetCheckoutSession: func(ctx context.Context, checkoutSessionID string) (*stripe.CheckoutSession, error) {
+				return pkgstripe.GetCheckoutSession(ctx, deps.StripeClient, checkoutSessionID)
+			},
+		})
+
+		counts := map[reconcileStatus]int{}
+		tw := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "CHECKOUT SESSION\tCREATED AT\tCUSTOMER EMAIL\tSTATUS\tDETAIL")
+		for _, result := range results {
+			counts[result.Status]++
+			fmt.Fprintf(tw, "%v\t%v\t%v\t%v\t%v\n",
+				result.CheckoutSessionID, result.CreatedAt.Format(time.RFC3339), result.CustomerEmail, result.Status, result.Detail)
+		}
+		err = tw.Flush()
+		if err != nil {
+			return err
+		}
+
+		mode := "dry run"
+		if reconcileIssue {
+			mode = "issue"
+		}
+		fmt.Fprintf(cmd.OutOrStdout(), "\n%v: %v checkout sessions, %v ok, %v missing, %v issued, %v skipped, %v failed\n",
+			mode,
+			len(results),
+			counts[reconcileStatusOK],
+			counts[reconcileStatusMissing],
+			counts[reconcileStatusIssued],
+			counts[reconcileStatusSkipped],
+			counts[reconcileStatusFailed],
+		)
+
+		if counts[reconcileStatusFailed] > 0 {
+			return fmt.Errorf("%v checkout sessions failed to reconcile", counts[reconcileStatusFailed])
+		}
+		return nil
+	},
+}
+
+func init() {
+	reconcileCmd.Flags().StringVar(&reconcileFrom, "from", "", "The start of the period of checkout sessions, inclusive, in YYYY-MM-DD or RFC 3339")
+	reconcileCmd.Flags().StringVar(&reconcileTo, "to", "", "The end of the period of checkout sessions, exclusive, in YYYY-MM-DD or RFC 3339. Default is now")
+	reconcileCmd.Flags().BoolVar(&reconcileIssue, "issue", false, "Issue the missing licenses and send the installation emails")
+	reconcileCmd.Flags().StringVar(&reconcileHost, "host", "", "The public host of this server, used in the installation emails. Required with --issue")
+	_ = reconcileCmd.MarkFlagRequired("from")
+	rootCmd.AddCommand(reconcileCmd)
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/stripe/stripe-go/v82"
+
+	"github.com/authgear/authgear-once-license-server/pkg/catalog"
+	"github.com/authgear/authgear-once-license-server/pkg/keygen"
+	pkgstripe "github.com/authgear/authgear-once-license-server/pkg/stripe"
+)
+
+func newTestCheckoutSession(id string, paymentStatus stripe.CheckoutSessionPaymentStatus, metadata map[string]string) *stripe.CheckoutSession {
+	m := map[string]string{pkgstripe.MetadataKeyMarker: "marker"}
+	for k, v := range metadata {
+		m[k] = v
+	}
+	return &stripe.CheckoutSession{
+		ID:              id,
+		Created:         1746057600,
+		Customer:        &stripe.Customer{ID: "cus_" + id},
+		CustomerDetails: &stripe.CheckoutSessionCustomerDetails{Email: id + "@example.com"},
+		PaymentStatus:   paymentStatus,
+		Metadata:        m,
+	}
+}
+
+func TestReconcileCheckoutSessions(t *testing.T) {
+	sessions := []*stripe.CheckoutSession{
+		newTestCheckoutSession("cs_ok", stripe.CheckoutSessionPaymentStatusPaid, nil),
+		newTestCheckoutSession("cs_missing", stripe.CheckoutSessionPaymentStatusPaid, nil),
+		newTestCheckoutSession("cs_free", stripe.CheckoutSessionPaymentStatusNoPaymentRequired, nil),
+		newTestCheckoutSession("cs_unpaid", stripe.CheckoutSessionPaymentStatusUnpaid, nil),
+		newTestCheckoutSession("cs_renew", stripe.CheckoutSessionPaymentStatusPaid, map[string]string{
+			pkgstripe.MetadataKeyRenewLicenseID: "license-1",
+		}),
+	}
+	getCheckoutSession := func(ctx context.Context, checkoutSessionID string) (*stripe.CheckoutSession, error) {
+		for _, sess := range sessions {
+			if sess.ID == checkoutSessionID {
+				full := *sess
+				full.LineItems = &stripe.LineItemList{
+					Data: []*stripe.LineItem{{Price: &stripe.Price{ID: "price_1"}}},
+				}
+				return &full, nil
+			}
+		}
+		return nil, &stripe.Error{Code: stripe.ErrorCodeResourceMissing}
+	}
+
+	tests := []struct {
+		name               string
+		issue              bool
+		expectedStatuses   []reconcileStatus
+		expectedRecipients []string
+	}{
+		{
+			name: "dry run",
+			expectedStatuses: []reconcileStatus{
+				reconcileStatusOK,
+				reconcileStatusMissing,
+				reconcileStatusMissing,
+				reconcileStatusSkipped,
+				reconcileStatusSkipped,
+			},
+		},
+		{
+			name:  "issue",
+			issue: true,
+			expectedStatuses: []reconcileStatus{
+				reconcileStatusOK,
+				reconcileStatusIssued,
+				reconcileStatusIssued,
+				reconcileStatusSkipped,
+				reconcileStatusSkipped,
+			},
+			expectedRecipients: []string{"cs_missing@example.com", "cs_free@example.com"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backend := newFakeLicenseBackend(&fakeLicense{
+				ID:                      "license-1",
+				Key:                     "KEY-1",
+				StripeCheckoutSessionID: "cs_ok",
+			})
+			emailMailer := &fakeMailer{}
+			ctx := context.WithValue(context.Background(), dependenciesKey, Dependencies{
+				LicenseBackend: backend,
+				Mailer:         emailMailer,
+				MailSender:     "noreply@example.com",
+				Catalog: &catalog.Catalog{
+					Plans: []catalog.Plan{{ID: "default", StripePriceID: "price_1", KeygenPolicyID: "policy-1"}},
+				},
+			})
+
+			results := reconcileCheckoutSessions(ctx, sessions, reconcileOptions{
+				Issue:              tt.issue,
+				Host:               "license.example.com",
+				GetCheckoutSession: getCheckoutSession,
+			})
+
+			var statuses []reconcileStatus
+			for _, result := range results {
+				statuses = append(statuses, result.Status)
+			}
+			if !slices.Equal(statuses, tt.expectedStatuses) {
+				t.Errorf("expected statuses %v, got %v (%+v)", tt.expectedStatuses, statuses, results)
+			}
+			if results[0].Detail != "license-1" || results[0].CustomerEmail != "cs_ok@example.com" {
+				t.Errorf("unexpected result %+v", results[0])
+			}
+
+			if got := emailMailer.Recipients(); !slices.Equal(got, tt.expectedRecipients) {
+				t.Errorf("expected recipients %v, got %v", tt.expectedRecipients, got)
+			}
+			for _, id := range []string{"cs_missing", "cs_free"} {
+				_, err := backend.GetLicenseByStripeCheckoutSessionID(ctx, keygen.GetLicenseByStripeCheckoutSessionIDOptions{
+					StripeCheckoutSessionID: id,
+				})
+				if issued := err == nil; issued != tt.issue {
+					t.Errorf("%v: expected issued %v, got %v", id, tt.issue, issued)
+				}
+			}
+		})
+	}
+}
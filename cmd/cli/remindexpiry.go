@@ -0,0 +1,314 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/authgear/authgear-once-license-server/pkg/catalog"
+	"github.com/authgear/authgear-once-license-server/pkg/emailtemplate"
+	"github.com/authgear/authgear-once-license-server/pkg/expiryreminder"
+	"github.com/authgear/authgear-once-license-server/pkg/keygen"
+	"github.com/authgear/authgear-once-license-server/pkg/mailer"
+	"github.com/authgear/authgear-once-license-server/pkg/slogging"
+	pkgstripe "github.com/authgear/authgear-once-license-server/pkg/stripe"
+)
+
+var errExpiryReminderStoreNotConfigured = errors.New("AUTHGEAR_ONCE_EXPIRY_REMINDER_LOG_FILE must be set")
+
+// remindExpiredWithin is how long after expiry a license is still reminded.
+// It lets a reminder be sent when the command was not run on the day of expiry,
+// without reminding every license that expired long ago on the first run.
+const remindExpiredWithin = 7 * 24 * time.Hour
+
+type expiryReminderStatus string
+
+const (
+	// expiryReminderStatusSent means the reminder was sent and recorded.
+	expiryReminderStatusSent expiryReminderStatus = "sent"
+	// expiryReminderStatusDue means the reminder is due, but it was not sent in a dry run.
+	expiryReminderStatusDue expiryReminderStatus = "due"
+	// expiryReminderStatusSkipped means the reminder is due, but the license has no email to send to.
+	expiryReminderStatusSkipped expiryReminderStatus = "skipped"
+	// expiryReminderStatusFailed means the reminder could not be sent or recorded.
+	expiryReminderStatusFailed expiryReminderStatus = "failed"
+)
+
+type expiryReminderResult struct {
+	LicenseID  string
+	Expiry     time.Time
+	WindowDays int
+	Email      string
+	Status     expiryReminderStatus
+	Detail     string
+}
+
+type remindExpiryOptions struct {
+	// WindowDays are the reminder windows, in days before expiry.
+	WindowDays []int
+	Now        time.Time
+	// DryRun is true to report the due reminders without sending them.
+	DryRun bool
+	// Host is the public host of the server, used to construct the renewal URL.
+	Host string
+	// GetCustomerEmail returns the email of a Stripe customer.
+	// It is for licenses issued before the licensee email was stored.
+	GetCustomerEmail func(ctx context.Context, customerID string) (string, error)
+}
+
+// expiryReminderWindow returns the smallest window that expiry is within at now.
+// It returns false if expiry is in none of the windows, or expiry has passed for more than remindExpiredWithin.
+func expiryReminderWindow(windowDays []int, expiry time.Time, now time.Time) (days int, ok bool) {
+	if now.Sub(expiry) > remindExpiredWithin {
+		return
+	}
+	for _, w := range windowDays {
+		if expiry.Sub(now) > time.Duration(w)*24*time.Hour {
+			continue
+		}
+		if !ok || w < days {
+			days = w
+			ok = true
+		}
+	}
+	return
+}
+
+// remindExpiry sends a reminder for each license that has entered a reminder window,
+// unless the reminder has been sent before.
+// Licenses that are suspended, not activated, not in any window, or reminded already are not reported.
+func remindExpiry(ctx context.Context, licenses []keygen.License, opts remindExpiryOptions) (results []expiryReminderResult) {
+	for _, license := range licenses {
+		if license.Suspended || license.Expiry == nil {
+			continue
+		}
+		expiry := license.Expiry.UTC()
+
+		windowDays, ok := expiryReminderWindow(opts.WindowDays, expiry, opts.Now)
+		if !ok {
+			continue
+		}
+
+		existing, err := GetDependencies(ctx).ExpiryReminderStore.Get(ctx, expiryreminder.Key(license.ID, expiry, windowDays))
+		switch {
+		case err != nil:
+			results = append(results, expiryReminderResult{
+				LicenseID:  license.ID,
+				Expiry:     expiry,
+				WindowDays: windowDays,
+				Status:     expiryReminderStatusFailed,
+				Detail:     err.Error(),
+			})
+		case existing != nil:
+			// The reminder has been sent.
+			continue
+		default:
+			results = append(results, remindLicenseExpiry(ctx, license, windowDays, opts))
+		}
+	}
+	return
+}
+
+func remindLicenseExpiry(ctx context.Context, license keygen.License, windowDays int, opts remindExpiryOptions) (result expiryReminderResult) {
+	logger := slogging.GetLogger(ctx).With(
+		"keygen_license_id", license.ID,
+		"window_days", windowDays,
+	)
+	deps := GetDependencies(ctx)
+
+	expiry := license.Expiry.UTC()
+	result = expiryReminderResult{
+		LicenseID:  license.ID,
+		Expiry:     expiry,
+		WindowDays: windowDays,
+	}
+
+	var err error
+	email := license.Metadata.LicenseeEmail
+	if email == "" && license.Metadata.StripeCustomerID != "" {
+		email, err = opts.GetCustomerEmail(ctx, license.Metadata.StripeCustomerID)
+		if err != nil {
+			result.Status, result.Detail = expiryReminderStatusFailed, err.Error()
+			return
+		}
+	}
+	if email == "" {
+		result.Status, result.Detail = expiryReminderStatusSkipped, "no email"
+		return
+	}
+	result.Email = email
+
+	if opts.DryRun {
+		result.Status = expiryReminderStatusDue
+		return
+	}
+
+	r := (&http.Request{
+		URL: &url.URL{
+			Path:     "/v1/stripe/checkout/renew",
+			RawQuery: url.Values{"license_key": {license.Key}}.Encode(),
+		},
+		Host: opts.Host,
+	}).WithContext(ctx)
+
+	expired := !expiry.After(opts.Now)
+	expireAt := expiry.Format(time.DateOnly)
+	emailData := emailtemplate.ExpiryReminderEmailData{
+		LicenseKey: license.Key,
+		ExpireAt:   expireAt,
+		Expired:    expired,
+		RenewURL:   ConstructFullURL(r).String(),
+	}
+	subject := fmt.Sprintf("Your Authgear ONCE license expires on %v", expireAt)
+	if expired {
+		subject = "Your Authgear ONCE license has expired"
+	}
+
+	err = deps.Mailer.SendEmail(ctx, mailer.EmailOptions{
+		Sender:   deps.MailSender,
+		Subject:  subject,
+		HTMLBody: emailtemplate.RenderExpiryReminderEmail(emailData),
+		TextBody: emailtemplate.RenderExpiryReminderEmailText(emailData),
+		To:       email,
+	})
+	if err != nil {
+		slogging.Error(ctx, logger, "failed to send expiry reminder",
+			"error", err)
+		result.Status, result.Detail = expiryReminderStatusFailed, err.Error()
+		return
+	}
+
+	err = deps.ExpiryReminderStore.Put(ctx, expiryreminder.Reminder{
+		LicenseID:  license.ID,
+		Expiry:     expiry,
+		WindowDays: windowDays,
+		Email:      email,
+		SentAt:     opts.Now.UTC(),
+	})
+	if err != nil {
+		// The reminder will be sent again on the next run.
+		slogging.Error(ctx, logger, "failed to record expiry reminder",
+			"error", err)
+		result.Status, result.Detail = expiryReminderStatusFailed, fmt.Sprintf("sent but not recorded: %v", err)
+		return
+	}
+
+	slogging.Info(ctx, logger, "sent expiry reminder")
+	result.Status = expiryReminderStatusSent
+	return
+}
+
+// expiryReminderPolicyIDs returns the distinct Keygen policies of plans.
+// A plan without a policy is an error, because listing the licenses of an empty policy lists the licenses of every policy.
+func expiryReminderPolicyIDs(plans []catalog.Plan) (policyIDs []string, err error) {
+	for _, plan := range plans {
+		if plan.KeygenPolicyID == "" {
+			err = fmt.Errorf("plan %q has no keygen_policy_id", plan.ID)
+			return
+		}
+		if !slices.Contains(policyIDs, plan.KeygenPolicyID) {
+			policyIDs = append(policyIDs, plan.KeygenPolicyID)
+		}
+	}
+	return
+}
+
+var (
+	remindExpiryWindowDays []int
+	remindExpiryDryRun     bool
+	remindExpiryHost       string
+)
+
+var remindExpiryCmd = &cobra.Command{
+	Use:   "remind-expiry",
+	Short: "Send reminder emails for licenses that are about to expire",
+	Long:  "Send reminder emails for licenses that are about to expire. Run it daily, for example, from cron. A reminder is sent once for each window.",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx := cmd.Context()
+		deps := GetDependencies(ctx)
+
+		if deps.ExpiryReminderStore == nil {
+			return errExpiryReminderStoreNotConfigured
+		}
+		for _, w := range remindExpiryWindowDays {
+			if w < 0 {
+				return fmt.Errorf("invalid --windows: %v is negative", w)
+			}
+		}
+		if !remindExpiryDryRun && remindExpiryHost == "" {
+			return errors.New("--host is required unless --dry-run")
+		}
+
+		// The licenses of every plan.
+		policyIDs, err := expiryReminderPolicyIDs(deps.Catalog.Plans)
+		if err != nil {
+			return err
+		}
+		var licenses []keygen.License
+		for _, policyID := range policyIDs {
+			page, err := deps.KeygenClient.ListLicenses(ctx, keygen.ListLicensesOptions{
+				PolicyID: policyID,
+			})
+			if err != nil {
+				return err
+			}
+			licenses = append(licenses, page...)
+		}
+
+		results := remindExpiry(ctx, licenses, remindExpiryOptions{
+			WindowDays: remindExpiryWindowDays,
+			Now:        time.Now(),
+			DryRun:     remindExpiryDryRun,
+			Host:       remindExpiryHost,
+			GetCustomerEmail: func(ctx context.Context, customerID string) (string, error) {
+				customer, err := pkgstripe.GetCustomer(ctx, deps.StripeClient, customerID)
+				if err != nil {
+					return "", err
+				}
+				return customer.Email, nil
+			},
+		})
+
+		counts := map[expiryReminderStatus]int{}
+		tw := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "LICENSE\tEXPIRY\tWINDOW\tEMAIL\tSTATUS\tDETAIL")
+		for _, result := range results {
+			counts[result.Status]++
+			fmt.Fprintf(tw, "%v\t%v\t%vd\t%v\t%v\t%v\n",
+				result.LicenseID, result.Expiry.Format(time.RFC3339), result.WindowDays, result.Email, result.Status, result.Detail)
+		}
+		err = tw.Flush()
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintf(cmd.OutOrStdout(), "\n%v licenses, %v reminders: %v sent, %v due, %v skipped, %v failed\n",
+			len(licenses),
+			len(results),
+			counts[expiryReminderStatusSent],
+			counts[expiryReminderStatusDue],
+			counts[expiryReminderStatusSkipped],
+			counts[expiryReminderStatusFailed],
+		)
+
+		if counts[expiryReminderStatusFailed] > 0 {
+			return fmt.Errorf("%v reminders failed", counts[expiryReminderStatusFailed])
+		}
+		return nil
+	},
+}
+
+func init() {
+	remindExpiryCmd.Flags().IntSliceVar(&remindExpiryWindowDays, "windows", []int{30, 7, 0}, "The reminder windows, in days before expiry. 0 reminds when the license has expired")
+	remindExpiryCmd.Flags().BoolVar(&remindExpiryDryRun, "dry-run", false, "Report the due reminders without sending them")
+	remindExpiryCmd.Flags().StringVar(&remindExpiryHost, "host", "", "The public host of this server, used in the renewal links. Required unless --dry-run")
+	rootCmd.AddCommand(remindExpiryCmd)
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/authgear/authgear-once-license-server/pkg/catalog"
+	"github.com/authgear/authgear-once-license-server/pkg/expiryreminder"
+	"github.com/authgear/authgear-once-license-server/pkg/keygen"
+)
+
+func TestExpiryReminderWindow(t *testing.T) {
+	now := time.Date(2025, 5, 1, 0, 0, 0, 0, time.UTC)
+	windowDays := []int{30, 7, 0}
+
+	tests := []struct {
+		name         string
+		expiry       time.Time
+		expectedDays int
+		expectedOK   bool
+	}{
+		{"not yet", now.AddDate(0, 0, 31), 0, false},
+		{"30 days", now.AddDate(0, 0, 30), 30, true},
+		{"8 days", now.AddDate(0, 0, 8), 30, true},
+		{"7 days", now.AddDate(0, 0, 7), 7, true},
+		{"1 hour", now.Add(time.Hour), 7, true},
+		{"expiring now", now, 0, true},
+		{"expired recently", now.AddDate(0, 0, -3), 0, true},
+		{"expired long ago", now.AddDate(0, 0, -8), 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			days, ok := expiryReminderWindow(windowDays, tt.expiry, now)
+			if days != tt.expectedDays || ok != tt.expectedOK {
+				t.Errorf("expected (%v, %v), got (%v, %v)", tt.expectedDays, tt.expectedOK, days, ok)
+			}
+		})
+	}
+}
+
+func TestExpiryReminderPolicyIDs(t *testing.T) {
+	tests := []struct {
+		name        string
+		plans       []catalog.Plan
+		expected    []string
+		expectedErr string
+	}{
+		{
+			name: "distinct policies",
+			plans: []catalog.Plan{
+				{ID: "1y", KeygenPolicyID: "policy-1"},
+				{ID: "1y-discount", KeygenPolicyID: "policy-1"},
+				{ID: "3y", KeygenPolicyID: "policy-3"},
+			},
+			expected: []string{"policy-1", "policy-3"},
+		},
+		{
+			name: "plan without policy",
+			plans: []catalog.Plan{
+				{ID: "1y", KeygenPolicyID: "policy-1"},
+				{ID: "3y"},
+			},
+			expectedErr: `plan "3y" has no keygen_policy_id`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policyIDs, err := expiryReminderPolicyIDs(tt.plans)
+			if tt.expectedErr != "" {
+				if err == nil || err.Error() != tt.expectedErr {
+					t.Errorf("expected error %v, got %v", tt.expectedErr, err)
+				}
+				return
+			}
+			if err != nil || !slices.Equal(policyIDs, tt.expected) {
+				t.Errorf("expected %v, got %v, %v", tt.expected, policyIDs, err)
+			}
+		})
+	}
+}
+
+func TestRemindExpiry(t *testing.T) {
+	now := time.Date(2025, 5, 1, 0, 0, 0, 0, time.UTC)
+	at := func(days int) *time.Time {
+		t := now.AddDate(0, 0, days)
+		return &t
+	}
+
+	licenses := []keygen.License{
+		{ID: "license-30d", Key: "KEY-30D", Expiry: at(20), Metadata: keygen.LicenseMetadata{LicenseeEmail: "30d@example.com"}},
+		{ID: "license-7d", Key: "KEY-7D", Expiry: at(5), Metadata: keygen.LicenseMetadata{LicenseeEmail: "7d@example.com"}},
+		{ID: "license-expired", Key: "KEY-EXPIRED", Expiry: at(-1), Metadata: keygen.LicenseMetadata{StripeCustomerID: "cus_1"}},
+		{ID: "license-no-email", Key: "KEY-NO-EMAIL", Expiry: at(5)},
+		{ID: "license-later", Key: "KEY-LATER", Expiry: at(60), Metadata: keygen.LicenseMetadata{LicenseeEmail: "later@example.com"}},
+		{ID: "license-not-activated", Key: "KEY-NOT-ACTIVATED", Metadata: keygen.LicenseMetadata{LicenseeEmail: "new@example.com"}},
+		{ID: "license-suspended", Key: "KEY-SUSPENDED", Expiry: at(5), Suspended: true, Metadata: keygen.LicenseMetadata{LicenseeEmail: "suspended@example.com"}},
+	}
+
+	emailMailer := &fakeMailer{}
+	ctx := context.WithValue(context.Background(), dependenciesKey, Dependencies{
+		Mailer:              emailMailer,
+		MailSender:          "noreply@example.com",
+		ExpiryReminderStore: expiryreminder.NewFileStore(filepath.Join(t.TempDir(), "reminders.json")),
+	})
+	opts := remindExpiryOptions{
+		WindowDays: []int{30, 7, 0},
+		Now:        now,
+		Host:       "license.example.com",
+		GetCustomerEmail: func(ctx context.Context, customerID string) (string, error) {
+			return customerID + "@example.com", nil
+		},
+	}
+
+	summarize := func(results []expiryReminderResult) (summary []string) {
+		for _, r := range results {
+			summary = append(summary, strings.Join([]string{r.LicenseID, string(r.Status)}, ":"))
+		}
+		return
+	}
+
+	// A dry run does not send nor record.
+	dryRunOpts := opts
+	dryRunOpts.DryRun = true
+	results := remindExpiry(ctx, licenses, dryRunOpts)
+	expected := []string{"license-30d:due", "license-7d:due", "license-expired:due", "license-no-email:skipped"}
+	if got := summarize(results); !slices.Equal(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+	if got := emailMailer.Recipients(); len(got) != 0 {
+		t.Errorf("expected no emails, got %v", got)
+	}
+
+	results = remindExpiry(ctx, licenses, opts)
+	expected = []string{"license-30d:sent", "license-7d:sent", "license-expired:sent", "license-no-email:skipped"}
+	if got := summarize(results); !slices.Equal(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+	expectedRecipients := []string{"30d@example.com", "7d@example.com", "cus_1@example.com"}
+	if got := emailMailer.Recipients(); !slices.Equal(got, expectedRecipients) {
+		t.Errorf("expected recipients %v, got %v", expectedRecipients, got)
+	}
+	if subject := emailMailer.emails[2].Subject; subject != "Your Authgear ONCE license has expired" {
+		t.Errorf("unexpected subject %q", subject)
+	}
+	if body := emailMailer.emails[0].TextBody; !strings.Contains(body, "https://license.example.com/v1/stripe/checkout/renew?license_key=KEY-30D") {
+		t.Errorf("expected renewal URL in %v", body)
+	}
+
+	// The reminders are not sent again.
+	results = remindExpiry(ctx, licenses, opts)
+	expected = []string{"license-no-email:skipped"}
+	if got := summarize(results); !slices.Equal(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+
+	// The reminder of the next window is sent.
+	// The other licenses have expired for too long to be reminded.
+	opts.Now = now.AddDate(0, 0, 14)
+	results = remindExpiry(ctx, licenses, opts)
+	expected = []string{"license-30d:sent"}
+	if got := summarize(results); !slices.Equal(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+	if windowDays := results[0].WindowDays; windowDays != 7 {
+		t.Errorf("expected window 7, got %v", windowDays)
+	}
+}
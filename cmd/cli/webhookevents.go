@@ -0,0 +1,202 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/authgear/authgear-once-license-server/pkg/slogging"
+	pkgstripe "github.com/authgear/authgear-once-license-server/pkg/stripe"
+	"github.com/authgear/authgear-once-license-server/pkg/webhookevent"
+)
+
+var errWebhookEventStoreNotConfigured = errors.New("AUTHGEAR_ONCE_WEBHOOK_EVENT_LOG_FILE must be set")
+
+// webhookEventRecorder captures the outcome of handling a webhook event.
+type webhookEventRecorder struct {
+	http.ResponseWriter
+	statusCode   int
+	errorMessage strings.Builder
+	outcome      webhookevent.Outcome
+	licenseID    string
+}
+
+func (r *webhookEventRecorder) WriteHeader(statusCode int) {
+	r.statusCode = statusCode
+	r.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (r *webhookEventRecorder) Write(b []byte) (int, error) {
+	if r.statusCode >= 400 {
+		r.errorMessage.Write(b)
+	}
+	return r.ResponseWriter.Write(b)
+}
+
+func (r *webhookEventRecorder) Outcome() webhookevent.Outcome {
+	switch {
+	case r.statusCode >= 400:
+		return webhookevent.OutcomeFailed
+	case r.outcome != "":
+		return r.outcome
+	default:
+		return webhookevent.OutcomeSucceeded
+	}
+}
+
+// setWebhookEventLicenseID records the license the webhook event acts on.
+func setWebhookEventLicenseID(w http.ResponseWriter, licenseID string) {
+	if r, ok := w.(*webhookEventRecorder); ok {
+		r.licenseID = licenseID
+	}
+}
+
+func setWebhookEventOutcome(w http.ResponseWriter, outcome webhookevent.Outcome) {
+	if r, ok := w.(*webhookEventRecorder); ok {
+		r.outcome = outcome
+	}
+}
+
+// processWebhookEvent handles the event unless it has been handled before, and records the outcome.
+// A failure of the store is logged only, so that it never blocks the handling of payments.
+func processWebhookEvent(w http.ResponseWriter, r *http.Request, e *pkgstripe.Event) {
+	ctx := r.Context()
+	logger := slogging.GetLogger(ctx)
+	deps := GetDependencies(ctx)
+
+	store := deps.WebhookEventStore
+	if store == nil {
+		handleWebhookEvent(w, r, e)
+		return
+	}
+
+	now := time.Now().UTC()
+	record := webhookevent.Event{
+		ID:                e.ID,
+		Type:              string(e.Type),
+		CheckoutSessionID: e.CheckoutSession.ID,
+		ReceivedAt:        now,
+	}
+
+	// Claim the event before handling it, so that a concurrent delivery of the same event is not handled twice.
+	claimed, err := store.Start(ctx, record)
+	switch {
+	case errors.Is(err, webhookevent.ErrEventProcessed):
+		// Return 200 so that Stripe stops delivering it.
+		slogging.Info(ctx, logger, "ignore event that was processed")
+		return
+	case errors.Is(err, webhookevent.ErrEventProcessing):
+		// Stripe delivers it again later, when the outcome of the other delivery is known.
+		slogging.Info(ctx, logger, "ignore event that is being processed")
+		http.Error(w, "event is being processed", http.StatusConflict)
+		return
+	case err != nil:
+		slogging.Error(ctx, logger, "failed to write webhook event log",
+			"error", err)
+	default:
+		record = *claimed
+	}
+
+	rec := &webhookEventRecorder{ResponseWriter: w}
+	handleWebhookEvent(rec, r, e)
+
+	record.Outcome = rec.Outcome()
+	record.Error = ""
+	if record.Outcome == webhookevent.OutcomeFailed {
+		record.Error = strings.TrimSpace(rec.errorMessage.String())
+	}
+	if rec.licenseID != "" {
+		record.LicenseID = rec.licenseID
+	}
+	record.Attempts++
+	record.ProcessedAt = time.Now().UTC()
+	record.ProcessingStartedAt = nil
+
+	err = store.Put(ctx, record)
+	if err != nil {
+		slogging.Error(ctx, logger, "failed to write webhook event log",
+			"error", err)
+	}
+}
+
+var (
+	webhookEventsListCheckoutSessionID string
+	webhookEventsListOutcome           string
+	webhookEventsListLimit             int
+)
+
+var webhookEventsCmd = &cobra.Command{
+	Use:   "webhook-events",
+	Short: "Inspect the Stripe webhook events handled by the server",
+}
+
+var webhookEventsListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List webhook events, the most recently received first",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx := cmd.Context()
+		store := GetDependencies(ctx).WebhookEventStore
+		if store == nil {
+			return errWebhookEventStoreNotConfigured
+		}
+
+		events, err := store.List(ctx, webhookevent.ListOptions{
+			CheckoutSessionID: webhookEventsListCheckoutSessionID,
+			Outcome:           webhookevent.Outcome(webhookEventsListOutcome),
+			Limit:             webhookEventsListLimit,
+		})
+		if err != nil {
+			return err
+		}
+
+		tw := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "ID\tTYPE\tCHECKOUT SESSION\tLICENSE\tOUTCOME\tATTEMPTS\tRECEIVED AT")
+		for _, e := range events {
+			fmt.Fprintf(tw, "%v\t%v\t%v\t%v\t%v\t%v\t%v\n",
+				e.ID, e.Type, e.CheckoutSessionID, e.LicenseID, e.Outcome, e.Attempts, e.ReceivedAt.Format(time.RFC3339))
+		}
+		return tw.Flush()
+	},
+}
+
+var webhookEventsGetCmd = &cobra.Command{
+	Use:   "get EVENT_ID",
+	Short: "Show a webhook event",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx := cmd.Context()
+		store := GetDependencies(ctx).WebhookEventStore
+		if store == nil {
+			return errWebhookEventStoreNotConfigured
+		}
+
+		e, err := store.Get(ctx, args[0])
+		if err != nil {
+			return err
+		}
+		if e == nil {
+			return fmt.Errorf("webhook event not found: %v", args[0])
+		}
+
+		encoder := json.NewEncoder(cmd.OutOrStdout())
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(e)
+	},
+}
+
+func init() {
+	webhookEventsListCmd.Flags().StringVar(&webhookEventsListCheckoutSessionID, "checkout-session", "", "Only list events of the Stripe checkout session")
+	webhookEventsListCmd.Flags().StringVar(&webhookEventsListOutcome, "outcome", "", "Only list events of the outcome: succeeded, ignored, failed or processing")
+	webhookEventsListCmd.Flags().IntVar(&webhookEventsListLimit, "limit", 50, "The maximum number of events to list, 0 means unlimited")
+
+	webhookEventsCmd.AddCommand(webhookEventsListCmd)
+	webhookEventsCmd.AddCommand(webhookEventsGetCmd)
+	rootCmd.AddCommand(webhookEventsCmd)
+}
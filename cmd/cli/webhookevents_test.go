@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/stripe/stripe-go/v82"
+
+	"github.com/authgear/authgear-once-license-server/pkg/keygen"
+	pkgstripe "github.com/authgear/authgear-once-license-server/pkg/stripe"
+	"github.com/authgear/authgear-once-license-server/pkg/webhookevent"
+)
+
+// flakyLicenseBackend fails some calls of fakeLicenseBackend, to test retries of webhook events.
+type flakyLicenseBackend struct {
+	*fakeLicenseBackend
+	// failures is the number of the next calls to SuspendLicense that fail.
+	failures int
+	// failUpdateLicenseMetadata is the number of the next calls to UpdateLicenseMetadata that fail.
+	failUpdateLicenseMetadata int
+	// failRenewLicense is the number of the next calls to RenewLicense that renew the license but then fail,
+	// as if the response was lost.
+	failRenewLicense int
+}
+
+func (b *flakyLicenseBackend) SuspendLicense(ctx context.Context, opts keygen.LicenseActionOptions) (err error) {
+	if b.failures > 0 {
+		b.failures--
+		return errors.New("keygen is down")
+	}
+	return b.fakeLicenseBackend.SuspendLicense(ctx, opts)
+}
+
+func (b *flakyLicenseBackend) UpdateLicenseMetadata(ctx context.Context, opts keygen.UpdateLicenseMetadataOptions) (license *keygen.License, err error) {
+	if b.failUpdateLicenseMetadata > 0 {
+		b.failUpdateLicenseMetadata--
+		err = keygen.ErrServiceUnavailable
+		return
+	}
+	return b.fakeLicenseBackend.UpdateLicenseMetadata(ctx, opts)
+}
+
+func (b *flakyLicenseBackend) RenewLicense(ctx context.Context, opts keygen.LicenseActionOptions) (license *keygen.License, err error) {
+	license, err = b.fakeLicenseBackend.RenewLicense(ctx, opts)
+	if err == nil && b.failRenewLicense > 0 {
+		b.failRenewLicense--
+		license = nil
+		err = keygen.ErrServiceUnavailable
+	}
+	return
+}
+
+func newRefundEvent(id string, refunded bool) *pkgstripe.Event {
+	return &pkgstripe.Event{
+		Event: &stripe.Event{
+			ID:   id,
+			Type: stripe.EventTypeChargeRefunded,
+			Data: &stripe.EventData{
+				Object: map[string]any{"object": "charge", "refunded": refunded},
+			},
+		},
+		CheckoutSession: &stripe.CheckoutSession{ID: "cs_1"},
+	}
+}
+
+func TestProcessWebhookEvent(t *testing.T) {
+	backend := &flakyLicenseBackend{
+		fakeLicenseBackend: newFakeLicenseBackend(&fakeLicense{
+			ID:                      "license-1",
+			Key:                     "KEY-1",
+			StripeCheckoutSessionID: "cs_1",
+		}),
+		failures: 1,
+	}
+	store := webhookevent.NewFileStore(filepath.Join(t.TempDir(), "events.json"))
+	ctx := context.WithValue(context.Background(), dependenciesKey, Dependencies{
+		LicenseBackend:    backend,
+		WebhookEventStore: store,
+	})
+
+	deliver := func(e *pkgstripe.Event) int {
+		req := httptest.NewRequest("POST", "/v1/stripe/webhook", nil).WithContext(ctx)
+		rec := httptest.NewRecorder()
+		processWebhookEvent(rec, req, e)
+		return rec.Code
+	}
+
+	steps := []struct {
+		name              string
+		before            func()
+		event             *pkgstripe.Event
+		expectedStatus    int
+		expectedOutcome   webhookevent.Outcome
+		expectedError     string
+		expectedAttempts  int
+		expectedLicenseID string
+		expectedSuspended bool
+	}{
+		{
+			name:              "first delivery fails",
+			event:             newRefundEvent("evt_1", true),
+			expectedStatus:    http.StatusInternalServerError,
+			expectedOutcome:   webhookevent.OutcomeFailed,
+			expectedError:     "failed to suspend license",
+			expectedAttempts:  1,
+			expectedLicenseID: "license-1",
+		},
+		{
+			name:              "redelivery succeeds",
+			event:             newRefundEvent("evt_1", true),
+			expectedStatus:    http.StatusOK,
+			expectedOutcome:   webhookevent.OutcomeSucceeded,
+			expectedAttempts:  2,
+			expectedLicenseID: "license-1",
+			expectedSuspended: true,
+		},
+		{
+			name: "event without license action",
+			before: func() {
+				// The license is reinstated manually.
+				_ = backend.ReinstateLicense(ctx, keygen.LicenseActionOptions{LicenseID: "license-1"})
+			},
+			event:             newRefundEvent("evt_2", false),
+			expectedStatus:    http.StatusOK,
+			expectedOutcome:   webhookevent.OutcomeIgnored,
+			expectedAttempts:  1,
+			expectedSuspended: false,
+		},
+		{
+			name:              "duplicate delivery is not processed",
+			event:             newRefundEvent("evt_1", true),
+			expectedStatus:    http.StatusOK,
+			expectedOutcome:   webhookevent.OutcomeSucceeded,
+			expectedAttempts:  2,
+			expectedLicenseID: "license-1",
+			expectedSuspended: false,
+		},
+		{
+			name: "delivery while another delivery is being processed",
+			before: func() {
+				_, _ = store.Start(ctx, webhookevent.Event{
+					ID:                "evt_3",
+					Type:              string(stripe.EventTypeChargeRefunded),
+					CheckoutSessionID: "cs_1",
+				})
+			},
+			event:             newRefundEvent("evt_3", true),
+			expectedStatus:    http.StatusConflict,
+			expectedOutcome:   webhookevent.OutcomeProcessing,
+			expectedAttempts:  0,
+			expectedSuspended: false,
+		},
+	}
+
+	for _, step := range steps {
+		if step.before != nil {
+			step.before()
+		}
+
+		if got := deliver(step.event); got != step.expectedStatus {
+			t.Errorf("%v: expected status %v, got %v", step.name, step.expectedStatus, got)
+		}
+
+		record, err := store.Get(ctx, step.event.ID)
+		if err != nil || record == nil {
+			t.Fatalf("%v: expected event to be recorded, got %v, %v", step.name, record, err)
+		}
+		if record.Outcome != step.expectedOutcome ||
+			record.Error != step.expectedError ||
+			record.Attempts != step.expectedAttempts ||
+			record.LicenseID != step.expectedLicenseID ||
+			record.CheckoutSessionID != "cs_1" ||
+			record.Type != string(stripe.EventTypeChargeRefunded) {
+			t.Errorf("%v: unexpected record %+v", step.name, record)
+		}
+
+		if got := backend.licenses["KEY-1"].Suspended; got != step.expectedSuspended {
+			t.Errorf("%v: expected suspended %v, got %v", step.name, step.expectedSuspended, got)
+		}
+	}
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/stripe/stripe-go/v82"
+
+	"github.com/authgear/authgear-once-license-server/pkg/jobqueue"
+	"github.com/authgear/authgear-once-license-server/pkg/slogging"
+	pkgstripe "github.com/authgear/authgear-once-license-server/pkg/stripe"
+)
+
+var errWebhookQueueNotConfigured = errors.New("AUTHGEAR_ONCE_WEBHOOK_QUEUE_DIR must be set")
+
+// webhookJobPayload is the payload of a job to handle a webhook event.
+type webhookJobPayload struct {
+	// Event is the verified Stripe event.
+	Event json.RawMessage `json:"event"`
+	// Host is the host of the webhook request.
+	// It is used to construct the URLs in emails, as if the event was handled in the request.
+	Host string `json:"host"`
+}
+
+// enqueueWebhookEvent verifies the webhook request and enqueues the event,
+// so that Stripe gets a response without waiting for Keygen and SMTP.
+func enqueueWebhookEvent(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	logger := slogging.GetLogger(ctx)
+	deps := GetDependencies(ctx)
+
+	e, err := pkgstripe.VerifyEvent(r, deps.StripeWebhookSigningSecret)
+	if err != nil {
+		slogging.Error(ctx, logger, "failed to verify webhook event",
+			"error", err)
+		if !pkgstripe.IsWebhookClientError(err) {
+			http.Error(w, "failed to verify webhook event", http.StatusInternalServerError)
+		} else {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		}
+		return
+	}
+	logger = logger.With("stripe_event_id", e.ID, "stripe_event_type", e.Type)
+
+	event, err := json.Marshal(e)
+	if err != nil {
+		panic(err)
+	}
+	payload, err := json.Marshal(webhookJobPayload{
+		Event: event,
+		Host:  r.Host,
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	enqueued, err := deps.WebhookQueue.Enqueue(ctx, e.ID, payload)
+	if err != nil {
+		slogging.Error(ctx, logger, "failed to enqueue webhook event",
+			"error", err)
+		http.Error(w, "failed to enqueue webhook event", http.StatusInternalServerError)
+		return
+	}
+	if !enqueued {
+		slogging.Info(ctx, logger, "webhook event is already enqueued")
+		return
+	}
+	slogging.Info(ctx, logger, "enqueued webhook event")
+	// Return 200 implicitly.
+}
+
+// handleWebhookJob handles the webhook event of the job in the same way as the webhook request would.
+func handleWebhookJob(ctx context.Context, job *jobqueue.Job) error {
+	logger := slogging.GetLogger(ctx).With("job_id", job.ID)
+	ctx = slogging.WithLogger(ctx, logger)
+	deps := GetDependencies(ctx)
+
+	var payload webhookJobPayload
+	err := json.Unmarshal(job.Payload, &payload)
+	if err != nil {
+		return err
+	}
+	var stripeEvent stripe.Event
+	err = json.Unmarshal(payload.Event, &stripeEvent)
+	if err != nil {
+		return err
+	}
+
+	e, err := pkgstripe.ResolveEvent(ctx, deps.StripeClient, &stripeEvent, deps.StripeCheckoutSessionMetadataMarkerValue)
+	if err != nil {
+		if errors.Is(err, pkgstripe.ErrUnknownEvent) {
+			slogging.Info(ctx, logger, "ignore unknown event", "stripe_event_id", stripeEvent.ID)
+			return nil
+		}
+		return err
+	}
+
+	r := (&http.Request{
+		Method: "POST",
+		URL:    &url.URL{Path: "/v1/stripe/webhook"},
+		Host:   payload.Host,
+		Header: http.Header{},
+	}).WithContext(ctx)
+	w := &jobResponseWriter{header: http.Header{}}
+
+	serveWebhookEvent(w, r, e)
+
+	if w.statusCode >= 400 {
+		return fmt.Errorf("status %v: %v", w.statusCode, strings.TrimSpace(w.body.String()))
+	}
+	return nil
+}
+
+// jobResponseWriter is the http.ResponseWriter of handleWebhookJob.
+// It keeps the body of an error response, which becomes the error of the job.
+type jobResponseWriter struct {
+	header     http.Header
+	statusCode int
+	body       strings.Builder
+}
+
+func (w *jobResponseWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *jobResponseWriter) WriteHeader(statusCode int) {
+	w.statusCode = statusCode
+}
+
+func (w *jobResponseWriter) Write(b []byte) (int, error) {
+	if w.statusCode >= 400 {
+		w.body.Write(b)
+	}
+	return len(b), nil
+}
+
+var workerCmd = &cobra.Command{
+	Use:   "worker",
+	Short: "Handle the enqueued Stripe webhook events",
+	Long:  "Handle the enqueued Stripe webhook events. Run it when serve is run with --worker=false. At most one worker runs on the queue at a time, so it exits with an error if another worker, including the one of serve, is running.",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx := cmd.Context()
+		worker := GetDependencies(ctx).WebhookWorker
+		if worker == nil {
+			return errWebhookQueueNotConfigured
+		}
+		return worker.Run(ctx)
+	},
+}
+
+var webhookJobsListState string
+
+var webhookJobsCmd = &cobra.Command{
+	Use:   "webhook-jobs",
+	Short: "Inspect the queue of Stripe webhook events",
+}
+
+var webhookJobsListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the jobs in a state, the earliest to run first",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx := cmd.Context()
+		queue := GetDependencies(ctx).WebhookQueue
+		if queue == nil {
+			return errWebhookQueueNotConfigured
+		}
+
+		jobs, err := queue.List(ctx, jobqueue.State(webhookJobsListState))
+		if err != nil {
+			return err
+		}
+
+		tw := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "ID\tSTATE\tATTEMPTS\tNEXT RUN AT\tLAST ERROR")
+		for _, job := range jobs {
+			fmt.Fprintf(tw, "%v\t%v\t%v\t%v\t%v\n",
+				job.ID, job.State, job.Attempts, job.NextRunAt.Format(time.RFC3339), job.LastError)
+		}
+		return tw.Flush()
+	},
+}
+
+var webhookJobsRequeueCmd = &cobra.Command{
+	Use:   "requeue JOB_ID",
+	Short: "Move a dead job back to the queue",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx := cmd.Context()
+		queue := GetDependencies(ctx).WebhookQueue
+		if queue == nil {
+			return errWebhookQueueNotConfigured
+		}
+		return queue.Requeue(ctx, args[0])
+	},
+}
+
+func init() {
+	webhookJobsListCmd.Flags().StringVar(&webhookJobsListState, "state", string(jobqueue.StateDead), "The state of the jobs: pending, running or dead")
+
+	webhookJobsCmd.AddCommand(webhookJobsListCmd)
+	webhookJobsCmd.AddCommand(webhookJobsRequeueCmd)
+	rootCmd.AddCommand(webhookJobsCmd)
+	rootCmd.AddCommand(workerCmd)
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stripe/stripe-go/v82"
+	"github.com/stripe/stripe-go/v82/client"
+	"github.com/stripe/stripe-go/v82/webhook"
+
+	"github.com/authgear/authgear-once-license-server/pkg/jobqueue"
+	pkgstripe "github.com/authgear/authgear-once-license-server/pkg/stripe"
+)
+
+// newFakeStripeClient returns a Stripe client whose only checkout session is cs_1, created by us.
+func newFakeStripeClient(t *testing.T, markerValue string) *client.API {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" || r.URL.Path != "/v1/checkout/sessions" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = fmt.Fprintf(w, `{"object":"list","has_more":false,"data":[{"id":"cs_1","object":"checkout.session","metadata":{%q:%q}}]}`,
+			pkgstripe.MetadataKeyMarker, markerValue)
+	}))
+	t.Cleanup(server.Close)
+
+	backends := stripe.NewBackendsWithConfig(&stripe.BackendConfig{
+		URL:               stripe.String(server.URL),
+		MaxNetworkRetries: stripe.Int64(0),
+	})
+	return client.New("sk_test", backends)
+}
+
+func newSignedWebhookRequest(t *testing.T, ctx context.Context, secret string, event map[string]any) *http.Request {
+	t.Helper()
+	payload, err := json.Marshal(event)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	signed := webhook.GenerateTestSignedPayload(&webhook.UnsignedPayload{
+		Payload: payload,
+		Secret:  secret,
+	})
+	req := httptest.NewRequest("POST", "/v1/stripe/webhook", bytes.NewReader(signed.Payload)).WithContext(ctx)
+	req.Header.Set("Stripe-Signature", signed.Header)
+	return req
+}
+
+func TestHandler_v1_stripe_webhook_queue(t *testing.T) {
+	const secret = "whsec_test"
+	const marker = "marker"
+
+	queue, err := jobqueue.NewDirQueue(t.TempDir())
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	backend := newFakeLicenseBackend(&fakeLicense{
+		ID:                      "license-1",
+		Key:                     "KEY-1",
+		StripeCheckoutSessionID: "cs_1",
+	})
+	worker := &jobqueue.Worker{
+		Queue:       queue,
+		Handler:     handleWebhookJob,
+		MaxAttempts: 1,
+	}
+	ctx := context.WithValue(context.Background(), dependenciesKey, Dependencies{
+		StripeClient:                             newFakeStripeClient(t, marker),
+		StripeWebhookSigningSecret:               secret,
+		StripeCheckoutSessionMetadataMarkerValue: marker,
+		LicenseBackend:                           backend,
+		WebhookQueue:                             queue,
+	})
+
+	event := map[string]any{
+		"id":          "evt_1",
+		"object":      "event",
+		"api_version": stripe.APIVersion,
+		"type":        "charge.refunded",
+		"data": map[string]any{
+			"object": map[string]any{
+				"id":             "ch_1",
+				"object":         "charge",
+				"refunded":       true,
+				"payment_intent": "pi_1",
+			},
+		},
+	}
+
+	// An unsigned request is rejected.
+	req := newSignedWebhookRequest(t, ctx, "whsec_other", event)
+	rec := httptest.NewRecorder()
+	Handler_v1_stripe_webhook(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("expected status %v, got %v", http.StatusBadRequest, rec.Code)
+	}
+
+	// The event is enqueued without being handled, and a duplicate delivery is enqueued once.
+	for range 2 {
+		req = newSignedWebhookRequest(t, ctx, secret, event)
+		rec = httptest.NewRecorder()
+		Handler_v1_stripe_webhook(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected status %v, got %v", http.StatusOK, rec.Code)
+		}
+	}
+	if backend.licenses["KEY-1"].Suspended {
+		t.Fatalf("expected license not to be suspended before the worker runs")
+	}
+	pending, err := queue.List(ctx, jobqueue.StatePending)
+	if err != nil || len(pending) != 1 || pending[0].ID != "evt_1" {
+		t.Fatalf("expected evt_1 to be pending, got %+v, %v", pending, err)
+	}
+
+	processed, err := worker.RunOnce(ctx)
+	if err != nil || !processed {
+		t.Fatalf("expected job to be processed, got %v, %v", processed, err)
+	}
+	if !backend.licenses["KEY-1"].Suspended {
+		t.Errorf("expected license to be suspended")
+	}
+	if _, err := queue.Get(ctx, "evt_1"); err == nil {
+		t.Errorf("expected job to be completed")
+	}
+}
+
+func TestHandleWebhookJobFailure(t *testing.T) {
+	const marker = "marker"
+
+	queue, err := jobqueue.NewDirQueue(t.TempDir())
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	// The license backend fails, so the job is dead after its only attempt.
+	backend := &flakyLicenseBackend{
+		fakeLicenseBackend: newFakeLicenseBackend(&fakeLicense{
+			ID:                      "license-1",
+			Key:                     "KEY-1",
+			StripeCheckoutSessionID: "cs_1",
+		}),
+		failures: 1,
+	}
+	worker := &jobqueue.Worker{
+		Queue:       queue,
+		Handler:     handleWebhookJob,
+		MaxAttempts: 1,
+	}
+	ctx := context.WithValue(context.Background(), dependenciesKey, Dependencies{
+		StripeClient:                             newFakeStripeClient(t, marker),
+		StripeCheckoutSessionMetadataMarkerValue: marker,
+		LicenseBackend:                           backend,
+		WebhookQueue:                             queue,
+	})
+
+	payload, _ := json.Marshal(webhookJobPayload{
+		Event: json.RawMessage(`{"id":"evt_1","type":"charge.refunded","data":{"object":{"id":"ch_1","refunded":true,"payment_intent":"pi_1"}}}`),
+		Host:  "license.example.com",
+	})
+	_, _ = queue.Enqueue(ctx, "evt_1", payload)
+
+	_, err = worker.RunOnce(ctx)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	job, err := queue.Get(ctx, "evt_1")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	expectedError := "status 500: failed to suspend license"
+	if job.State != jobqueue.StateDead || job.LastError != expectedError {
+		t.Errorf("expected job to be dead with %q, got %+v", expectedError, job)
+	}
+}
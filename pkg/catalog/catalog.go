@@ -0,0 +1,112 @@
+package catalog
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+var ErrInvalidCatalog = errors.New("catalog: invalid catalog")
+
+// Plan is something a customer can purchase.
+// A purchase of StripePriceID issues a license of KeygenPolicyID.
+type Plan struct {
+	// ID is the identifier used in /v1/stripe/checkout?plan=ID
+	ID string `json:"id"`
+	// Name is shown in the installation email, for example, "3 years of updates".
+	// It is optional.
+	Name           string `json:"name,omitempty"`
+	StripePriceID  string `json:"stripe_price_id"`
+	KeygenPolicyID string `json:"keygen_policy_id"`
+	// StripeRenewalPriceID is the price of renewing a license of KeygenPolicyID.
+	// It is optional. The default is StripePriceID.
+	StripeRenewalPriceID string `json:"stripe_renewal_price_id,omitempty"`
+}
+
+// RenewalStripePriceID returns the price of renewing a license of the plan.
+func (p *Plan) RenewalStripePriceID() string {
+	if p.StripeRenewalPriceID != "" {
+		return p.StripeRenewalPriceID
+	}
+	return p.StripePriceID
+}
+
+// Catalog is the list of plans.
+// The first plan is the default plan.
+type Catalog struct {
+	Plans []Plan `json:"plans"`
+}
+
+// ParseCatalog parses the JSON form of Catalog.
+// It returns ErrInvalidCatalog if the catalog is empty, or a plan is incomplete,
+// or two plans share the same ID or StripePriceID.
+func ParseCatalog(jsonString string) (*Catalog, error) {
+	var c Catalog
+	err := json.Unmarshal([]byte(jsonString), &c)
+	if err != nil {
+		return nil, errors.Join(ErrInvalidCatalog, err)
+	}
+
+	err = c.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	return &c, nil
+}
+
+func (c *Catalog) Validate() error {
+	if len(c.Plans) == 0 {
+		return fmt.Errorf("%w: no plans", ErrInvalidCatalog)
+	}
+
+	ids := map[string]struct{}{}
+	priceIDs := map[string]struct{}{}
+	for i, p := range c.Plans {
+		if p.ID == "" || p.StripePriceID == "" || p.KeygenPolicyID == "" {
+			return fmt.Errorf("%w: plans[%v] must have id, stripe_price_id and keygen_policy_id", ErrInvalidCatalog, i)
+		}
+		if _, ok := ids[p.ID]; ok {
+			return fmt.Errorf("%w: duplicate id %v", ErrInvalidCatalog, p.ID)
+		}
+		if _, ok := priceIDs[p.StripePriceID]; ok {
+			return fmt.Errorf("%w: duplicate stripe_price_id %v", ErrInvalidCatalog, p.StripePriceID)
+		}
+		ids[p.ID] = struct{}{}
+		priceIDs[p.StripePriceID] = struct{}{}
+	}
+
+	return nil
+}
+
+func (c *Catalog) DefaultPlan() *Plan {
+	return &c.Plans[0]
+}
+
+func (c *Catalog) GetPlanByID(id string) (*Plan, bool) {
+	for i := range c.Plans {
+		if c.Plans[i].ID == id {
+			return &c.Plans[i], true
+		}
+	}
+	return nil, false
+}
+
+// GetPlanByKeygenPolicyID returns the first plan that issues licenses of policyID.
+func (c *Catalog) GetPlanByKeygenPolicyID(policyID string) (*Plan, bool) {
+	for i := range c.Plans {
+		if c.Plans[i].KeygenPolicyID == policyID {
+			return &c.Plans[i], true
+		}
+	}
+	return nil, false
+}
+
+func (c *Catalog) GetPlanByStripePriceID(priceID string) (*Plan, bool) {
+	for i := range c.Plans {
+		if c.Plans[i].StripePriceID == priceID {
+			return &c.Plans[i], true
+		}
+	}
+	return nil, false
+}
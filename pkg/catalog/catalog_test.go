@@ -0,0 +1,100 @@
+package catalog
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseCatalog(t *testing.T) {
+	tests := []struct {
+		name          string
+		input         string
+		expectedError error
+	}{
+		{
+			name:  "valid",
+			input: `{"plans":[{"id":"1y","stripe_price_id":"price_1y","keygen_policy_id":"policy_1y"},{"id":"3y","name":"3 years of updates","stripe_price_id":"price_3y","keygen_policy_id":"policy_3y"}]}`,
+		},
+		{
+			name:          "invalid json",
+			input:         `{`,
+			expectedError: ErrInvalidCatalog,
+		},
+		{
+			name:          "no plans",
+			input:         `{"plans":[]}`,
+			expectedError: ErrInvalidCatalog,
+		},
+		{
+			name:          "missing keygen_policy_id",
+			input:         `{"plans":[{"id":"1y","stripe_price_id":"price_1y"}]}`,
+			expectedError: ErrInvalidCatalog,
+		},
+		{
+			name:          "duplicate id",
+			input:         `{"plans":[{"id":"1y","stripe_price_id":"price_1y","keygen_policy_id":"policy_1y"},{"id":"1y","stripe_price_id":"price_3y","keygen_policy_id":"policy_3y"}]}`,
+			expectedError: ErrInvalidCatalog,
+		},
+		{
+			name:          "duplicate stripe_price_id",
+			input:         `{"plans":[{"id":"1y","stripe_price_id":"price_1y","keygen_policy_id":"policy_1y"},{"id":"3y","stripe_price_id":"price_1y","keygen_policy_id":"policy_3y"}]}`,
+			expectedError: ErrInvalidCatalog,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseCatalog(tt.input)
+			if tt.expectedError != nil {
+				if !errors.Is(err, tt.expectedError) {
+					t.Errorf("expected error %v, got %v", tt.expectedError, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Errorf("expected no error, got %v", err)
+			}
+		})
+	}
+}
+
+func TestCatalogLookup(t *testing.T) {
+	c := &Catalog{
+		Plans: []Plan{
+			{ID: "1y", StripePriceID: "price_1y", KeygenPolicyID: "policy_1y"},
+			{ID: "3y", StripePriceID: "price_3y", KeygenPolicyID: "policy_3y", StripeRenewalPriceID: "price_3y_renewal"},
+		},
+	}
+
+	if p := c.DefaultPlan(); p.ID != "1y" {
+		t.Errorf("expected default plan to be 1y, got %v", p.ID)
+	}
+
+	if p, ok := c.GetPlanByID("3y"); !ok || p.KeygenPolicyID != "policy_3y" {
+		t.Errorf("expected plan 3y, got %v", p)
+	}
+	if _, ok := c.GetPlanByID("5y"); ok {
+		t.Errorf("expected plan 5y to be not found")
+	}
+
+	if p, ok := c.GetPlanByStripePriceID("price_3y"); !ok || p.ID != "3y" {
+		t.Errorf("expected plan 3y, got %v", p)
+	}
+	if _, ok := c.GetPlanByStripePriceID("price_5y"); ok {
+		t.Errorf("expected price_5y to be not found")
+	}
+
+	if p, ok := c.GetPlanByKeygenPolicyID("policy_3y"); !ok || p.ID != "3y" {
+		t.Errorf("expected plan 3y, got %v", p)
+	}
+	if _, ok := c.GetPlanByKeygenPolicyID("policy_5y"); ok {
+		t.Errorf("expected policy_5y to be not found")
+	}
+
+	if p, _ := c.GetPlanByID("1y"); p.RenewalStripePriceID() != "price_1y" {
+		t.Errorf("expected renewal price of 1y to be price_1y, got %v", p.RenewalStripePriceID())
+	}
+	if p, _ := c.GetPlanByID("3y"); p.RenewalStripePriceID() != "price_3y_renewal" {
+		t.Errorf("expected renewal price of 3y to be price_3y_renewal, got %v", p.RenewalStripePriceID())
+	}
+}
@@ -1,33 +1,100 @@
 package emailtemplate
 
 import (
-	_ "embed"
-	htmltemplate "html/template"
-	"strings"
+	"embed"
 )
 
-//go:embed installation_email.gotemplate
-var installationEmailString string
+//go:embed *.gotemplate *.subject.txt locales/*/*.gotemplate locales/*/*.subject.txt
+var templatesFS embed.FS
 
-var installationEmail *htmltemplate.Template
+var defaultTemplates *Templates
 
 func init() {
-	t, err := htmltemplate.New("").Parse(installationEmailString)
+	t, err := ParseFS(templatesFS)
 	if err != nil {
 		panic(err)
 	}
-	installationEmail = t
+	defaultTemplates = t
+}
+
+func must(s string, err error) string {
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
+
+// InstallationEmailSubject returns the subject of the installation email in locale.
+func InstallationEmailSubject(locale string) string {
+	return defaultTemplates.InstallationEmailSubject(locale)
 }
 
 type InstallationEmailData struct {
 	InstallationOneliner string
+	// PlanName is the name of the purchased plan.
+	// It is optional.
+	PlanName string
+	// Locale is the locale of the email, usually resolved by ResolveLocale.
+	// It is optional, the default is DefaultLocale.
+	Locale string
 }
 
 func RenderInstallationEmail(data InstallationEmailData) string {
-	var buf strings.Builder
-	err := installationEmail.Execute(&buf, data)
-	if err != nil {
-		panic(err)
-	}
-	return buf.String()
+	return must(defaultTemplates.RenderInstallationEmail(data))
+}
+
+// RenderInstallationEmailText renders the plain-text alternative of RenderInstallationEmail.
+func RenderInstallationEmailText(data InstallationEmailData) string {
+	return must(defaultTemplates.RenderInstallationEmailText(data))
+}
+
+type RenewalEmailData struct {
+	LicenseKey string
+	// ExpireAt is the formatted new expiry of the license.
+	ExpireAt string
+}
+
+func RenderRenewalEmail(data RenewalEmailData) string {
+	return must(defaultTemplates.RenderRenewalEmail(data))
+}
+
+// RenderRenewalEmailText renders the plain-text alternative of RenderRenewalEmail.
+func RenderRenewalEmailText(data RenewalEmailData) string {
+	return must(defaultTemplates.RenderRenewalEmailText(data))
+}
+
+type PaymentFailedEmailData struct {
+	// IsRenewal is true if the payment was for renewing a license.
+	IsRenewal bool
+	// PlanName is the name of the plan being purchased.
+	// It is optional.
+	PlanName string
+}
+
+func RenderPaymentFailedEmail(data PaymentFailedEmailData) string {
+	return must(defaultTemplates.RenderPaymentFailedEmail(data))
+}
+
+// RenderPaymentFailedEmailText renders the plain-text alternative of RenderPaymentFailedEmail.
+func RenderPaymentFailedEmailText(data PaymentFailedEmailData) string {
+	return must(defaultTemplates.RenderPaymentFailedEmailText(data))
+}
+
+type ExpiryReminderEmailData struct {
+	LicenseKey string
+	// ExpireAt is the formatted expiry of the license.
+	ExpireAt string
+	// Expired is true if the license has expired.
+	Expired bool
+	// RenewURL is the URL to renew the license.
+	RenewURL string
+}
+
+func RenderExpiryReminderEmail(data ExpiryReminderEmailData) string {
+	return must(defaultTemplates.RenderExpiryReminderEmail(data))
+}
+
+// RenderExpiryReminderEmailText renders the plain-text alternative of RenderExpiryReminderEmail.
+func RenderExpiryReminderEmailText(data ExpiryReminderEmailData) string {
+	return must(defaultTemplates.RenderExpiryReminderEmailText(data))
 }
@@ -2,17 +2,19 @@ package emailtemplate
 
 import (
 	"regexp"
+	"strings"
 	"testing"
 )
 
 func TestInstallationEmailString(t *testing.T) {
-	if installationEmailString == "" {
-		t.Errorf("expected installationEmailString to be non-empty")
+	b, err := templatesFS.ReadFile("installation_email.gotemplate")
+	if err != nil || len(b) == 0 {
+		t.Errorf("expected installation_email.gotemplate to be embedded and non-empty")
 	}
 }
 
 func TestInstallationEmail(t *testing.T) {
-	if installationEmail == nil {
+	if defaultTemplates.installationEmail[DefaultLocale].HTML == nil {
 		t.Errorf("expected installationEmail to be non-nil")
 	}
 }
@@ -36,3 +38,124 @@ func TestRenderInstallationEmail(t *testing.T) {
 		t.Errorf("expected InstallationOneliner to be present")
 	}
 }
+
+func TestRenderInstallationEmailPlanName(t *testing.T) {
+	s := RenderInstallationEmail(InstallationEmailData{
+		InstallationOneliner: "/bin/bash",
+	})
+	if strings.Contains(s, "Your license is for the plan") {
+		t.Errorf("expected plan name to be absent")
+	}
+
+	s = RenderInstallationEmail(InstallationEmailData{
+		InstallationOneliner: "/bin/bash",
+		PlanName:             "3 years of updates",
+	})
+	if !strings.Contains(s, "3 years of updates") {
+		t.Errorf("expected PlanName to be present")
+	}
+}
+
+func TestRenderRenewalEmail(t *testing.T) {
+	data := RenewalEmailData{
+		LicenseKey: "8ECE46-C5CB99-263245-93E5CC-AD0361-V3",
+		ExpireAt:   "2026-05-29",
+	}
+
+	s := RenderRenewalEmail(data)
+
+	if !strings.Contains(s, data.LicenseKey) {
+		t.Errorf("expected LicenseKey to be present")
+	}
+	if !strings.Contains(s, data.ExpireAt) {
+		t.Errorf("expected ExpireAt to be present")
+	}
+}
+
+func TestRenderPaymentFailedEmail(t *testing.T) {
+	s := RenderPaymentFailedEmail(PaymentFailedEmailData{
+		PlanName: "3 years of updates",
+	})
+	if !strings.Contains(s, "no license has been issued") {
+		t.Errorf("expected purchase wording to be present")
+	}
+	if !strings.Contains(s, "3 years of updates") {
+		t.Errorf("expected PlanName to be present")
+	}
+
+	s = RenderPaymentFailedEmail(PaymentFailedEmailData{
+		IsRenewal: true,
+	})
+	if !strings.Contains(s, "your license has not been renewed") {
+		t.Errorf("expected renewal wording to be present")
+	}
+	if strings.Contains(s, "Plan:") {
+		t.Errorf("expected plan name to be absent")
+	}
+}
+
+func TestResolveLocale(t *testing.T) {
+	tests := []struct {
+		locale   string
+		country  string
+		expected string
+	}{
+		{"", "", "en"},
+		{"en", "", "en"},
+		{"en-GB", "", "en"},
+		{"ja", "", "ja"},
+		{"zh-HK", "", "zh-Hant"},
+		{"zh-TW", "", "zh-Hant"},
+		// Simplified Chinese is not supported.
+		{"zh", "", "en"},
+		{"zh-CN", "", "en"},
+		{"fr", "", "en"},
+		{"auto", "", "en"},
+		{"", "JP", "ja"},
+		{"", "HK", "zh-Hant"},
+		{"", "TW", "zh-Hant"},
+		{"", "MO", "zh-Hant"},
+		{"", "US", "en"},
+		{"", "FR", "en"},
+		{"auto", "JP", "ja"},
+		// The locale takes precedence over the country.
+		{"en", "JP", "en"},
+		{"ja", "HK", "ja"},
+		// The country is the fallback of an unsupported locale.
+		{"fr", "HK", "zh-Hant"},
+	}
+
+	for _, tt := range tests {
+		actual := ResolveLocale(tt.locale, tt.country)
+		if actual != tt.expected {
+			t.Errorf("ResolveLocale(%q, %q): expected %v, got %v", tt.locale, tt.country, tt.expected, actual)
+		}
+	}
+}
+
+func TestInstallationEmailLocales(t *testing.T) {
+	for _, tag := range supportedLocales {
+		locale := tag.String()
+		if InstallationEmailSubject(locale) == "" {
+			t.Errorf("%v: expected subject to be non-empty", locale)
+		}
+
+		data := InstallationEmailData{
+			InstallationOneliner: "/bin/bash",
+			PlanName:             "3 years of updates",
+			Locale:               locale,
+		}
+		for _, s := range []string{RenderInstallationEmail(data), RenderInstallationEmailText(data)} {
+			if !strings.Contains(s, data.InstallationOneliner) || !strings.Contains(s, data.PlanName) {
+				t.Errorf("%v: expected InstallationOneliner and PlanName to be present", locale)
+			}
+		}
+	}
+
+	if InstallationEmailSubject("ja-JP") != InstallationEmailSubject("ja") {
+		t.Errorf("expected ja-JP to fall back to ja")
+	}
+	if InstallationEmailSubject("de") != InstallationEmailSubject("en") {
+		t.Errorf("expected de to fall back to en")
+	}
+}
@@ -0,0 +1,87 @@
+package emailtemplate
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "update the golden files in testdata")
+
+func TestGolden(t *testing.T) {
+	installation := InstallationEmailData{
+		InstallationOneliner: "/bin/bash -c \"$(curl -fsSL https://example.com/install)\"",
+		PlanName:             "3 years of updates",
+	}
+	renewal := RenewalEmailData{
+		LicenseKey: "8ECE46-C5CB99-263245-93E5CC-AD0361-V3",
+		ExpireAt:   "2026-05-29",
+	}
+	paymentFailed := PaymentFailedEmailData{
+		PlanName: "3 years of updates",
+	}
+	paymentFailedRenewal := PaymentFailedEmailData{
+		IsRenewal: true,
+	}
+	expiryReminder := ExpiryReminderEmailData{
+		LicenseKey: "8ECE46-C5CB99-263245-93E5CC-AD0361-V3",
+		ExpireAt:   "2026-05-29",
+		RenewURL:   "https://license.example.com/v1/stripe/checkout/renew?license_key=8ECE46-C5CB99-263245-93E5CC-AD0361-V3",
+	}
+	expiryReminderExpired := expiryReminder
+	expiryReminderExpired.Expired = true
+
+	cases := []struct {
+		name   string
+		render func() string
+	}{
+		{"installation_email.html", func() string { return RenderInstallationEmail(installation) }},
+		{"installation_email.txt", func() string { return RenderInstallationEmailText(installation) }},
+		{"installation_email_no_plan.txt", func() string {
+			return RenderInstallationEmailText(InstallationEmailData{InstallationOneliner: installation.InstallationOneliner})
+		}},
+		{"installation_email.ja.html", func() string { return RenderInstallationEmail(withLocale(installation, "ja")) }},
+		{"installation_email.ja.txt", func() string { return RenderInstallationEmailText(withLocale(installation, "ja")) }},
+		{"installation_email.zh-Hant.html", func() string { return RenderInstallationEmail(withLocale(installation, "zh-Hant")) }},
+		{"installation_email.zh-Hant.txt", func() string { return RenderInstallationEmailText(withLocale(installation, "zh-Hant")) }},
+		{"renewal_email.html", func() string { return RenderRenewalEmail(renewal) }},
+		{"renewal_email.txt", func() string { return RenderRenewalEmailText(renewal) }},
+		{"payment_failed_email.html", func() string { return RenderPaymentFailedEmail(paymentFailed) }},
+		{"payment_failed_email.txt", func() string { return RenderPaymentFailedEmailText(paymentFailed) }},
+		{"payment_failed_email_renewal.html", func() string { return RenderPaymentFailedEmail(paymentFailedRenewal) }},
+		{"payment_failed_email_renewal.txt", func() string { return RenderPaymentFailedEmailText(paymentFailedRenewal) }},
+		{"expiry_reminder_email.html", func() string { return RenderExpiryReminderEmail(expiryReminder) }},
+		{"expiry_reminder_email.txt", func() string { return RenderExpiryReminderEmailText(expiryReminder) }},
+		{"expiry_reminder_email_expired.html", func() string { return RenderExpiryReminderEmail(expiryReminderExpired) }},
+		{"expiry_reminder_email_expired.txt", func() string { return RenderExpiryReminderEmailText(expiryReminderExpired) }},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			path := filepath.Join("testdata", c.name+".golden")
+			actual := c.render()
+
+			if *update {
+				err := os.WriteFile(path, []byte(actual), 0o644)
+				if err != nil {
+					t.Fatalf("failed to update golden file: %v", err)
+				}
+				return
+			}
+
+			expected, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatalf("failed to read golden file, run go test -update to create it: %v", err)
+			}
+			if actual != string(expected) {
+				t.Errorf("%v does not match the rendering, run go test -update if the change is intended\nactual:\n%v", path, actual)
+			}
+		})
+	}
+}
+
+func withLocale(data InstallationEmailData, locale string) InstallationEmailData {
+	data.Locale = locale
+	return data
+}
@@ -0,0 +1,53 @@
+package emailtemplate
+
+import (
+	"golang.org/x/text/language"
+)
+
+// DefaultLocale is the locale of the emails at the root of this package.
+// It is the fallback when the locale of the customer is not supported.
+var DefaultLocale = language.English
+
+// supportedLocales are the locales that the installation email is translated to.
+// zh-Hant covers both zh-HK and zh-TW.
+var supportedLocales = []language.Tag{
+	DefaultLocale,
+	language.Japanese,
+	language.TraditionalChinese,
+}
+
+var localeMatcher = language.NewMatcher(supportedLocales)
+
+// SupportedLocales returns the locales that the installation email is translated to, DefaultLocale first.
+func SupportedLocales() []string {
+	var locales []string
+	for _, tag := range supportedLocales {
+		locales = append(locales, tag.String())
+	}
+	return locales
+}
+
+// ResolveLocale returns the supported locale for a customer.
+// locale is a BCP 47 tag, such as zh-HK, and takes precedence.
+// country is an ISO 3166-1 alpha-2 code, such as JP, used when locale is absent or not supported.
+// Both are optional. It returns DefaultLocale if neither matches a supported locale closely.
+func ResolveLocale(locale string, country string) string {
+	var preferred []language.Tag
+	if tag, err := language.Parse(locale); err == nil {
+		preferred = append(preferred, tag)
+	}
+	if region, err := language.ParseRegion(country); err == nil {
+		// und-JP is matched with the most likely language of the country, that is ja.
+		if tag, err := language.Compose(region); err == nil {
+			preferred = append(preferred, tag)
+		}
+	}
+
+	_, index, confidence := localeMatcher.Match(preferred...)
+	// A low confidence match is, for example, zh-CN to zh-Hant,
+	// which is less readable to the customer than English.
+	if confidence < language.High {
+		return DefaultLocale.String()
+	}
+	return supportedLocales[index].String()
+}
@@ -0,0 +1,165 @@
+package emailtemplate
+
+import (
+	htmltemplate "html/template"
+	"io"
+	"io/fs"
+	"path"
+	"strings"
+	texttemplate "text/template"
+
+	"golang.org/x/text/language"
+)
+
+// Templates is a parsed set of the email templates.
+type Templates struct {
+	installationEmail       map[language.Tag]installationEmailLocale
+	renewalEmail            *htmltemplate.Template
+	renewalEmailText        *texttemplate.Template
+	paymentFailedEmail      *htmltemplate.Template
+	paymentFailedEmailText  *texttemplate.Template
+	expiryReminderEmail     *htmltemplate.Template
+	expiryReminderEmailText *texttemplate.Template
+}
+
+// installationEmailLocale is the installation email in a locale.
+type installationEmailLocale struct {
+	Subject string
+	HTML    *htmltemplate.Template
+	Text    *texttemplate.Template
+}
+
+// ParseFS parses the templates in fsys, which has the layout of this package directory.
+// The translations of the installation email are in locales, in a directory named after each locale,
+// with the same files as the English email at the root.
+//
+// The Render functions use the templates embedded in the binary.
+// ParseFS is for previewing the templates on disk while they are being edited.
+func ParseFS(fsys fs.FS) (*Templates, error) {
+	p := &templateParser{fsys: fsys}
+
+	t := &Templates{
+		installationEmail:       map[language.Tag]installationEmailLocale{},
+		renewalEmail:            p.html("renewal_email.gotemplate"),
+		renewalEmailText:        p.text("renewal_email.txt.gotemplate"),
+		paymentFailedEmail:      p.html("payment_failed_email.gotemplate"),
+		paymentFailedEmailText:  p.text("payment_failed_email.txt.gotemplate"),
+		expiryReminderEmail:     p.html("expiry_reminder_email.gotemplate"),
+		expiryReminderEmailText: p.text("expiry_reminder_email.txt.gotemplate"),
+	}
+	for _, tag := range supportedLocales {
+		dir := "."
+		if tag != DefaultLocale {
+			dir = path.Join("locales", tag.String())
+		}
+		t.installationEmail[tag] = installationEmailLocale{
+			Subject: strings.TrimSpace(p.read(path.Join(dir, "installation_email.subject.txt"))),
+			HTML:    p.html(path.Join(dir, "installation_email.gotemplate")),
+			Text:    p.text(path.Join(dir, "installation_email.txt.gotemplate")),
+		}
+	}
+
+	if p.err != nil {
+		return nil, p.err
+	}
+	return t, nil
+}
+
+// templateParser keeps the first error, so that the templates are parsed without checking the error of each.
+type templateParser struct {
+	fsys fs.FS
+	err  error
+}
+
+func (p *templateParser) read(name string) string {
+	if p.err != nil {
+		return ""
+	}
+	b, err := fs.ReadFile(p.fsys, name)
+	if err != nil {
+		p.err = err
+		return ""
+	}
+	return string(b)
+}
+
+func (p *templateParser) html(name string) *htmltemplate.Template {
+	s := p.read(name)
+	if p.err != nil {
+		return nil
+	}
+	t, err := htmltemplate.New(name).Parse(s)
+	if err != nil {
+		p.err = err
+		return nil
+	}
+	return t
+}
+
+func (p *templateParser) text(name string) *texttemplate.Template {
+	s := p.read(name)
+	if p.err != nil {
+		return nil
+	}
+	t, err := texttemplate.New(name).Parse(s)
+	if err != nil {
+		p.err = err
+		return nil
+	}
+	return t
+}
+
+type executor interface {
+	Execute(w io.Writer, data any) error
+}
+
+func execute(t executor, data any) (string, error) {
+	var buf strings.Builder
+	err := t.Execute(&buf, data)
+	if err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+func (t *Templates) getInstallationEmailLocale(locale string) installationEmailLocale {
+	tag := language.Make(ResolveLocale(locale, ""))
+	return t.installationEmail[tag]
+}
+
+// InstallationEmailSubject returns the subject of the installation email in locale.
+func (t *Templates) InstallationEmailSubject(locale string) string {
+	return t.getInstallationEmailLocale(locale).Subject
+}
+
+func (t *Templates) RenderInstallationEmail(data InstallationEmailData) (string, error) {
+	return execute(t.getInstallationEmailLocale(data.Locale).HTML, data)
+}
+
+func (t *Templates) RenderInstallationEmailText(data InstallationEmailData) (string, error) {
+	return execute(t.getInstallationEmailLocale(data.Locale).Text, data)
+}
+
+func (t *Templates) RenderRenewalEmail(data RenewalEmailData) (string, error) {
+	return execute(t.renewalEmail, data)
+}
+
+func (t *Templates) RenderRenewalEmailText(data RenewalEmailData) (string, error) {
+	return execute(t.renewalEmailText, data)
+}
+
+func (t *Templates) RenderPaymentFailedEmail(data PaymentFailedEmailData) (string, error) {
+	return execute(t.paymentFailedEmail, data)
+}
+
+func (t *Templates) RenderPaymentFailedEmailText(data PaymentFailedEmailData) (string, error) {
+	return execute(t.paymentFailedEmailText, data)
+}
+
+func (t *Templates) RenderExpiryReminderEmail(data ExpiryReminderEmailData) (string, error) {
+	return execute(t.expiryReminderEmail, data)
+}
+
+func (t *Templates) RenderExpiryReminderEmailText(data ExpiryReminderEmailData) (string, error) {
+	return execute(t.expiryReminderEmailText, data)
+}
@@ -0,0 +1,82 @@
+package emailtemplate
+
+import (
+	"io/fs"
+	"os"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestParseFS(t *testing.T) {
+	templates, err := ParseFS(os.DirFS("."))
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	data := InstallationEmailData{
+		InstallationOneliner: "/bin/bash",
+		Locale:               "ja",
+	}
+	s, err := templates.RenderInstallationEmail(data)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if s != RenderInstallationEmail(data) {
+		t.Errorf("expected the templates on disk to render the same as the embedded ones")
+	}
+}
+
+func TestParseFSError(t *testing.T) {
+	copyFS := func(t *testing.T) fstest.MapFS {
+		fsys := fstest.MapFS{}
+		err := fs.WalkDir(templatesFS, ".", func(path string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() {
+				return err
+			}
+			b, err := templatesFS.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			fsys[path] = &fstest.MapFile{Data: b}
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		return fsys
+	}
+
+	tests := []struct {
+		name          string
+		modify        func(fsys fstest.MapFS)
+		expectedError string
+	}{
+		{
+			name: "syntax error",
+			modify: func(fsys fstest.MapFS) {
+				fsys["renewal_email.gotemplate"] = &fstest.MapFile{Data: []byte("{{ if }}")}
+			},
+			expectedError: "renewal_email.gotemplate",
+		},
+		{
+			name: "missing translation",
+			modify: func(fsys fstest.MapFS) {
+				delete(fsys, "locales/ja/installation_email.txt.gotemplate")
+			},
+			expectedError: "locales/ja/installation_email.txt.gotemplate",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fsys := copyFS(t)
+			tt.modify(fsys)
+
+			_, err := ParseFS(fsys)
+			if err == nil || !strings.Contains(err.Error(), tt.expectedError) {
+				t.Errorf("expected error about %v, got %v", tt.expectedError, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,66 @@
+// Package expiryreminder records the license expiry reminders that have been sent,
+// so that the scheduled reminder command never sends the same reminder twice.
+package expiryreminder
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/authgear/authgear-once-license-server/pkg/filestore"
+)
+
+// Reminder is the record of a reminder email.
+type Reminder struct {
+	LicenseID string `json:"license_id"`
+	// Expiry is the expiry of the license when the reminder was sent.
+	// A renewed license has a new expiry, so it is reminded again before the new expiry.
+	Expiry time.Time `json:"expiry"`
+	// WindowDays is the reminder window, in days before Expiry.
+	WindowDays int       `json:"window_days"`
+	Email      string    `json:"email"`
+	SentAt     time.Time `json:"sent_at"`
+}
+
+// Key identifies the reminder of a license for an expiry and a window.
+func Key(licenseID string, expiry time.Time, windowDays int) string {
+	return fmt.Sprintf("%v/%v/%v", licenseID, expiry.UTC().Format(time.RFC3339), windowDays)
+}
+
+func (r Reminder) Key() string {
+	return Key(r.LicenseID, r.Expiry, r.WindowDays)
+}
+
+type Store interface {
+	// Get returns nil if the reminder has not been sent.
+	Get(ctx context.Context, key string) (*Reminder, error)
+	Put(ctx context.Context, reminder Reminder) error
+}
+
+// FileStore is a Store backed by a JSON file.
+type FileStore struct {
+	reminders *filestore.Map[string, Reminder]
+}
+
+var _ Store = (*FileStore)(nil)
+
+func NewFileStore(path string) *FileStore {
+	return &FileStore{
+		reminders: filestore.NewMap[string, Reminder](path),
+	}
+}
+
+func (s *FileStore) Get(ctx context.Context, key string) (*Reminder, error) {
+	reminder, ok, err := s.reminders.Get(key)
+	if err != nil || !ok {
+		return nil, err
+	}
+	return &reminder, nil
+}
+
+func (s *FileStore) Put(ctx context.Context, reminder Reminder) error {
+	return s.reminders.Update(func(reminders map[string]Reminder) (bool, error) {
+		reminders[reminder.Key()] = reminder
+		return true, nil
+	})
+}
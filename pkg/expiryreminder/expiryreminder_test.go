@@ -0,0 +1,61 @@
+package expiryreminder
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestFileStore(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "reminders.json")
+	expiry := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+
+	reminder := Reminder{
+		LicenseID:  "license-1",
+		Expiry:     expiry,
+		WindowDays: 30,
+		Email:      "user@example.com",
+		SentAt:     expiry.AddDate(0, 0, -30),
+	}
+
+	s := NewFileStore(path)
+	got, err := s.Get(ctx, reminder.Key())
+	if err != nil || got != nil {
+		t.Fatalf("expected no reminder, got %v, %v", got, err)
+	}
+
+	err = s.Put(ctx, reminder)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	// Another store reads the reminders from the file.
+	s = NewFileStore(path)
+	got, err = s.Get(ctx, Key("license-1", expiry, 30))
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if got == nil || !reflect.DeepEqual(*got, reminder) {
+		t.Errorf("expected %v, got %v", reminder, got)
+	}
+
+	keyTests := []struct {
+		name       string
+		expiry     time.Time
+		windowDays int
+	}{
+		{"another window", expiry, 7},
+		{"renewed", expiry.AddDate(1, 0, 0), 30},
+	}
+	for _, tt := range keyTests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := s.Get(ctx, Key("license-1", tt.expiry, tt.windowDays))
+			if err != nil || got != nil {
+				t.Errorf("expected no reminder, got %v, %v", got, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,185 @@
+// Package filestore persists a map in a JSON file.
+// It backs the file-based stores of the other packages.
+package filestore
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+)
+
+// Map is a map persisted in a JSON file.
+//
+// The whole file is rewritten atomically on every change,
+// by writing a temporary file and renaming it, so that a crash never leaves a truncated file.
+// The file is read again whenever another Map, possibly in another process, has replaced it.
+// Changes are made with Update, which holds an exclusive lock on Path+".lock",
+// so that concurrent writers in different processes do not overwrite each other's changes.
+type Map[K ~string, V any] struct {
+	Path string
+
+	mu       sync.Mutex
+	entries  map[K]V
+	fileInfo os.FileInfo
+}
+
+func NewMap[K ~string, V any](path string) *Map[K, V] {
+	return &Map[K, V]{
+		Path: path,
+	}
+}
+
+// Get returns the value of key. ok is false if there is no such key.
+func (m *Map[K, V]) Get(key K) (value V, ok bool, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	err = m.load()
+	if err != nil {
+		return
+	}
+
+	value, ok = m.entries[key]
+	return
+}
+
+// Values returns all the values, in no particular order.
+func (m *Map[K, V]) Values() (values []V, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	err = m.load()
+	if err != nil {
+		return
+	}
+
+	for _, v := range m.entries {
+		values = append(values, v)
+	}
+	return
+}
+
+// Update calls f with the latest entries, and writes them to the file if f returns changed.
+// f can modify entries in place. No other Update of the same file runs at the same time.
+// If f returns an error, the file is not written and the error is returned.
+func (m *Map[K, V]) Update(f func(entries map[K]V) (changed bool, err error)) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	unlock, err := m.lockFile()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	err = m.load()
+	if err != nil {
+		return err
+	}
+
+	changed, err := f(m.entries)
+	if err == nil && changed {
+		err = m.save()
+	}
+	if err != nil {
+		// entries may have been modified without being written, so they are read again next time.
+		m.fileInfo = nil
+		m.entries = nil
+		return err
+	}
+	return nil
+}
+
+func (m *Map[K, V]) lockFile() (unlock func(), err error) {
+	f, err := os.OpenFile(m.Path+".lock", os.O_RDWR|os.O_CREATE, 0o600)
+	if err != nil {
+		return
+	}
+
+	err = syscall.Flock(int(f.Fd()), syscall.LOCK_EX)
+	if err != nil {
+		f.Close()
+		return
+	}
+
+	unlock = func() {
+		_ = syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+		f.Close()
+	}
+	return
+}
+
+// load reads the file, unless it is the same file read last time.
+func (m *Map[K, V]) load() error {
+	fileInfo, err := os.Stat(m.Path)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		if m.entries == nil || m.fileInfo != nil {
+			m.entries = map[K]V{}
+			m.fileInfo = nil
+		}
+		return nil
+	case err != nil:
+		return err
+	}
+
+	if m.entries != nil && m.fileInfo != nil && isSameFile(m.fileInfo, fileInfo) {
+		return nil
+	}
+
+	b, err := os.ReadFile(m.Path)
+	if err != nil {
+		return err
+	}
+
+	entries := map[K]V{}
+	err = json.Unmarshal(b, &entries)
+	if err != nil {
+		return err
+	}
+
+	m.entries = entries
+	m.fileInfo = fileInfo
+	return nil
+}
+
+func (m *Map[K, V]) save() error {
+	b, err := json.Marshal(m.entries)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(m.Path), filepath.Base(m.Path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	_, err = f.Write(b)
+	if err != nil {
+		f.Close()
+		return err
+	}
+	err = f.Close()
+	if err != nil {
+		return err
+	}
+
+	err = os.Rename(f.Name(), m.Path)
+	if err != nil {
+		return err
+	}
+
+	m.fileInfo, err = os.Stat(m.Path)
+	return err
+}
+
+// isSameFile tells whether a and b are the same file with the same content.
+// The file is replaced on every change, so a changed file is a different file.
+// The modification time and the size are compared too, in case the file system reuses the file.
+func isSameFile(a os.FileInfo, b os.FileInfo) bool {
+	return os.SameFile(a, b) && a.ModTime().Equal(b.ModTime()) && a.Size() == b.Size()
+}
@@ -0,0 +1,93 @@
+package filestore
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestMap(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "map.json")
+	m := NewMap[string, int](path)
+
+	_, ok, err := m.Get("a")
+	if err != nil || ok {
+		t.Fatalf("expected no value, got %v, %v", ok, err)
+	}
+
+	err = m.Update(func(entries map[string]int) (bool, error) {
+		entries["a"] = 1
+		return true, nil
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	// Another map reads the value from the file.
+	other := NewMap[string, int](path)
+	if v, ok, err := other.Get("a"); err != nil || !ok || v != 1 {
+		t.Errorf("expected 1, got %v, %v, %v", v, ok, err)
+	}
+
+	// The change of the other map is read again.
+	err = other.Update(func(entries map[string]int) (bool, error) {
+		entries["b"] = 2
+		return true, nil
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if v, ok, err := m.Get("b"); err != nil || !ok || v != 2 {
+		t.Errorf("expected 2, got %v, %v, %v", v, ok, err)
+	}
+
+	// A failed update is not kept.
+	updateErr := errors.New("update failed")
+	err = m.Update(func(entries map[string]int) (bool, error) {
+		entries["a"] = 3
+		return true, updateErr
+	})
+	if !errors.Is(err, updateErr) {
+		t.Errorf("expected %v, got %v", updateErr, err)
+	}
+	if v, _, _ := m.Get("a"); v != 1 {
+		t.Errorf("expected 1, got %v", v)
+	}
+
+	values, err := m.Values()
+	if err != nil || len(values) != 2 {
+		t.Errorf("expected 2 values, got %v, %v", values, err)
+	}
+}
+
+// TestMapConcurrentUpdates tests that concurrent writers of the same file, as if in different processes,
+// do not overwrite each other's changes.
+func TestMapConcurrentUpdates(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "map.json")
+	maps := []*Map[string, int]{NewMap[string, int](path), NewMap[string, int](path)}
+
+	var wg sync.WaitGroup
+	for i, m := range maps {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				err := m.Update(func(entries map[string]int) (bool, error) {
+					entries[fmt.Sprintf("%v-%v", i, j)] = j
+					return true, nil
+				})
+				if err != nil {
+					t.Errorf("expected no error, got %v", err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	values, err := NewMap[string, int](path).Values()
+	if err != nil || len(values) != 40 {
+		t.Errorf("expected 40 values, got %v, %v", len(values), err)
+	}
+}
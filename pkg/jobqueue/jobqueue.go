@@ -0,0 +1,335 @@
+// Package jobqueue is a durable local job queue backed by a directory.
+// Each job is a JSON file in the subdirectory of its state.
+// A job moves between the subdirectories by renaming, which is atomic,
+// so the queue can be shared by the process that enqueues and the process that works on the jobs.
+package jobqueue
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
+)
+
+var ErrJobNotFound = errors.New("jobqueue: job not found")
+var ErrInvalidJobID = errors.New("jobqueue: invalid job ID")
+var ErrWorkerRunning = errors.New("jobqueue: another worker is running on the queue")
+
+type State string
+
+const (
+	// StatePending means the job is waiting to run at NextRunAt.
+	StatePending State = "pending"
+	// StateRunning means the job is claimed by the worker.
+	StateRunning State = "running"
+	// StateDead means the job has failed too many times, and is not run again until it is requeued.
+	StateDead State = "dead"
+)
+
+var states = []State{StatePending, StateRunning, StateDead}
+
+type Job struct {
+	ID        string          `json:"id"`
+	Payload   json.RawMessage `json:"payload"`
+	State     State           `json:"state"`
+	Attempts  int             `json:"attempts"`
+	LastError string          `json:"last_error,omitempty"`
+	CreatedAt time.Time       `json:"created_at"`
+	NextRunAt time.Time       `json:"next_run_at"`
+}
+
+// DirQueue is a queue backed by the directory Dir.
+// At most one worker can claim jobs from it at a time, which is enforced by LockWorker.
+type DirQueue struct {
+	Dir string
+	Now func() time.Time
+}
+
+func NewDirQueue(dir string) (*DirQueue, error) {
+	for _, state := range states {
+		err := os.MkdirAll(filepath.Join(dir, string(state)), 0o700)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &DirQueue{
+		Dir: dir,
+		Now: time.Now,
+	}, nil
+}
+
+func (q *DirQueue) path(state State, id string) string {
+	return filepath.Join(q.Dir, string(state), id+".json")
+}
+
+func validateID(id string) error {
+	if id == "" || id == "." || id == ".." || strings.ContainsAny(id, `/\`) {
+		return fmt.Errorf("%w: %q", ErrInvalidJobID, id)
+	}
+	return nil
+}
+
+// Enqueue adds a job to run now.
+// It does nothing and returns false if a job with the same ID is in the queue, in any state.
+// The check and the write are done with Dir/enqueue.lock held,
+// so that concurrent enqueues of the same ID, possibly by different processes, add only one job.
+func (q *DirQueue) Enqueue(ctx context.Context, id string, payload []byte) (enqueued bool, err error) {
+	err = validateID(id)
+	if err != nil {
+		return
+	}
+
+	unlock, err := q.flock("enqueue.lock", syscall.LOCK_EX)
+	if err != nil {
+		return
+	}
+	defer unlock()
+
+	_, err = q.Get(ctx, id)
+	switch {
+	case err == nil:
+		return
+	case !errors.Is(err, ErrJobNotFound):
+		return
+	}
+
+	now := q.Now().UTC()
+	err = q.write(StatePending, Job{
+		ID:        id,
+		Payload:   payload,
+		State:     StatePending,
+		CreatedAt: now,
+		NextRunAt: now,
+	})
+	if err != nil {
+		return
+	}
+
+	enqueued = true
+	return
+}
+
+// Get returns the job with the given ID, in any state.
+func (q *DirQueue) Get(ctx context.Context, id string) (*Job, error) {
+	err := validateID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, state := range states {
+		job, err := q.read(q.path(state, id))
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return job, nil
+	}
+	return nil, ErrJobNotFound
+}
+
+// List returns the jobs in the state, the earliest to run first.
+func (q *DirQueue) List(ctx context.Context, state State) ([]Job, error) {
+	entries, err := os.ReadDir(filepath.Join(q.Dir, string(state)))
+	if err != nil {
+		return nil, err
+	}
+
+	var jobs []Job
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".json" {
+			continue
+		}
+		job, err := q.read(filepath.Join(q.Dir, string(state), entry.Name()))
+		if errors.Is(err, os.ErrNotExist) {
+			// The job has moved to another state since ReadDir.
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, *job)
+	}
+
+	slices.SortFunc(jobs, func(a, b Job) int {
+		if c := a.NextRunAt.Compare(b.NextRunAt); c != 0 {
+			return c
+		}
+		return strings.Compare(a.ID, b.ID)
+	})
+	return jobs, nil
+}
+
+// Claim moves the pending job that is due the earliest to running.
+// It returns nil if no job is due.
+func (q *DirQueue) Claim(ctx context.Context) (*Job, error) {
+	jobs, err := q.List(ctx, StatePending)
+	if err != nil {
+		return nil, err
+	}
+
+	now := q.Now()
+	for _, job := range jobs {
+		if job.NextRunAt.After(now) {
+			break
+		}
+
+		err = os.Rename(q.path(StatePending, job.ID), q.path(StateRunning, job.ID))
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		job.State = StateRunning
+		return &job, nil
+	}
+	return nil, nil
+}
+
+// Complete removes the running job from the queue.
+func (q *DirQueue) Complete(ctx context.Context, job *Job) error {
+	return os.Remove(q.path(StateRunning, job.ID))
+}
+
+// Retry moves the running job back to pending, to run at nextRunAt.
+func (q *DirQueue) Retry(ctx context.Context, job *Job, jobErr error, nextRunAt time.Time) error {
+	job.LastError = jobErr.Error()
+	job.NextRunAt = nextRunAt.UTC()
+	return q.move(job, StateRunning, StatePending)
+}
+
+// Bury moves the running job to dead.
+func (q *DirQueue) Bury(ctx context.Context, job *Job, jobErr error) error {
+	job.LastError = jobErr.Error()
+	return q.move(job, StateRunning, StateDead)
+}
+
+// Requeue moves the dead job back to pending, to run now with a fresh count of attempts.
+func (q *DirQueue) Requeue(ctx context.Context, id string) error {
+	err := validateID(id)
+	if err != nil {
+		return err
+	}
+
+	job, err := q.read(q.path(StateDead, id))
+	if errors.Is(err, os.ErrNotExist) {
+		return ErrJobNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	job.Attempts = 0
+	job.NextRunAt = q.Now().UTC()
+	return q.move(job, StateDead, StatePending)
+}
+
+// Recover moves every running job back to pending.
+// The worker calls it when it starts, to pick up the jobs it was running when it stopped.
+func (q *DirQueue) Recover(ctx context.Context) error {
+	jobs, err := q.List(ctx, StateRunning)
+	if err != nil {
+		return err
+	}
+	for _, job := range jobs {
+		err = q.move(&job, StateRunning, StatePending)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// LockWorker takes an exclusive lock on Dir/worker.lock, so that at most one worker runs on the queue.
+// It returns ErrWorkerRunning if the lock is held, possibly by another process.
+// The lock is released by unlock, or when the process exits.
+func (q *DirQueue) LockWorker() (unlock func(), err error) {
+	unlock, err = q.flock("worker.lock", syscall.LOCK_EX|syscall.LOCK_NB)
+	if errors.Is(err, syscall.EWOULDBLOCK) {
+		err = fmt.Errorf("%w: %v", ErrWorkerRunning, q.Dir)
+	}
+	return
+}
+
+// flock takes a lock on the file Dir/name with the flock operation how.
+func (q *DirQueue) flock(name string, how int) (unlock func(), err error) {
+	f, err := os.OpenFile(filepath.Join(q.Dir, name), os.O_RDWR|os.O_CREATE, 0o600)
+	if err != nil {
+		return
+	}
+
+	err = syscall.Flock(int(f.Fd()), how)
+	if err != nil {
+		f.Close()
+		return
+	}
+
+	unlock = func() {
+		_ = syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+		f.Close()
+	}
+	return
+}
+
+func (q *DirQueue) move(job *Job, from State, to State) error {
+	job.State = to
+	err := q.write(to, *job)
+	if err != nil {
+		return err
+	}
+	err = os.Remove(q.path(from, job.ID))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func (q *DirQueue) read(path string) (*Job, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var job Job
+	err = json.Unmarshal(b, &job)
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+func (q *DirQueue) write(state State, job Job) error {
+	b, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+
+	// Write to a temporary file and rename it, so that a crash never leaves a truncated job.
+	// The temporary file is not named *.json, so List skips it.
+	dir := filepath.Join(q.Dir, string(state))
+	f, err := os.CreateTemp(dir, job.ID+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	_, err = f.Write(b)
+	if err != nil {
+		f.Close()
+		return err
+	}
+	err = f.Close()
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(f.Name(), q.path(state, job.ID))
+}
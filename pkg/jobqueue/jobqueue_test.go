@@ -0,0 +1,267 @@
+package jobqueue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newTestQueue(t *testing.T) (*DirQueue, *time.Time) {
+	t.Helper()
+	q, err := NewDirQueue(t.TempDir())
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	now := time.Date(2025, 5, 1, 0, 0, 0, 0, time.UTC)
+	q.Now = func() time.Time { return now }
+	return q, &now
+}
+
+func TestDirQueueEnqueue(t *testing.T) {
+	ctx := context.Background()
+	q, _ := newTestQueue(t)
+
+	enqueued, err := q.Enqueue(ctx, "evt_1", []byte(`{"a":1}`))
+	if err != nil || !enqueued {
+		t.Fatalf("expected job to be enqueued, got %v, %v", enqueued, err)
+	}
+
+	// Enqueuing the same ID again is a no-op.
+	enqueued, err = q.Enqueue(ctx, "evt_1", []byte(`{"a":2}`))
+	if err != nil || enqueued {
+		t.Fatalf("expected job not to be enqueued, got %v, %v", enqueued, err)
+	}
+
+	job, err := q.Get(ctx, "evt_1")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if job.State != StatePending || string(job.Payload) != `{"a":1}` {
+		t.Errorf("unexpected job %+v", job)
+	}
+
+	for _, id := range []string{"", "..", "a/b", `a\b`} {
+		_, err = q.Enqueue(ctx, id, nil)
+		if !errors.Is(err, ErrInvalidJobID) {
+			t.Errorf("%q: expected ErrInvalidJobID, got %v", id, err)
+		}
+	}
+
+	_, err = q.Get(ctx, "evt_unknown")
+	if !errors.Is(err, ErrJobNotFound) {
+		t.Errorf("expected ErrJobNotFound, got %v", err)
+	}
+}
+
+func TestDirQueueEnqueueConcurrently(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	// Each enqueue has its own DirQueue, as if it were made by a different process.
+	n := 50
+	start := make(chan struct{})
+	var wg sync.WaitGroup
+	var count atomic.Int32
+	for i := range n {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			q, err := NewDirQueue(dir)
+			if err != nil {
+				t.Errorf("expected no error, got %v", err)
+				return
+			}
+			// Enqueue reads the time between the check and the write, so a slow clock widens the window of a race.
+			q.Now = func() time.Time {
+				time.Sleep(time.Millisecond)
+				return time.Now()
+			}
+			<-start
+			enqueued, err := q.Enqueue(ctx, "evt_1", []byte(fmt.Sprintf(`{"a":%d}`, i)))
+			if err != nil {
+				t.Errorf("expected no error, got %v", err)
+				return
+			}
+			if enqueued {
+				count.Add(1)
+			}
+		}()
+	}
+	close(start)
+	wg.Wait()
+
+	if got := count.Load(); got != 1 {
+		t.Errorf("expected 1 job to be enqueued, got %v", got)
+	}
+}
+
+func TestDirQueueLifecycle(t *testing.T) {
+	ctx := context.Background()
+	q, now := newTestQueue(t)
+
+	_, _ = q.Enqueue(ctx, "evt_1", []byte(`{}`))
+	*now = now.Add(time.Second)
+	_, _ = q.Enqueue(ctx, "evt_2", []byte(`{}`))
+
+	job, err := q.Claim(ctx)
+	if err != nil || job == nil || job.ID != "evt_1" || job.State != StateRunning {
+		t.Fatalf("expected evt_1 to be claimed, got %+v, %v", job, err)
+	}
+
+	err = q.Retry(ctx, job, errors.New("boom"), now.Add(time.Minute))
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	// evt_1 is not due, so evt_2 is claimed.
+	job, err = q.Claim(ctx)
+	if err != nil || job == nil || job.ID != "evt_2" {
+		t.Fatalf("expected evt_2 to be claimed, got %+v, %v", job, err)
+	}
+	err = q.Complete(ctx, job)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if _, err = q.Get(ctx, "evt_2"); !errors.Is(err, ErrJobNotFound) {
+		t.Errorf("expected completed job to be removed, got %v", err)
+	}
+
+	job, err = q.Claim(ctx)
+	if err != nil || job != nil {
+		t.Fatalf("expected no job to be due, got %+v, %v", job, err)
+	}
+
+	*now = now.Add(time.Minute)
+	job, err = q.Claim(ctx)
+	if err != nil || job == nil || job.ID != "evt_1" || job.LastError != "boom" {
+		t.Fatalf("expected evt_1 to be claimed, got %+v, %v", job, err)
+	}
+
+	err = q.Bury(ctx, job, errors.New("boom again"))
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	dead, err := q.List(ctx, StateDead)
+	if err != nil || len(dead) != 1 || dead[0].LastError != "boom again" {
+		t.Fatalf("expected evt_1 to be dead, got %+v, %v", dead, err)
+	}
+
+	err = q.Requeue(ctx, "evt_1")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	job, err = q.Get(ctx, "evt_1")
+	if err != nil || job.State != StatePending || job.Attempts != 0 {
+		t.Fatalf("expected evt_1 to be pending, got %+v, %v", job, err)
+	}
+
+	err = q.Requeue(ctx, "evt_1")
+	if !errors.Is(err, ErrJobNotFound) {
+		t.Errorf("expected ErrJobNotFound, got %v", err)
+	}
+}
+
+func TestDirQueueRecover(t *testing.T) {
+	ctx := context.Background()
+	q, _ := newTestQueue(t)
+
+	_, _ = q.Enqueue(ctx, "evt_1", []byte(`{}`))
+	_, _ = q.Claim(ctx)
+
+	err := q.Recover(ctx)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	job, err := q.Claim(ctx)
+	if err != nil || job == nil || job.ID != "evt_1" {
+		t.Fatalf("expected evt_1 to be claimed again, got %+v, %v", job, err)
+	}
+}
+
+func TestWorkerRunLocksQueue(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	q, _ := newTestQueue(t)
+
+	unlock, err := q.LockWorker()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	w := &Worker{
+		Queue:        q,
+		Handler:      func(ctx context.Context, job *Job) error { return nil },
+		PollInterval: time.Millisecond,
+	}
+	err = w.Run(ctx)
+	if !errors.Is(err, ErrWorkerRunning) {
+		t.Fatalf("expected %v, got %v", ErrWorkerRunning, err)
+	}
+
+	// The worker runs once the lock is released.
+	unlock()
+	done := make(chan error)
+	go func() {
+		done <- w.Run(ctx)
+	}()
+	time.Sleep(10 * time.Millisecond)
+	_, err = q.LockWorker()
+	if !errors.Is(err, ErrWorkerRunning) {
+		t.Errorf("expected %v, got %v", ErrWorkerRunning, err)
+	}
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+}
+
+func TestWorker(t *testing.T) {
+	ctx := context.Background()
+	q, now := newTestQueue(t)
+
+	var calls int
+	w := &Worker{
+		Queue: q,
+		Handler: func(ctx context.Context, job *Job) error {
+			calls++
+			return errors.New("boom")
+		},
+		MaxAttempts: 3,
+		BaseBackoff: time.Minute,
+		MaxBackoff:  90 * time.Second,
+	}
+
+	_, _ = q.Enqueue(ctx, "evt_1", []byte(`{}`))
+
+	expectedBackoffs := []time.Duration{time.Minute, 90 * time.Second}
+	for i, backoff := range expectedBackoffs {
+		processed, err := w.RunOnce(ctx)
+		if err != nil || !processed {
+			t.Fatalf("attempt %v: expected job to be processed, got %v, %v", i+1, processed, err)
+		}
+		job, _ := q.Get(ctx, "evt_1")
+		if job.State != StatePending || job.Attempts != i+1 || !job.NextRunAt.Equal(now.Add(backoff)) {
+			t.Fatalf("attempt %v: unexpected job %+v", i+1, job)
+		}
+
+		// Not due yet.
+		processed, _ = w.RunOnce(ctx)
+		if processed {
+			t.Fatalf("attempt %v: expected job not to be due", i+1)
+		}
+		*now = now.Add(backoff)
+	}
+
+	_, _ = w.RunOnce(ctx)
+	job, _ := q.Get(ctx, "evt_1")
+	if job.State != StateDead || job.Attempts != 3 || job.LastError != "boom" {
+		t.Errorf("expected job to be dead, got %+v", job)
+	}
+	if calls != 3 {
+		t.Errorf("expected 3 calls, got %v", calls)
+	}
+}
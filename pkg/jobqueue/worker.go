@@ -0,0 +1,105 @@
+package jobqueue
+
+import (
+	"context"
+	"time"
+
+	"github.com/authgear/authgear-once-license-server/pkg/slogging"
+)
+
+const (
+	DefaultMaxAttempts  = 10
+	DefaultBaseBackoff  = 30 * time.Second
+	DefaultMaxBackoff   = time.Hour
+	DefaultPollInterval = time.Second
+)
+
+// Handler runs a job. A job that returns an error is retried with backoff,
+// until it has been attempted MaxAttempts times, after which it is dead.
+type Handler func(ctx context.Context, job *Job) error
+
+type Worker struct {
+	Queue        *DirQueue
+	Handler      Handler
+	MaxAttempts  int
+	BaseBackoff  time.Duration
+	MaxBackoff   time.Duration
+	PollInterval time.Duration
+}
+
+// Run runs the jobs until ctx is done.
+// It returns ErrWorkerRunning if another worker is running on the queue.
+func (w *Worker) Run(ctx context.Context) error {
+	logger := slogging.GetLogger(ctx)
+
+	unlock, err := w.Queue.LockWorker()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	// The running jobs are left by the previous worker, as no other worker is running.
+	err = w.Queue.Recover(ctx)
+	if err != nil {
+		return err
+	}
+
+	for {
+		processed, err := w.RunOnce(ctx)
+		if err != nil {
+			slogging.Error(ctx, logger, "failed to run job",
+				"error", err)
+		}
+		if processed && err == nil {
+			continue
+		}
+
+		timer := time.NewTimer(w.PollInterval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil
+		case <-timer.C:
+		}
+	}
+}
+
+// RunOnce runs the job that is due the earliest, if any.
+func (w *Worker) RunOnce(ctx context.Context) (processed bool, err error) {
+	job, err := w.Queue.Claim(ctx)
+	if err != nil || job == nil {
+		return
+	}
+	processed = true
+
+	logger := slogging.GetLogger(ctx).With("job_id", job.ID)
+
+	job.Attempts++
+	jobErr := w.Handler(ctx, job)
+	switch {
+	case jobErr == nil:
+		err = w.Queue.Complete(ctx, job)
+	case job.Attempts >= w.MaxAttempts:
+		slogging.Error(ctx, logger, "job is dead",
+			"attempts", job.Attempts,
+			"error", jobErr)
+		err = w.Queue.Bury(ctx, job, jobErr)
+	default:
+		nextRunAt := w.Queue.Now().Add(w.backoff(job.Attempts))
+		slogging.Warn(ctx, logger, "job will be retried",
+			"attempts", job.Attempts,
+			"next_run_at", nextRunAt,
+			"error", jobErr)
+		err = w.Queue.Retry(ctx, job, jobErr, nextRunAt)
+	}
+	return
+}
+
+// backoff returns BaseBackoff * 2^(attempts-1), capped at MaxBackoff.
+func (w *Worker) backoff(attempts int) time.Duration {
+	d := w.BaseBackoff
+	for i := 1; i < attempts && d < w.MaxBackoff; i++ {
+		d *= 2
+	}
+	return min(d, w.MaxBackoff)
+}
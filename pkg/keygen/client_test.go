@@ -0,0 +1,376 @@
+package keygen_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/authgear/authgear-once-license-server/pkg/keygen"
+	"github.com/authgear/authgear-once-license-server/pkg/keygen/keygentest"
+)
+
+func newTestClient(t *testing.T, policies ...keygentest.Policy) (*keygen.Client, *keygentest.Server) {
+	t.Helper()
+	server := keygentest.NewServer(policies...)
+	t.Cleanup(server.Close)
+	return keygen.NewClient(server.Client(), server.Config()), server
+}
+
+func TestClientActivationFlow(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2025, 5, 1, 0, 0, 0, 0, time.UTC)
+	c, server := newTestClient(t, keygentest.Policy{
+		ID:          "policy-1y",
+		MaxMachines: 1,
+		Duration:    365 * 24 * time.Hour,
+	})
+	server.Now = func() time.Time { return now }
+
+	licenseKey, err := c.CreateLicenseKey(ctx, keygen.CreateLicenseKeyOptions{
+		PolicyID:                "policy-1y",
+		StripeCheckoutSessionID: "cs_1",
+		StripeCustomerID:        "cus_1",
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	fg1 := keygen.LicenseOptions{LicenseKey: licenseKey, Fingerprint: "fg1"}
+	fg2 := keygen.LicenseOptions{LicenseKey: licenseKey, Fingerprint: "fg2"}
+
+	licenseID, err := c.CheckLicense(ctx, fg1)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if licenseID.IsActivated || licenseID.ExpireAt != nil {
+		t.Errorf("expected license pending activation, got %+v", licenseID)
+	}
+	if licenseID.StripeCustomerID != "cus_1" {
+		t.Errorf("expected stripe customer ID, got %v", licenseID.StripeCustomerID)
+	}
+
+	licenseID, err = c.ActivateLicense(ctx, fg1)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	expectedExpiry := now.Add(365 * 24 * time.Hour)
+	if !licenseID.IsActivated || licenseID.ExpireAt == nil || !licenseID.ExpireAt.Equal(expectedExpiry) {
+		t.Errorf("expected license activated until %v, got %+v", expectedExpiry, licenseID)
+	}
+
+	// Activating the same fingerprint is idempotent.
+	_, err = c.ActivateLicense(ctx, fg1)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	_, err = c.ActivateLicense(ctx, fg2)
+	if !errors.Is(err, keygen.ErrLicenseKeyAlreadyActivated) {
+		t.Errorf("expected ErrLicenseKeyAlreadyActivated, got %v", err)
+	}
+
+	_, err = c.DeactivateLicense(ctx, fg2)
+	if !errors.Is(err, keygen.ErrMachineNotFound) {
+		t.Errorf("expected ErrMachineNotFound, got %v", err)
+	}
+
+	licenseID, err = c.DeactivateLicense(ctx, fg1)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if licenseID.IsActivated {
+		t.Errorf("expected license deactivated, got %+v", licenseID)
+	}
+
+	_, err = c.DeactivateLicense(ctx, fg1)
+	if !errors.Is(err, keygen.ErrLicenseKeyNotActivated) {
+		t.Errorf("expected ErrLicenseKeyNotActivated, got %v", err)
+	}
+
+	// The license can be moved to another machine after deactivation.
+	_, err = c.ActivateLicense(ctx, fg2)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	now = expectedExpiry
+	licenseID, err = c.CheckLicense(ctx, fg2)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if !licenseID.IsExpired {
+		t.Errorf("expected license expired, got %+v", licenseID)
+	}
+}
+
+func TestClientActivateMultipleMachines(t *testing.T) {
+	ctx := context.Background()
+	c, server := newTestClient(t, keygentest.Policy{ID: "policy-2", MaxMachines: 2})
+	l := server.AddLicense(keygentest.License{PolicyID: "policy-2"})
+
+	for _, fingerprint := range []string{"fg1", "fg2"} {
+		licenseID, err := c.ActivateLicense(ctx, keygen.LicenseOptions{LicenseKey: l.Key, Fingerprint: fingerprint})
+		if err != nil {
+			t.Fatalf("%v: expected no error, got %v", fingerprint, err)
+		}
+		if !licenseID.IsActivated || licenseID.ID != l.ID {
+			t.Errorf("%v: expected license activated, got %+v", fingerprint, licenseID)
+		}
+	}
+
+	_, err := c.ActivateLicense(ctx, keygen.LicenseOptions{LicenseKey: l.Key, Fingerprint: "fg3"})
+	if !errors.Is(err, keygen.ErrLicenseKeyAlreadyActivated) {
+		t.Errorf("expected ErrLicenseKeyAlreadyActivated, got %v", err)
+	}
+	if got := len(server.ListMachines(l.ID)); got != 2 {
+		t.Errorf("expected 2 machines, got %v", got)
+	}
+
+	// Both machines can check the license.
+	for _, fingerprint := range []string{"fg1", "fg2"} {
+		_, err := c.CheckLicense(ctx, keygen.LicenseOptions{LicenseKey: l.Key, Fingerprint: fingerprint})
+		if err != nil {
+			t.Errorf("%v: expected no error, got %v", fingerprint, err)
+		}
+	}
+}
+
+func TestClientActivateUnknownLicenseKey(t *testing.T) {
+	c, _ := newTestClient(t)
+
+	_, err := c.ActivateLicense(context.Background(), keygen.LicenseOptions{LicenseKey: "KEY-unknown", Fingerprint: "fg1"})
+	if !errors.Is(err, keygen.ErrLicenseKeyNotFound) {
+		t.Errorf("expected ErrLicenseKeyNotFound, got %v", err)
+	}
+}
+
+func TestClientActivateMachineDetails(t *testing.T) {
+	c, server := newTestClient(t, keygentest.Policy{ID: "policy-1", MaxMachines: 1})
+	l := server.AddLicense(keygentest.License{PolicyID: "policy-1"})
+
+	_, err := c.ActivateLicense(context.Background(), keygen.LicenseOptions{
+		LicenseKey:  l.Key,
+		Fingerprint: "fg1",
+		Machine: &keygen.MachineDetails{
+			Hostname:    "auth.example.com",
+			OnceVersion: "v1.0.0",
+		},
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	machines := server.ListMachines(l.ID)
+	if len(machines) != 1 {
+		t.Fatalf("expected 1 machine, got %v", len(machines))
+	}
+	attrs := machines[0].Attributes
+	if attrs.Hostname != "auth.example.com" || attrs.Metadata == nil || attrs.Metadata.OnceVersion != "v1.0.0" {
+		t.Errorf("unexpected machine attributes %+v", attrs)
+	}
+}
+
+func TestClientLicenseLifecycle(t *testing.T) {
+	ctx := context.Background()
+	c, _ := newTestClient(t, keygentest.Policy{
+		ID:          "policy-1y",
+		MaxMachines: 1,
+		Duration:    365 * 24 * time.Hour,
+	})
+
+	licenseKey, err := c.CreateLicenseKey(ctx, keygen.CreateLicenseKeyOptions{
+		PolicyID:                "policy-1y",
+		StripeCheckoutSessionID: "cs_1",
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	license, err := c.GetLicenseByStripeCheckoutSessionID(ctx, keygen.GetLicenseByStripeCheckoutSessionIDOptions{
+		StripeCheckoutSessionID: "cs_1",
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if license.Key != licenseKey {
+		t.Errorf("expected license key %v, got %v", licenseKey, license.Key)
+	}
+
+	_, err = c.GetLicenseByStripeCheckoutSessionID(ctx, keygen.GetLicenseByStripeCheckoutSessionIDOptions{
+		StripeCheckoutSessionID: "cs_2",
+	})
+	if !errors.Is(err, keygen.ErrLicenseKeyNotFound) {
+		t.Errorf("expected ErrLicenseKeyNotFound, got %v", err)
+	}
+
+	err = c.SuspendLicense(ctx, keygen.LicenseActionOptions{LicenseID: license.ID})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	_, err = c.CheckLicense(ctx, keygen.LicenseOptions{LicenseKey: licenseKey, Fingerprint: "fg1"})
+	if !errors.Is(err, keygen.ErrLicenseSuspended) {
+		t.Errorf("expected ErrLicenseSuspended, got %v", err)
+	}
+	err = c.ReinstateLicense(ctx, keygen.LicenseActionOptions{LicenseID: license.ID})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	_, err = c.ActivateLicense(ctx, keygen.LicenseOptions{LicenseKey: licenseKey, Fingerprint: "fg1"})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	license, err = c.GetLicense(ctx, keygen.GetLicenseOptions{LicenseIDOrKey: licenseKey})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	expiry := *license.Expiry
+
+	license, err = c.RenewLicense(ctx, keygen.LicenseActionOptions{LicenseID: license.ID})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if !license.Expiry.Equal(expiry.Add(365 * 24 * time.Hour)) {
+		t.Errorf("expected expiry to be extended by 1 year, got %v", license.Expiry)
+	}
+
+	metadata := license.Metadata
+	metadata.LastRenewalStripeCheckoutSessionID = "cs_renew"
+	license, err = c.UpdateLicenseMetadata(ctx, keygen.UpdateLicenseMetadataOptions{
+		LicenseID: license.ID,
+		Metadata:  metadata,
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if license.Metadata.StripeCheckoutSessionID != "cs_1" || license.Metadata.LastRenewalStripeCheckoutSessionID != "cs_renew" {
+		t.Errorf("unexpected metadata %+v", license.Metadata)
+	}
+
+	err = c.SuspendLicense(ctx, keygen.LicenseActionOptions{LicenseID: "license-unknown"})
+	if !errors.Is(err, keygen.ErrLicenseKeyNotFound) {
+		t.Errorf("expected ErrLicenseKeyNotFound, got %v", err)
+	}
+}
+
+func TestClientListLicenses(t *testing.T) {
+	c, server := newTestClient(t)
+	// More than one page.
+	for i := range 150 {
+		server.AddLicense(keygentest.License{Key: fmt.Sprintf("KEY-%v", i)})
+	}
+
+	server.AddLicense(keygentest.License{Key: "KEY-OTHER", PolicyID: "other-policy"})
+
+	licenses, err := c.ListLicenses(context.Background(), keygen.ListLicensesOptions{})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(licenses) != 151 {
+		t.Fatalf("expected 151 licenses, got %v", len(licenses))
+	}
+	if licenses[149].Key != "KEY-149" {
+		t.Errorf("expected license KEY-149, got %v", licenses[149].Key)
+	}
+
+	licenses, err = c.ListLicenses(context.Background(), keygen.ListLicensesOptions{PolicyID: "other-policy"})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(licenses) != 1 || licenses[0].Key != "KEY-OTHER" {
+		t.Errorf("expected only KEY-OTHER, got %v", licenses)
+	}
+}
+
+// countingTransport counts the machines created.
+type countingTransport struct {
+	http.RoundTripper
+	createMachine atomic.Int32
+}
+
+func (t *countingTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	if r.Method == "POST" && r.URL.Path == "/v1/machines" {
+		t.createMachine.Add(1)
+	}
+	return t.RoundTripper.RoundTrip(r)
+}
+
+func TestClientConcurrentActivations(t *testing.T) {
+	const n = 20
+
+	tests := []struct {
+		name                  string
+		fingerprint           func(i int) string
+		expectedSuccesses     int
+		expectedCreateMachine int32
+	}{
+		{
+			name:                  "same fingerprint",
+			fingerprint:           func(i int) string { return "fg" },
+			expectedSuccesses:     n,
+			expectedCreateMachine: 1,
+		},
+		{
+			name:        "different fingerprints",
+			fingerprint: func(i int) string { return fmt.Sprintf("fg%v", i) },
+			// Every fingerprint tries to create a machine, as the policy decides how many machines are allowed.
+			// Keygen rejects all but the first with MACHINE_LIMIT_EXCEEDED.
+			expectedSuccesses:     1,
+			expectedCreateMachine: n,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := keygentest.NewServer(keygentest.Policy{ID: "policy-1", MaxMachines: 1})
+			defer server.Close()
+			l := server.AddLicense(keygentest.License{PolicyID: "policy-1"})
+
+			transport := &countingTransport{RoundTripper: server.Client().Transport}
+			c := keygen.NewClient(&http.Client{Transport: transport}, server.Config())
+
+			var wg sync.WaitGroup
+			start := make(chan struct{})
+			errs := make([]error, n)
+			for i := range n {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					<-start
+					_, errs[i] = c.ActivateLicense(context.Background(), keygen.LicenseOptions{
+						LicenseKey:  l.Key,
+						Fingerprint: tt.fingerprint(i),
+					})
+				}()
+			}
+			close(start)
+			wg.Wait()
+
+			successes := 0
+			for _, err := range errs {
+				switch {
+				case err == nil:
+					successes++
+				case errors.Is(err, keygen.ErrLicenseKeyAlreadyActivated):
+					break
+				default:
+					t.Errorf("expected no error or ErrLicenseKeyAlreadyActivated, got %v", err)
+				}
+			}
+			if successes != tt.expectedSuccesses {
+				t.Errorf("expected %v successes, got %v", tt.expectedSuccesses, successes)
+			}
+			if got := transport.createMachine.Load(); got != tt.expectedCreateMachine {
+				t.Errorf("expected %v machines created, got %v", tt.expectedCreateMachine, got)
+			}
+			if got := len(server.ListMachines(l.ID)); got != 1 {
+				t.Errorf("expected 1 machine, got %v", got)
+			}
+		})
+	}
+}
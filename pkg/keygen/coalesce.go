@@ -0,0 +1,128 @@
+package keygen
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// activationTimeout is the timeout of an activation shared by concurrent callers.
+// An activation makes a few requests to Keygen, each of which is retried, so it is longer than DefaultTimeout.
+var activationTimeout = time.Minute
+
+// activationCoordinator coordinates concurrent activations within a process.
+// Activations of the same license key, fingerprint and machine details share a single call to Keygen.
+// Other activations of the same license key run one at a time,
+// so that exactly one of them wins and the others see the license already activated.
+// In particular, an activation with different machine details does not share the call,
+// because the machine it creates would not have its details.
+type activationCoordinator struct {
+	flights singleflight.Group
+
+	mu    sync.Mutex
+	locks map[string]*keyLock
+}
+
+type activationKey struct {
+	LicenseKey  string
+	Fingerprint string
+	Machine     *MachineDetails
+}
+
+func (k activationKey) String() string {
+	machine := ""
+	if k.Machine != nil {
+		machine = fmt.Sprintf("%q\x00%q\x00%d\x00%q", k.Machine.Hostname, k.Machine.Platform, k.Machine.Cores, k.Machine.OnceVersion)
+	}
+	return k.LicenseKey + "\x00" + k.Fingerprint + "\x00" + machine
+}
+
+// keyLock is a lock that can be abandoned when the context is done.
+// refs counts the holders and waiters, so that the lock is dropped when nobody uses it.
+type keyLock struct {
+	ch   chan struct{}
+	refs int
+}
+
+func newActivationCoordinator() *activationCoordinator {
+	return &activationCoordinator{
+		locks: map[string]*keyLock{},
+	}
+}
+
+// do calls fn, unless an identical activation is in flight, in which case it waits for its result.
+// fn is called with the license key locked.
+// The shared call is not canceled when the caller that started it goes away,
+// so that the result of the other callers does not depend on it.
+// Instead, it runs with activationTimeout.
+func (a *activationCoordinator) do(ctx context.Context, key activationKey, fn func(ctx context.Context) (*LicenseID, error)) (licenseID *LicenseID, err error) {
+	ch := a.flights.DoChan(key.String(), func() (any, error) {
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), activationTimeout)
+		defer cancel()
+
+		unlock, err := a.lock(ctx, key.LicenseKey)
+		if err != nil {
+			return nil, err
+		}
+		defer unlock()
+
+		return fn(ctx)
+	})
+
+	select {
+	case <-ctx.Done():
+		err = ctx.Err()
+		return
+	case result := <-ch:
+		shared, _ := result.Val.(*LicenseID)
+		licenseID, err = copyLicenseID(shared), result.Err
+		return
+	}
+}
+
+func (a *activationCoordinator) lock(ctx context.Context, licenseKey string) (unlock func(), err error) {
+	a.mu.Lock()
+	l, ok := a.locks[licenseKey]
+	if !ok {
+		l = &keyLock{ch: make(chan struct{}, 1)}
+		a.locks[licenseKey] = l
+	}
+	l.refs++
+	a.mu.Unlock()
+
+	release := func() {
+		a.mu.Lock()
+		l.refs--
+		if l.refs == 0 {
+			delete(a.locks, licenseKey)
+		}
+		a.mu.Unlock()
+	}
+
+	select {
+	case <-ctx.Done():
+		release()
+		err = ctx.Err()
+		return
+	case l.ch <- struct{}{}:
+	}
+
+	unlock = func() {
+		<-l.ch
+		release()
+	}
+	return
+}
+
+// copyLicenseID returns a shallow copy of licenseID,
+// so that the callers sharing an activation can modify their result independently.
+func copyLicenseID(licenseID *LicenseID) *LicenseID {
+	if licenseID == nil {
+		return nil
+	}
+	cp := *licenseID
+	return &cp
+}
@@ -0,0 +1,150 @@
+package keygen
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestActivationCoordinatorContextCanceled(t *testing.T) {
+	a := newActivationCoordinator()
+	key := activationKey{LicenseKey: "KEY-1", Fingerprint: "fg1"}
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_, _ = a.do(context.Background(), key, func(ctx context.Context) (*LicenseID, error) {
+			close(started)
+			<-release
+			return &LicenseID{ID: "license-1"}, nil
+		})
+	}()
+	<-started
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// Waiting for the in-flight activation is abandoned.
+	_, err := a.do(ctx, key, nil)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+
+	// Waiting for the lock of the license key is abandoned.
+	called := make(chan struct{})
+	_, err = a.do(ctx, activationKey{LicenseKey: "KEY-1", Fingerprint: "fg2"}, func(ctx context.Context) (*LicenseID, error) {
+		close(called)
+		return nil, nil
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+
+	close(release)
+	<-done
+	// The abandoned activation still runs after the lock is released.
+	<-called
+}
+
+func TestActivationCoordinatorLeaderCanceled(t *testing.T) {
+	a := newActivationCoordinator()
+	key := activationKey{LicenseKey: "KEY-1", Fingerprint: "fg1"}
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	leaderCtx, cancelLeader := context.WithCancel(context.Background())
+	leaderDone := make(chan error)
+	go func() {
+		_, err := a.do(leaderCtx, key, func(ctx context.Context) (*LicenseID, error) {
+			close(started)
+			<-release
+			// The shared call is not canceled with the leader.
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+			return &LicenseID{ID: "license-1"}, nil
+		})
+		leaderDone <- err
+	}()
+	<-started
+
+	followerDone := make(chan struct{})
+	var licenseID *LicenseID
+	var err error
+	go func() {
+		defer close(followerDone)
+		// The follower normally joins the activation of the leader.
+		// If it does not join in time, it activates by itself with the same result.
+		licenseID, err = a.do(context.Background(), key, func(ctx context.Context) (*LicenseID, error) {
+			return &LicenseID{ID: "license-1"}, nil
+		})
+	}()
+	time.Sleep(10 * time.Millisecond)
+
+	// The client of the leader disconnects.
+	cancelLeader()
+	if err := <-leaderDone; !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+
+	close(release)
+	<-followerDone
+	if err != nil || licenseID == nil || licenseID.ID != "license-1" {
+		t.Errorf("expected the follower to get the result, got %v, %v", licenseID, err)
+	}
+}
+
+func TestActivationCoordinatorMachineDetails(t *testing.T) {
+	a := newActivationCoordinator()
+	machine1 := &MachineDetails{Hostname: "host-1", Platform: "linux/amd64", Cores: 4}
+	machine2 := &MachineDetails{Hostname: "host-2", Platform: "linux/amd64", Cores: 4}
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	leaderDone := make(chan struct{})
+	go func() {
+		defer close(leaderDone)
+		_, _ = a.do(context.Background(), activationKey{LicenseKey: "KEY-1", Fingerprint: "fg1", Machine: machine1}, func(ctx context.Context) (*LicenseID, error) {
+			close(started)
+			<-release
+			return &LicenseID{ID: "license-1"}, nil
+		})
+	}()
+	<-started
+
+	// The same machine details share the in-flight activation.
+	sameDone := make(chan error)
+	go func() {
+		_, err := a.do(context.Background(), activationKey{LicenseKey: "KEY-1", Fingerprint: "fg1", Machine: &MachineDetails{Hostname: "host-1", Platform: "linux/amd64", Cores: 4}}, func(ctx context.Context) (*LicenseID, error) {
+			return nil, errors.New("unexpected call")
+		})
+		sameDone <- err
+	}()
+
+	// Different machine details activate by themselves after the in-flight activation.
+	var called bool
+	differentDone := make(chan error)
+	go func() {
+		_, err := a.do(context.Background(), activationKey{LicenseKey: "KEY-1", Fingerprint: "fg1", Machine: machine2}, func(ctx context.Context) (*LicenseID, error) {
+			called = true
+			return &LicenseID{ID: "license-1"}, nil
+		})
+		differentDone <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+
+	close(release)
+	<-leaderDone
+	if err := <-sameDone; err != nil {
+		t.Errorf("expected the same machine details to share the activation, got %v", err)
+	}
+	if err := <-differentDone; err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if !called {
+		t.Errorf("expected different machine details to activate by themselves")
+	}
+}
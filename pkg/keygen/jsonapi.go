@@ -0,0 +1,124 @@
+package keygen
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"time"
+)
+
+// JSONAPIDocument is a JSON:API top-level document.
+// See https://jsonapi.org/format/#document-top-level
+type JSONAPIDocument[D any, M any] struct {
+	Data   D              `json:"data,omitzero"`
+	Errors []JSONAPIError `json:"errors,omitempty"`
+	Meta   M              `json:"meta,omitzero"`
+}
+
+// JSONAPIResource is a JSON:API resource object.
+// See https://jsonapi.org/format/#document-resource-objects
+type JSONAPIResource[A any] struct {
+	ID            string                         `json:"id,omitempty"`
+	Type          string                         `json:"type"`
+	Attributes    A                              `json:"attributes"`
+	Relationships map[string]JSONAPIRelationship `json:"relationships,omitempty"`
+}
+
+// JSONAPIRelationship is a JSON:API relationship object.
+// Keygen always includes "links", but we only care about "data".
+type JSONAPIRelationship struct {
+	Data *JSONAPIResourceIdentifier `json:"data,omitempty"`
+}
+
+// JSONAPIResourceIdentifier is a JSON:API resource identifier object.
+type JSONAPIResourceIdentifier struct {
+	Type string `json:"type"`
+	ID   string `json:"id"`
+}
+
+// JSONAPIError is a JSON:API error object.
+// See https://jsonapi.org/format/#error-objects
+type JSONAPIError struct {
+	Title  string              `json:"title,omitempty"`
+	Detail string              `json:"detail,omitempty"`
+	Code   string              `json:"code,omitempty"`
+	Source *JSONAPIErrorSource `json:"source,omitempty"`
+}
+
+type JSONAPIErrorSource struct {
+	Pointer   string `json:"pointer,omitempty"`
+	Parameter string `json:"parameter,omitempty"`
+}
+
+// LicenseMetadata is the metadata we attach to a license.
+// Keygen transforms metadata keys to camel case, so we use camel case in both requests and responses.
+type LicenseMetadata struct {
+	StripeCheckoutSessionID string `json:"stripeCheckoutSessionId,omitempty"`
+	StripeCustomerID        string `json:"stripeCustomerId,omitempty"`
+	// LicenseeEmail is the email of the Stripe customer at issuance.
+	// Licenses issued before it was introduced do not have it until they are backfilled.
+	LicenseeEmail string `json:"licenseeEmail,omitempty"`
+	// LastRenewalStripeCheckoutSessionID is the checkout session that renewed the license most recently.
+	// It is recorded before the license is renewed, together with LastRenewalPreviousExpiry.
+	LastRenewalStripeCheckoutSessionID string `json:"lastRenewalStripeCheckoutSessionId,omitempty"`
+	// LastRenewalPreviousExpiry is the expiry of the license before LastRenewalStripeCheckoutSessionID renewed it.
+	// A retried webhook renews the license only if the expiry is still the same,
+	// so that the license is renewed exactly once for a checkout session.
+	LastRenewalPreviousExpiry *time.Time `json:"lastRenewalPreviousExpiry,omitempty"`
+}
+
+// LicenseAttributes is the subset of the attributes of a license we use.
+// See https://keygen.sh/docs/api/licenses/#licenses-object
+type LicenseAttributes struct {
+	Key       string           `json:"key,omitempty"`
+	Expiry    *time.Time       `json:"expiry,omitempty"`
+	Status    string           `json:"status,omitempty"`
+	Suspended bool             `json:"suspended,omitempty"`
+	Metadata  *LicenseMetadata `json:"metadata,omitempty"`
+}
+
+// MachineAttributes is the subset of the attributes of a machine we use.
+// See https://keygen.sh/docs/api/machines/#machines-object
+type MachineAttributes struct {
+	Fingerprint string           `json:"fingerprint"`
+	Hostname    string           `json:"hostname,omitempty"`
+	Platform    string           `json:"platform,omitempty"`
+	Cores       int              `json:"cores,omitempty"`
+	Metadata    *MachineMetadata `json:"metadata,omitempty"`
+}
+
+// MachineMetadata is the metadata we attach to a machine.
+type MachineMetadata struct {
+	OnceVersion string `json:"onceVersion,omitempty"`
+}
+
+// ValidateKeyRequestMeta is the meta of the request body of validate-key.
+// See https://keygen.sh/docs/api/licenses/#licenses-actions-validate-key
+type ValidateKeyRequestMeta struct {
+	Key   string                  `json:"key"`
+	Scope ValidateKeyRequestScope `json:"scope"`
+}
+
+type ValidateKeyRequestScope struct {
+	Fingerprint string `json:"fingerprint,omitempty"`
+}
+
+// ValidateKeyResponseMeta is the meta of the response body of validate-key.
+type ValidateKeyResponseMeta struct {
+	Valid  bool   `json:"valid"`
+	Detail string `json:"detail"`
+	Code   string `json:"code"`
+}
+
+// decodeJSONAPIDocument decodes r as a JSON:API document.
+// A body of an unexpected shape results in ErrUnexpectedResponse, instead of a panic.
+func decodeJSONAPIDocument[D any, M any](r io.Reader) (doc *JSONAPIDocument[D, M], err error) {
+	var d JSONAPIDocument[D, M]
+	err = json.NewDecoder(r).Decode(&d)
+	if err != nil {
+		err = errors.Join(err, ErrUnexpectedResponse)
+		return
+	}
+	doc = &d
+	return
+}
@@ -8,16 +8,30 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"maps"
 	"net/http"
 	"net/http/httputil"
 	"net/url"
+	"strconv"
 	"time"
 )
 
 var ErrUnexpectedResponse = errors.New("unexpected response")
 var ErrLicenseKeyNotFound = errors.New("license key not found")
 var ErrLicenseKeyAlreadyActivated = errors.New("license key already activated")
+var ErrLicenseKeyNotActivated = errors.New("license key not activated")
+var ErrMachineNotFound = errors.New("machine not found")
+var ErrLicenseSuspended = errors.New("license suspended")
+var ErrLicenseBanned = errors.New("license banned")
+var ErrLicenseOverdue = errors.New("license overdue")
+var ErrLicenseTooManyMachines = errors.New("license has too many machines")
+var ErrLicenseScopeMismatch = errors.New("license scope mismatch")
 
+// ErrLicenseInvalid is for validation codes that we do not handle specifically.
+var ErrLicenseInvalid = errors.New("license invalid")
+
+// KeygenResponseError carries the response that caused an error.
+// It ends up in logs and Sentry, so DumpedResponse is redacted unless KeygenConfig.DebugRawResponse is true.
 type KeygenResponseError struct {
 	DumpedResponse []byte
 }
@@ -26,38 +40,114 @@ func (e *KeygenResponseError) Error() string {
 	return fmt.Sprintf("keygen response: %v", base64.RawURLEncoding.EncodeToString(e.DumpedResponse))
 }
 
+// fingerprintScopeMismatchError is ErrLicenseKeyAlreadyActivated caused by FINGERPRINT_SCOPE_MISMATCH.
+// It means the license is activated, but not on the fingerprint.
+// It carries the license ID, so that activation can create a machine for the fingerprint
+// when the policy allows more than one machine.
+type fingerprintScopeMismatchError struct {
+	LicenseID string
+}
+
+func (e *fingerprintScopeMismatchError) Error() string {
+	return ErrLicenseKeyAlreadyActivated.Error()
+}
+
+func (e *fingerprintScopeMismatchError) Is(target error) bool {
+	return target == ErrLicenseKeyAlreadyActivated
+}
+
 type KeygenConfig struct {
 	Endpoint   string
 	AdminToken string
-	PolicyID   string
+	// Timeout is the timeout of each attempt of a request to Keygen.
+	// 0 means no timeout.
+	Timeout time.Duration
+	// MaxRetries is the maximum number of retries of a request that only reads from Keygen.
+	MaxRetries int
+	// CircuitBreakerThreshold is the number of consecutive failures to open the circuit breaker.
+	// 0 disables the circuit breaker.
+	CircuitBreakerThreshold int
+	// CircuitBreakerCooldown is how long the circuit breaker stays open before it probes Keygen again.
+	CircuitBreakerCooldown time.Duration
+	// DebugRawResponse keeps license keys and customer information in KeygenResponseError.
+	// It MUST NOT be enabled in production.
+	DebugRawResponse bool
+}
+
+// LicenseBackend is the set of license operations the HTTP handlers depend on.
+type LicenseBackend interface {
+	CreateLicenseKey(ctx context.Context, opts CreateLicenseKeyOptions) (licenseKey string, err error)
+	GetLicenseByStripeCheckoutSessionID(ctx context.Context, opts GetLicenseByStripeCheckoutSessionIDOptions) (license *License, err error)
+	SuspendLicense(ctx context.Context, opts LicenseActionOptions) (err error)
+	ReinstateLicense(ctx context.Context, opts LicenseActionOptions) (err error)
+	RenewLicense(ctx context.Context, opts LicenseActionOptions) (license *License, err error)
+	GetLicense(ctx context.Context, opts GetLicenseOptions) (license *License, err error)
+	UpdateLicenseMetadata(ctx context.Context, opts UpdateLicenseMetadataOptions) (license *License, err error)
+	ValidateLicenseKey(ctx context.Context, opts LicenseOptions) (licenseID *LicenseID, err error)
+	ActivateLicense(ctx context.Context, opts LicenseOptions) (licenseID *LicenseID, err error)
+	CheckLicense(ctx context.Context, opts LicenseOptions) (licenseID *LicenseID, err error)
+	DeactivateLicense(ctx context.Context, opts LicenseOptions) (licenseID *LicenseID, err error)
+}
+
+// Client implements LicenseBackend with the Keygen API.
+type Client struct {
+	HTTPClient *http.Client
+	Config     KeygenConfig
+
+	breaker     *circuitBreaker
+	activations *activationCoordinator
+}
+
+var _ LicenseBackend = (*Client)(nil)
+
+func NewClient(httpClient *http.Client, config KeygenConfig) *Client {
+	c := &Client{
+		HTTPClient:  httpClient,
+		Config:      config,
+		activations: newActivationCoordinator(),
+	}
+	if config.CircuitBreakerThreshold > 0 {
+		c.breaker = newCircuitBreaker(config.CircuitBreakerThreshold, config.CircuitBreakerCooldown)
+	}
+	return c
+}
+
+func (c *Client) newKeygenResponseError(dumpedResponse []byte) *KeygenResponseError {
+	if !c.Config.DebugRawResponse {
+		dumpedResponse = RedactDumpedResponse(dumpedResponse)
+	}
+	return &KeygenResponseError{DumpedResponse: dumpedResponse}
 }
 
 type CreateLicenseKeyOptions struct {
-	KeygenConfig            KeygenConfig
+	// PolicyID is the policy of the license, which is determined by the purchased plan.
+	PolicyID                string
 	StripeCheckoutSessionID string
 	StripeCustomerID        string
+	LicenseeEmail           string
 }
 
-func CreateLicenseKey(ctx context.Context, client *http.Client, opts CreateLicenseKeyOptions) (licenseKey string, err error) {
-	u, err := url.JoinPath(opts.KeygenConfig.Endpoint, "/v1/licenses")
+func (c *Client) CreateLicenseKey(ctx context.Context, opts CreateLicenseKeyOptions) (licenseKey string, err error) {
+	u, err := url.JoinPath(c.Config.Endpoint, "/v1/licenses")
 	if err != nil {
 		return
 	}
 
-	reqBody := map[string]any{
-		"data": map[string]any{
-			"type": "license",
-			"attributes": map[string]any{
-				"metadata": map[string]any{
-					"stripe_checkout_session_id": opts.StripeCheckoutSessionID,
-					"stripe_customer_id":         opts.StripeCustomerID,
+	reqBody := JSONAPIDocument[*JSONAPIResource[LicenseAttributes], any]{
+		Data: &JSONAPIResource[LicenseAttributes]{
+			Type: "license",
+			Attributes: LicenseAttributes{
+				Metadata: &LicenseMetadata{
+					StripeCheckoutSessionID: opts.StripeCheckoutSessionID,
+					StripeCustomerID:        opts.StripeCustomerID,
+					LicenseeEmail:           opts.LicenseeEmail,
 				},
 			},
-			"relationships": map[string]any{
-				"policy": map[string]any{
-					"data": map[string]any{
-						"type": "policy",
-						"id":   opts.KeygenConfig.PolicyID,
+			Relationships: map[string]JSONAPIRelationship{
+				"policy": {
+					Data: &JSONAPIResourceIdentifier{
+						Type: "policy",
+						ID:   opts.PolicyID,
 					},
 				},
 			},
@@ -73,9 +163,9 @@ func CreateLicenseKey(ctx context.Context, client *http.Client, opts CreateLicen
 		return
 	}
 	patchRequest(req)
-	req.Header.Set("Authorization", fmt.Sprintf("Bearer %v", opts.KeygenConfig.AdminToken))
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %v", c.Config.AdminToken))
 
-	resp, err := client.Do(req)
+	resp, err := c.do(req, doOptions{})
 	if err != nil {
 		return
 	}
@@ -88,29 +178,522 @@ func CreateLicenseKey(ctx context.Context, client *http.Client, opts CreateLicen
 
 	defer func() {
 		if err != nil {
-			err = errors.Join(err, &KeygenResponseError{DumpedResponse: dumpedResponse})
+			err = errors.Join(err, c.newKeygenResponseError(dumpedResponse))
 		}
 	}()
 
 	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
-		var respBody map[string]any
-		err = json.NewDecoder(resp.Body).Decode(&respBody)
+		return parseCreateLicenseKeyResponseBody(resp.Body)
+	}
+
+	err = ErrUnexpectedResponse
+	return
+}
+
+func parseCreateLicenseKeyResponseBody(r io.Reader) (licenseKey string, err error) {
+	doc, err := decodeJSONAPIDocument[*JSONAPIResource[LicenseAttributes], any](r)
+	if err != nil {
+		return
+	}
+
+	if doc.Data == nil || doc.Data.Attributes.Key == "" {
+		err = ErrUnexpectedResponse
+		return
+	}
+
+	licenseKey = doc.Data.Attributes.Key
+	return
+}
+
+// License is a license as seen by the admin.
+type License struct {
+	ID        string
+	Key       string
+	PolicyID  string
+	Expiry    *time.Time
+	Suspended bool
+	Metadata  LicenseMetadata
+}
+
+func newLicense(data *JSONAPIResource[LicenseAttributes]) (license *License, err error) {
+	if data == nil || data.ID == "" || data.Attributes.Key == "" {
+		err = ErrUnexpectedResponse
+		return
+	}
+
+	license = &License{
+		ID:        data.ID,
+		Key:       data.Attributes.Key,
+		Expiry:    data.Attributes.Expiry,
+		Suspended: data.Attributes.Suspended,
+	}
+	if policy := data.Relationships["policy"].Data; policy != nil {
+		license.PolicyID = policy.ID
+	}
+	if data.Attributes.Metadata != nil {
+		license.Metadata = *data.Attributes.Metadata
+	}
+	return
+}
+
+func parseLicenseResponseBody(r io.Reader) (license *License, err error) {
+	doc, err := decodeJSONAPIDocument[*JSONAPIResource[LicenseAttributes], any](r)
+	if err != nil {
+		return
+	}
+
+	return newLicense(doc.Data)
+}
+
+type GetLicenseOptions struct {
+	// LicenseIDOrKey is either the ID or the key of the license.
+	LicenseIDOrKey string
+}
+
+// GetLicense returns the following errors:
+// - ErrUnexpectedResponse
+// - ErrServiceUnavailable
+// - ErrLicenseKeyNotFound
+func (c *Client) GetLicense(ctx context.Context, opts GetLicenseOptions) (license *License, err error) {
+	u, err := url.JoinPath(c.Config.Endpoint, "/v1/licenses", opts.LicenseIDOrKey)
+	if err != nil {
+		return
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", u, nil)
+	if err != nil {
+		return
+	}
+	patchRequest(req)
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %v", c.Config.AdminToken))
+
+	resp, err := c.do(req, doOptions{Retryable: true})
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+
+	dumpedResponse, err := httputil.DumpResponse(resp, true)
+	if err != nil {
+		return
+	}
+
+	defer func() {
 		if err != nil {
+			err = errors.Join(err, c.newKeygenResponseError(dumpedResponse))
+		}
+	}()
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return parseLicenseResponseBody(resp.Body)
+	case resp.StatusCode == http.StatusNotFound:
+		err = ErrLicenseKeyNotFound
+		return
+	default:
+		err = ErrUnexpectedResponse
+		return
+	}
+}
+
+// getLicenseMetadata returns the metadata of the license as is.
+// It returns the same errors as GetLicense.
+func (c *Client) getLicenseMetadata(ctx context.Context, licenseID string) (metadata map[string]any, err error) {
+	u, err := url.JoinPath(c.Config.Endpoint, "/v1/licenses", licenseID)
+	if err != nil {
+		return
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", u, nil)
+	if err != nil {
+		return
+	}
+	patchRequest(req)
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %v", c.Config.AdminToken))
+
+	resp, err := c.do(req, doOptions{Retryable: true})
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+
+	dumpedResponse, err := httputil.DumpResponse(resp, true)
+	if err != nil {
+		return
+	}
+
+	defer func() {
+		if err != nil {
+			err = errors.Join(err, c.newKeygenResponseError(dumpedResponse))
+		}
+	}()
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return parseLicenseMetadataResponseBody(resp.Body)
+	case resp.StatusCode == http.StatusNotFound:
+		err = ErrLicenseKeyNotFound
+		return
+	default:
+		err = ErrUnexpectedResponse
+		return
+	}
+}
+
+func parseLicenseMetadataResponseBody(r io.Reader) (metadata map[string]any, err error) {
+	doc, err := decodeJSONAPIDocument[*JSONAPIResource[licenseMetadataAttributes], any](r)
+	if err != nil {
+		return
+	}
+	if doc.Data == nil || doc.Data.ID == "" {
+		err = ErrUnexpectedResponse
+		return
+	}
+
+	metadata = doc.Data.Attributes.Metadata
+	if metadata == nil {
+		metadata = map[string]any{}
+	}
+	return
+}
+
+type UpdateLicenseMetadataOptions struct {
+	LicenseID string
+	// Metadata is merged into the metadata of the license.
+	// Fields of zero value are left unchanged, and so are the keys that LicenseMetadata does not model.
+	Metadata LicenseMetadata
+}
+
+// licenseMetadataAttributes holds the metadata of a license as is,
+// including the keys that LicenseMetadata does not model,
+// for example, keys added by hand or by an older version of the server.
+type licenseMetadataAttributes struct {
+	Metadata map[string]any `json:"metadata"`
+}
+
+// UpdateLicenseMetadata returns the following errors:
+// - ErrUnexpectedResponse
+// - ErrServiceUnavailable
+// - ErrLicenseKeyNotFound
+//
+// Keygen replaces the metadata of a license entirely on update,
+// so the metadata is read and merged with opts.Metadata before it is written.
+// A concurrent update of the same license between the read and the write is lost.
+func (c *Client) UpdateLicenseMetadata(ctx context.Context, opts UpdateLicenseMetadataOptions) (license *License, err error) {
+	metadata, err := c.getLicenseMetadata(ctx, opts.LicenseID)
+	if err != nil {
+		return
+	}
+	patch, err := json.Marshal(opts.Metadata)
+	if err != nil {
+		return
+	}
+	var patchMap map[string]any
+	err = json.Unmarshal(patch, &patchMap)
+	if err != nil {
+		return
+	}
+	maps.Copy(metadata, patchMap)
+
+	u, err := url.JoinPath(c.Config.Endpoint, "/v1/licenses", opts.LicenseID)
+	if err != nil {
+		return
+	}
+
+	reqBody := JSONAPIDocument[*JSONAPIResource[licenseMetadataAttributes], any]{
+		Data: &JSONAPIResource[licenseMetadataAttributes]{
+			Type: "license",
+			Attributes: licenseMetadataAttributes{
+				Metadata: metadata,
+			},
+		},
+	}
+	reqBodyBytes, err := json.Marshal(reqBody)
+	if err != nil {
+		return
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "PATCH", u, bytes.NewReader(reqBodyBytes))
+	if err != nil {
+		return
+	}
+	patchRequest(req)
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %v", c.Config.AdminToken))
+
+	resp, err := c.do(req, doOptions{})
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+
+	dumpedResponse, err := httputil.DumpResponse(resp, true)
+	if err != nil {
+		return
+	}
+
+	defer func() {
+		if err != nil {
+			err = errors.Join(err, c.newKeygenResponseError(dumpedResponse))
+		}
+	}()
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return parseLicenseResponseBody(resp.Body)
+	case resp.StatusCode == http.StatusNotFound:
+		err = ErrLicenseKeyNotFound
+		return
+	default:
+		err = ErrUnexpectedResponse
+		return
+	}
+}
+
+type GetLicenseByStripeCheckoutSessionIDOptions struct {
+	StripeCheckoutSessionID string
+}
+
+// GetLicenseByStripeCheckoutSessionID returns the following errors:
+// - ErrUnexpectedResponse
+// - ErrServiceUnavailable
+// - ErrLicenseKeyNotFound
+func (c *Client) GetLicenseByStripeCheckoutSessionID(ctx context.Context, opts GetLicenseByStripeCheckoutSessionIDOptions) (license *License, err error) {
+	u, err := url.JoinPath(c.Config.Endpoint, "/v1/licenses")
+	if err != nil {
+		return
+	}
+
+	q := url.Values{}
+	// Keygen stores metadata keys in camel case.
+	q.Set("metadata[stripeCheckoutSessionId]", opts.StripeCheckoutSessionID)
+	u = fmt.Sprintf("%v?%v", u, q.Encode())
+
+	req, err := http.NewRequestWithContext(ctx, "GET", u, nil)
+	if err != nil {
+		return
+	}
+	patchRequest(req)
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %v", c.Config.AdminToken))
+
+	resp, err := c.do(req, doOptions{Retryable: true})
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+
+	dumpedResponse, err := httputil.DumpResponse(resp, true)
+	if err != nil {
+		return
+	}
+
+	defer func() {
+		if err != nil {
+			err = errors.Join(err, c.newKeygenResponseError(dumpedResponse))
+		}
+	}()
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return parseGetLicenseByStripeCheckoutSessionIDResponseBody(resp.Body, opts.StripeCheckoutSessionID)
+	}
+
+	err = ErrUnexpectedResponse
+	return
+}
+
+func parseGetLicenseByStripeCheckoutSessionIDResponseBody(r io.Reader, stripeCheckoutSessionID string) (license *License, err error) {
+	doc, err := decodeJSONAPIDocument[[]JSONAPIResource[LicenseAttributes], any](r)
+	if err != nil {
+		return
+	}
+
+	if doc.Data == nil {
+		err = ErrUnexpectedResponse
+		return
+	}
+
+	for _, data := range doc.Data {
+		metadata := data.Attributes.Metadata
+		if metadata == nil {
+			continue
+		}
+		// Compare the metadata again in case the filter is ignored.
+		if metadata.StripeCheckoutSessionID == stripeCheckoutSessionID {
+			return newLicense(&data)
+		}
+	}
+
+	err = ErrLicenseKeyNotFound
+	return
+}
+
+// listLicensesPageSize is the maximum page size of Keygen.
+const listLicensesPageSize = 100
+
+type ListLicensesOptions struct {
+	// PolicyID limits the licenses to the policy, if it is non-empty.
+	PolicyID string
+}
+
+// ListLicenses returns all licenses, page by page.
+// It is for admin commands, so it is not part of LicenseBackend.
+// It returns the following errors:
+// - ErrUnexpectedResponse
+// - ErrServiceUnavailable
+func (c *Client) ListLicenses(ctx context.Context, opts ListLicensesOptions) (licenses []License, err error) {
+	for pageNumber := 1; ; pageNumber++ {
+		var page []License
+		page, err = c.listLicensesPage(ctx, opts, pageNumber)
+		if err != nil {
+			return
+		}
+		licenses = append(licenses, page...)
+		if len(page) < listLicensesPageSize {
 			return
 		}
+	}
+}
+
+func (c *Client) listLicensesPage(ctx context.Context, opts ListLicensesOptions, pageNumber int) (licenses []License, err error) {
+	u, err := url.JoinPath(c.Config.Endpoint, "/v1/licenses")
+	if err != nil {
+		return
+	}
+
+	q := url.Values{}
+	q.Set("page[number]", strconv.Itoa(pageNumber))
+	q.Set("page[size]", strconv.Itoa(listLicensesPageSize))
+	if opts.PolicyID != "" {
+		q.Set("policy", opts.PolicyID)
+	}
+	u = fmt.Sprintf("%v?%v", u, q.Encode())
+
+	req, err := http.NewRequestWithContext(ctx, "GET", u, nil)
+	if err != nil {
+		return
+	}
+	patchRequest(req)
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %v", c.Config.AdminToken))
+
+	resp, err := c.do(req, doOptions{Retryable: true})
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
 
-		licenseKey = respBody["data"].(map[string]any)["attributes"].(map[string]any)["key"].(string)
+	dumpedResponse, err := httputil.DumpResponse(resp, true)
+	if err != nil {
 		return
 	}
 
+	defer func() {
+		if err != nil {
+			err = errors.Join(err, c.newKeygenResponseError(dumpedResponse))
+		}
+	}()
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return parseListLicensesResponseBody(resp.Body)
+	}
+
 	err = ErrUnexpectedResponse
 	return
 }
 
-type validateLicenseKeyOptions struct {
-	KeygenConfig KeygenConfig
-	LicenseKey   string
-	Fingerprint  string
+func parseListLicensesResponseBody(r io.Reader) (licenses []License, err error) {
+	doc, err := decodeJSONAPIDocument[[]JSONAPIResource[LicenseAttributes], any](r)
+	if err != nil {
+		return
+	}
+
+	if doc.Data == nil {
+		err = ErrUnexpectedResponse
+		return
+	}
+
+	for _, data := range doc.Data {
+		var license *License
+		license, err = newLicense(&data)
+		if err != nil {
+			return
+		}
+		licenses = append(licenses, *license)
+	}
+	return
+}
+
+type LicenseActionOptions struct {
+	LicenseID string
+}
+
+// SuspendLicense returns the following errors:
+// - ErrUnexpectedResponse
+// - ErrServiceUnavailable
+// - ErrLicenseKeyNotFound
+func (c *Client) SuspendLicense(ctx context.Context, opts LicenseActionOptions) (err error) {
+	_, err = c.doLicenseAction(ctx, opts, "suspend")
+	return
+}
+
+// ReinstateLicense returns the following errors:
+// - ErrUnexpectedResponse
+// - ErrServiceUnavailable
+// - ErrLicenseKeyNotFound
+func (c *Client) ReinstateLicense(ctx context.Context, opts LicenseActionOptions) (err error) {
+	_, err = c.doLicenseAction(ctx, opts, "reinstate")
+	return
+}
+
+// RenewLicense extends the expiry of the license by the duration of its policy.
+// It returns the following errors:
+// - ErrUnexpectedResponse
+// - ErrServiceUnavailable
+// - ErrLicenseKeyNotFound
+func (c *Client) RenewLicense(ctx context.Context, opts LicenseActionOptions) (license *License, err error) {
+	return c.doLicenseAction(ctx, opts, "renew")
+}
+
+// doLicenseAction performs a license action that has no request body.
+// See https://keygen.sh/docs/api/licenses/#licenses-actions
+func (c *Client) doLicenseAction(ctx context.Context, opts LicenseActionOptions, action string) (license *License, err error) {
+	u, err := url.JoinPath(c.Config.Endpoint, "/v1/licenses", opts.LicenseID, "actions", action)
+	if err != nil {
+		return
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", u, nil)
+	if err != nil {
+		return
+	}
+	patchRequest(req)
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %v", c.Config.AdminToken))
+
+	resp, err := c.do(req, doOptions{})
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+
+	dumpedResponse, err := httputil.DumpResponse(resp, true)
+	if err != nil {
+		return
+	}
+
+	defer func() {
+		if err != nil {
+			err = errors.Join(err, c.newKeygenResponseError(dumpedResponse))
+		}
+	}()
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return parseLicenseResponseBody(resp.Body)
+	case resp.StatusCode == http.StatusNotFound:
+		err = ErrLicenseKeyNotFound
+		return
+	default:
+		err = ErrUnexpectedResponse
+		return
+	}
 }
 
 // LicenseID is an API object.
@@ -123,23 +706,35 @@ type LicenseID struct {
 	StripeCheckoutSessionID string  `json:"-"`
 	StripeCustomerID        string  `json:"-"`
 	LicenseeEmail           *string `json:"licensee_email"`
+
+	// Stale is true when Keygen is unavailable, and this is the last known status.
+	Stale bool `json:"stale,omitempty"`
+	// StaleAgeSeconds is how long ago the last known status was retrieved from Keygen.
+	StaleAgeSeconds *int64 `json:"stale_age_seconds,omitempty"`
 }
 
-// validateLicenseKey returns the following errors:
+// ValidateLicenseKey returns the following errors:
 // - ErrUnexpectedResponse
+// - ErrServiceUnavailable
 // - ErrLicenseKeyNotFound
 // - ErrLicenseKeyAlreadyActivated
-func validateLicenseKey(ctx context.Context, client *http.Client, opts validateLicenseKeyOptions) (licenseID *LicenseID, err error) {
-	u, err := url.JoinPath(opts.KeygenConfig.Endpoint, "/v1/licenses/actions/validate-key")
+// - ErrLicenseSuspended
+// - ErrLicenseBanned
+// - ErrLicenseOverdue
+// - ErrLicenseTooManyMachines
+// - ErrLicenseScopeMismatch
+// - ErrLicenseInvalid
+func (c *Client) ValidateLicenseKey(ctx context.Context, opts LicenseOptions) (licenseID *LicenseID, err error) {
+	u, err := url.JoinPath(c.Config.Endpoint, "/v1/licenses/actions/validate-key")
 	if err != nil {
 		return
 	}
 
-	reqBody := map[string]any{
-		"meta": map[string]any{
-			"key": opts.LicenseKey,
-			"scope": map[string]any{
-				"fingerprint": opts.Fingerprint,
+	reqBody := JSONAPIDocument[*JSONAPIResource[LicenseAttributes], ValidateKeyRequestMeta]{
+		Meta: ValidateKeyRequestMeta{
+			Key: opts.LicenseKey,
+			Scope: ValidateKeyRequestScope{
+				Fingerprint: opts.Fingerprint,
 			},
 		},
 	}
@@ -154,7 +749,7 @@ func validateLicenseKey(ctx context.Context, client *http.Client, opts validateL
 	patchRequest(req)
 	// This request is supposed to be called by anyone with the license key, so admin token is not needed.
 
-	resp, err := client.Do(req)
+	resp, err := c.do(req, doOptions{Retryable: true})
 	if err != nil {
 		return
 	}
@@ -167,7 +762,7 @@ func validateLicenseKey(ctx context.Context, client *http.Client, opts validateL
 
 	defer func() {
 		if err != nil {
-			err = errors.Join(err, &KeygenResponseError{DumpedResponse: dumpedResponse})
+			err = errors.Join(err, c.newKeygenResponseError(dumpedResponse))
 		}
 	}()
 
@@ -180,103 +775,111 @@ func validateLicenseKey(ctx context.Context, client *http.Client, opts validateL
 }
 
 func parseValidateLicenseKeyResponseBody(r io.Reader) (licenseID *LicenseID, err error) {
-	var respBody map[string]any
-	err = json.NewDecoder(r).Decode(&respBody)
+	doc, err := decodeJSONAPIDocument[*JSONAPIResource[LicenseAttributes], ValidateKeyResponseMeta](r)
 	if err != nil {
 		return
 	}
 
-	meta := respBody["meta"].(map[string]any)
-	meta_code := meta["code"].(string)
+	metaCode := doc.Meta.Code
 
-	if meta_code == "NOT_FOUND" {
+	if metaCode == "NOT_FOUND" {
 		err = ErrLicenseKeyNotFound
 		return
 	}
 
-	if meta_code == "FINGERPRINT_SCOPE_MISMATCH" {
-		err = ErrLicenseKeyAlreadyActivated
+	// See https://keygen.sh/docs/api/licenses/#licenses-actions-validate-key-validation-codes
+	switch metaCode {
+	case "FINGERPRINT_SCOPE_MISMATCH":
+		mismatchErr := &fingerprintScopeMismatchError{}
+		if doc.Data != nil {
+			mismatchErr.LicenseID = doc.Data.ID
+		}
+		err = mismatchErr
 		return
-	}
-
-	data, ok := respBody["data"].(map[string]any)
-	if !ok || data == nil {
-		err = ErrUnexpectedResponse
+	case "SUSPENDED":
+		err = ErrLicenseSuspended
 		return
-	}
-	attributes, ok := data["attributes"].(map[string]any)
-	if !ok {
-		err = ErrUnexpectedResponse
+	case "BANNED":
+		err = ErrLicenseBanned
+		return
+	case "OVERDUE":
+		err = ErrLicenseOverdue
+		return
+	case "TOO_MANY_MACHINES":
+		err = ErrLicenseTooManyMachines
+		return
+	case "PRODUCT_SCOPE_MISMATCH", "POLICY_SCOPE_MISMATCH":
+		err = fmt.Errorf("%w: %v", ErrLicenseScopeMismatch, metaCode)
 		return
 	}
 
-	licenseID = &LicenseID{
-		ID: data["id"].(string),
+	data := doc.Data
+	if data == nil || data.ID == "" {
+		err = ErrUnexpectedResponse
+		return
 	}
 
-	if expiry, ok := attributes["expiry"].(string); ok {
-		var expireAt time.Time
-		expireAt, err = time.Parse(time.RFC3339, expiry)
-		if err != nil {
-			err = errors.Join(err, ErrUnexpectedResponse)
-			return
-		}
-		licenseID.ExpireAt = &expireAt
+	l := &LicenseID{
+		ID:       data.ID,
+		ExpireAt: data.Attributes.Expiry,
 	}
-	if metadata, ok := attributes["metadata"].(map[string]any); ok {
-		if stripeCheckoutSessionID, ok := metadata["stripeCheckoutSessionId"].(string); ok {
-			licenseID.StripeCheckoutSessionID = stripeCheckoutSessionID
-		}
-		if stripeCustomerID, ok := metadata["stripeCustomerId"].(string); ok {
-			licenseID.StripeCustomerID = stripeCustomerID
+	if metadata := data.Attributes.Metadata; metadata != nil {
+		l.StripeCheckoutSessionID = metadata.StripeCheckoutSessionID
+		l.StripeCustomerID = metadata.StripeCustomerID
+		if metadata.LicenseeEmail != "" {
+			email := metadata.LicenseeEmail
+			l.LicenseeEmail = &email
 		}
 	}
 
-	switch meta_code {
+	switch metaCode {
 	case "VALID":
-		licenseID.IsActivated = true
-		licenseID.IsExpired = false
+		l.IsActivated = true
+		l.IsExpired = false
 	case "EXPIRED":
-		licenseID.IsActivated = true
-		licenseID.IsExpired = true
+		l.IsActivated = true
+		l.IsExpired = true
 	case "NO_MACHINE":
-		licenseID.IsActivated = false
-		licenseID.IsExpired = false
-	default:
+		l.IsActivated = false
+		l.IsExpired = false
+	case "":
 		err = ErrUnexpectedResponse
 		return
+	default:
+		err = fmt.Errorf("%w: %v", ErrLicenseInvalid, metaCode)
+		return
 	}
 
+	licenseID = l
 	return
 }
 
 type createMachineOptions struct {
-	KeygenConfig KeygenConfig
-	LicenseKey   string
-	LicenseID    string
-	Fingerprint  string
+	LicenseKey  string
+	LicenseID   string
+	Fingerprint string
+	Machine     *MachineDetails
 }
 
 // createMachine returns the following errors:
 // - ErrUnexpectedResponse
+// - ErrServiceUnavailable
 // - ErrLicenseKeyAlreadyActivated
-func createMachine(ctx context.Context, client *http.Client, opts createMachineOptions) (err error) {
-	u, err := url.JoinPath(opts.KeygenConfig.Endpoint, "/v1/machines")
+func (c *Client) createMachine(ctx context.Context, opts createMachineOptions) (err error) {
+	u, err := url.JoinPath(c.Config.Endpoint, "/v1/machines")
 	if err != nil {
 		return
 	}
 
-	reqBody := map[string]any{
-		"data": map[string]any{
-			"type": "machines",
-			"attributes": map[string]any{
-				"fingerprint": opts.Fingerprint,
-			},
-			"relationships": map[string]any{
-				"license": map[string]any{
-					"data": map[string]any{
-						"type": "license",
-						"id":   opts.LicenseID,
+	reqBody := JSONAPIDocument[*JSONAPIResource[MachineAttributes], any]{
+		Data: &JSONAPIResource[MachineAttributes]{
+			Type:       "machines",
+			Attributes: newMachineAttributes(opts.Fingerprint, opts.Machine),
+			Relationships: map[string]JSONAPIRelationship{
+				"license": {
+					Data: &JSONAPIResourceIdentifier{
+						Type: "license",
+						ID:   opts.LicenseID,
 					},
 				},
 			},
@@ -294,7 +897,7 @@ func createMachine(ctx context.Context, client *http.Client, opts createMachineO
 	// This endpoint requires license key Authorization
 	req.Header.Set("Authorization", fmt.Sprintf("License %v", opts.LicenseKey))
 
-	resp, err := client.Do(req)
+	resp, err := c.do(req, doOptions{})
 	if err != nil {
 		return
 	}
@@ -307,7 +910,7 @@ func createMachine(ctx context.Context, client *http.Client, opts createMachineO
 
 	defer func() {
 		if err != nil {
-			err = errors.Join(err, &KeygenResponseError{DumpedResponse: dumpedResponse})
+			err = errors.Join(err, c.newKeygenResponseError(dumpedResponse))
 		}
 	}()
 
@@ -428,18 +1031,18 @@ func createMachine(ctx context.Context, client *http.Client, opts createMachineO
 	//     }
 	// }
 
-	var respBody map[string]any
-	err = json.NewDecoder(resp.Body).Decode(&respBody)
+	return parseCreateMachineResponseBody(resp.Body)
+}
+
+func parseCreateMachineResponseBody(r io.Reader) (err error) {
+	doc, err := decodeJSONAPIDocument[*JSONAPIResource[MachineAttributes], any](r)
 	if err != nil {
 		return
 	}
 
-	errors, ok := respBody["errors"].([]any)
-	if ok {
-		for _, anyError := range errors {
-			errorObj := anyError.(map[string]any)
-			code := errorObj["code"].(string)
-			if code == "MACHINE_LIMIT_EXCEEDED" {
+	if len(doc.Errors) > 0 {
+		for _, e := range doc.Errors {
+			if e.Code == "MACHINE_LIMIT_EXCEEDED" {
 				err = ErrLicenseKeyAlreadyActivated
 				return
 			}
@@ -448,52 +1051,110 @@ func createMachine(ctx context.Context, client *http.Client, opts createMachineO
 		err = ErrUnexpectedResponse
 		return
 	}
-	// Otherwise we treat it as success.
+
+	if doc.Data == nil {
+		err = ErrUnexpectedResponse
+		return
+	}
+
 	return
 }
 
 type LicenseOptions struct {
-	KeygenConfig KeygenConfig
-	LicenseKey   string
-	Fingerprint  string
+	LicenseKey  string
+	Fingerprint string
+	// Machine is recorded when the license is activated.
+	// It is optional.
+	Machine *MachineDetails
+}
+
+// MachineDetails describes the machine the license is activated on.
+// It helps support to tell what a customer activated on.
+type MachineDetails struct {
+	Hostname    string
+	Platform    string
+	Cores       int
+	OnceVersion string
+}
+
+func newMachineAttributes(fingerprint string, machine *MachineDetails) MachineAttributes {
+	attrs := MachineAttributes{
+		Fingerprint: fingerprint,
+	}
+	if machine != nil {
+		attrs.Hostname = machine.Hostname
+		attrs.Platform = machine.Platform
+		attrs.Cores = machine.Cores
+		if machine.OnceVersion != "" {
+			attrs.Metadata = &MachineMetadata{
+				OnceVersion: machine.OnceVersion,
+			}
+		}
+	}
+	return attrs
 }
 
 // ActivateLicense returns the following errors:
 // - ErrUnexpectedResponse
+// - ErrServiceUnavailable
 // - ErrLicenseKeyNotFound
 // - ErrLicenseKeyAlreadyActivated
-func ActivateLicense(ctx context.Context, client *http.Client, opts LicenseOptions) (licenseID *LicenseID, err error) {
+// - Other errors returned by ValidateLicenseKey
+//
+// Concurrent activations of the same license key are coordinated, see activationCoordinator.
+func (c *Client) ActivateLicense(ctx context.Context, opts LicenseOptions) (licenseID *LicenseID, err error) {
+	if c.activations == nil {
+		return c.activateLicense(ctx, opts)
+	}
+	return c.activations.do(ctx, activationKey{
+		LicenseKey:  opts.LicenseKey,
+		Fingerprint: opts.Fingerprint,
+		Machine:     opts.Machine,
+	}, func(ctx context.Context) (*LicenseID, error) {
+		return c.activateLicense(ctx, opts)
+	})
+}
+
+func (c *Client) activateLicense(ctx context.Context, opts LicenseOptions) (licenseID *LicenseID, err error) {
 	// We first try to validate the license key.
 	// If the license is activated, we can return early.
-	licenseID, err = validateLicenseKey(ctx, client, validateLicenseKeyOptions{
-		KeygenConfig: opts.KeygenConfig,
-		LicenseKey:   opts.LicenseKey,
-		Fingerprint:  opts.Fingerprint,
+	licenseID, err = c.ValidateLicenseKey(ctx, LicenseOptions{
+		LicenseKey:  opts.LicenseKey,
+		Fingerprint: opts.Fingerprint,
 	})
-	if err != nil {
+	var mismatchErr *fingerprintScopeMismatchError
+	var id string
+	switch {
+	case errors.As(err, &mismatchErr) && mismatchErr.LicenseID != "":
+		// The license is activated on other machines.
+		// Whether one more machine is allowed is up to the policy,
+		// so we try to create the machine, and Keygen responds MACHINE_LIMIT_EXCEEDED if it is not allowed.
+		id = mismatchErr.LicenseID
+		err = nil
+	case err != nil:
 		return
-	}
-	// Activate the same fingerprint is idempotent.
-	if licenseID.IsActivated {
+	case licenseID.IsActivated:
+		// Activate the same fingerprint is idempotent.
 		return
+	default:
+		// Otherwise, the license key is not activated yet.
+		id = licenseID.ID
 	}
-	// Otherwise, the license key is not activated yet.
-	// Activate it by creating a machine.
 
-	err = createMachine(ctx, client, createMachineOptions{
-		KeygenConfig: opts.KeygenConfig,
-		LicenseKey:   opts.LicenseKey,
-		LicenseID:    licenseID.ID,
-		Fingerprint:  opts.Fingerprint,
+	// Activate it by creating a machine.
+	err = c.createMachine(ctx, createMachineOptions{
+		LicenseKey:  opts.LicenseKey,
+		LicenseID:   id,
+		Fingerprint: opts.Fingerprint,
+		Machine:     opts.Machine,
 	})
 	if err != nil {
 		return
 	}
 
-	licenseID, err = validateLicenseKey(ctx, client, validateLicenseKeyOptions{
-		KeygenConfig: opts.KeygenConfig,
-		LicenseKey:   opts.LicenseKey,
-		Fingerprint:  opts.Fingerprint,
+	licenseID, err = c.ValidateLicenseKey(ctx, LicenseOptions{
+		LicenseKey:  opts.LicenseKey,
+		Fingerprint: opts.Fingerprint,
 	})
 	if err != nil {
 		return
@@ -508,17 +1169,206 @@ func ActivateLicense(ctx context.Context, client *http.Client, opts LicenseOptio
 
 // CheckLicense returns the following errors:
 // - ErrUnexpectedResponse
+// - ErrServiceUnavailable
 // - ErrLicenseKeyNotFound
 // - ErrLicenseKeyAlreadyActivated
-func CheckLicense(ctx context.Context, client *http.Client, opts LicenseOptions) (licenseID *LicenseID, err error) {
-	licenseID, err = validateLicenseKey(ctx, client, validateLicenseKeyOptions{
-		KeygenConfig: opts.KeygenConfig,
-		LicenseKey:   opts.LicenseKey,
-		Fingerprint:  opts.Fingerprint,
+// - Other errors returned by ValidateLicenseKey
+func (c *Client) CheckLicense(ctx context.Context, opts LicenseOptions) (licenseID *LicenseID, err error) {
+	licenseID, err = c.ValidateLicenseKey(ctx, LicenseOptions{
+		LicenseKey:  opts.LicenseKey,
+		Fingerprint: opts.Fingerprint,
 	})
 	return
 }
 
+// DeactivateLicense returns the following errors:
+// - ErrUnexpectedResponse
+// - ErrServiceUnavailable
+// - ErrLicenseKeyNotFound
+// - ErrLicenseKeyNotActivated
+// - ErrMachineNotFound
+// - Other errors returned by ValidateLicenseKey
+func (c *Client) DeactivateLicense(ctx context.Context, opts LicenseOptions) (licenseID *LicenseID, err error) {
+	// We first validate the license key with the fingerprint.
+	// This ensures the caller knows both the license key and the fingerprint of the machine.
+	licenseID, err = c.ValidateLicenseKey(ctx, LicenseOptions{
+		LicenseKey:  opts.LicenseKey,
+		Fingerprint: opts.Fingerprint,
+	})
+	if err != nil {
+		// In the context of deactivation, FINGERPRINT_SCOPE_MISMATCH means
+		// the license is activated on a machine with another fingerprint.
+		if errors.Is(err, ErrLicenseKeyAlreadyActivated) {
+			err = errors.Join(ErrMachineNotFound, err)
+		}
+		return
+	}
+	if !licenseID.IsActivated {
+		err = ErrLicenseKeyNotActivated
+		return
+	}
+
+	machineID, err := c.findMachine(ctx, findMachineOptions{
+		LicenseID:   licenseID.ID,
+		Fingerprint: opts.Fingerprint,
+	})
+	if err != nil {
+		return
+	}
+
+	err = c.deleteMachine(ctx, deleteMachineOptions{
+		MachineID: machineID,
+	})
+	if err != nil {
+		return
+	}
+
+	licenseID, err = c.ValidateLicenseKey(ctx, LicenseOptions{
+		LicenseKey:  opts.LicenseKey,
+		Fingerprint: opts.Fingerprint,
+	})
+	if err != nil {
+		return
+	}
+	if licenseID.IsActivated {
+		err = ErrUnexpectedResponse
+		return
+	}
+
+	return
+}
+
+type findMachineOptions struct {
+	LicenseID   string
+	Fingerprint string
+}
+
+// findMachine returns the following errors:
+// - ErrUnexpectedResponse
+// - ErrServiceUnavailable
+// - ErrMachineNotFound
+func (c *Client) findMachine(ctx context.Context, opts findMachineOptions) (machineID string, err error) {
+	u, err := url.JoinPath(c.Config.Endpoint, "/v1/machines")
+	if err != nil {
+		return
+	}
+
+	q := url.Values{}
+	q.Set("license", opts.LicenseID)
+	q.Set("fingerprint", opts.Fingerprint)
+	u = fmt.Sprintf("%v?%v", u, q.Encode())
+
+	req, err := http.NewRequestWithContext(ctx, "GET", u, nil)
+	if err != nil {
+		return
+	}
+	patchRequest(req)
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %v", c.Config.AdminToken))
+
+	resp, err := c.do(req, doOptions{Retryable: true})
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+
+	dumpedResponse, err := httputil.DumpResponse(resp, true)
+	if err != nil {
+		return
+	}
+
+	defer func() {
+		if err != nil {
+			err = errors.Join(err, c.newKeygenResponseError(dumpedResponse))
+		}
+	}()
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return parseFindMachineResponseBody(resp.Body, opts.Fingerprint)
+	}
+
+	err = ErrUnexpectedResponse
+	return
+}
+
+func parseFindMachineResponseBody(r io.Reader, fingerprint string) (machineID string, err error) {
+	doc, err := decodeJSONAPIDocument[[]JSONAPIResource[MachineAttributes], any](r)
+	if err != nil {
+		return
+	}
+
+	if doc.Data == nil {
+		err = ErrUnexpectedResponse
+		return
+	}
+
+	for _, machine := range doc.Data {
+		// Compare the fingerprint again in case the filter is ignored.
+		if machine.Attributes.Fingerprint == fingerprint {
+			if machine.ID == "" {
+				err = ErrUnexpectedResponse
+				return
+			}
+			machineID = machine.ID
+			return
+		}
+	}
+
+	err = ErrMachineNotFound
+	return
+}
+
+type deleteMachineOptions struct {
+	MachineID string
+}
+
+// deleteMachine returns the following errors:
+// - ErrUnexpectedResponse
+// - ErrServiceUnavailable
+// - ErrMachineNotFound
+func (c *Client) deleteMachine(ctx context.Context, opts deleteMachineOptions) (err error) {
+	u, err := url.JoinPath(c.Config.Endpoint, "/v1/machines", opts.MachineID)
+	if err != nil {
+		return
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "DELETE", u, nil)
+	if err != nil {
+		return
+	}
+	patchRequest(req)
+	// Use the admin token so that it works regardless of whether the policy is protected.
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %v", c.Config.AdminToken))
+
+	resp, err := c.do(req, doOptions{})
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+
+	dumpedResponse, err := httputil.DumpResponse(resp, true)
+	if err != nil {
+		return
+	}
+
+	defer func() {
+		if err != nil {
+			err = errors.Join(err, c.newKeygenResponseError(dumpedResponse))
+		}
+	}()
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		// Success responds 204 No Content.
+		return
+	case resp.StatusCode == http.StatusNotFound:
+		err = ErrMachineNotFound
+		return
+	default:
+		err = ErrUnexpectedResponse
+		return
+	}
+}
+
 func patchRequest(r *http.Request) {
 	// Keygen requires TLS.
 	// We tell it is.
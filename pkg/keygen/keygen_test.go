@@ -1,6 +1,7 @@
 package keygen
 
 import (
+	"encoding/json"
 	"errors"
 	"reflect"
 	"strings"
@@ -546,7 +547,7 @@ func TestParseValidateLicenseKeyResponseBody(t *testing.T) {
 			name:            "invalid json",
 			responseBody:    `invalid json`,
 			expectedLicense: nil,
-			expectedError:   errors.New("invalid character 'i' looking for beginning of value"),
+			expectedError:   ErrUnexpectedResponse,
 		},
 
 		{
@@ -572,6 +573,215 @@ func TestParseValidateLicenseKeyResponseBody(t *testing.T) {
 			expectedLicense: nil,
 			expectedError:   ErrUnexpectedResponse,
 		},
+		{
+			name:            "without meta",
+			responseBody:    `{"data": null}`,
+			expectedLicense: nil,
+			expectedError:   ErrUnexpectedResponse,
+		},
+		{
+			name:            "meta code is not a string",
+			responseBody:    `{"meta": {"code": 1}}`,
+			expectedLicense: nil,
+			expectedError:   ErrUnexpectedResponse,
+		},
+		{
+			name:            "meta is an array",
+			responseBody:    `{"meta": []}`,
+			expectedLicense: nil,
+			expectedError:   ErrUnexpectedResponse,
+		},
+		{
+			name: "data is a string",
+			responseBody: `{
+				"meta": {
+					"valid": true,
+					"code": "VALID"
+				},
+				"data": "9d1e8df9-229f-4b5d-a207-945dcfa1e996"
+			}`,
+			expectedLicense: nil,
+			expectedError:   ErrUnexpectedResponse,
+		},
+		{
+			name: "data without id",
+			responseBody: `{
+				"meta": {
+					"valid": true,
+					"code": "VALID"
+				},
+				"data": {
+					"type": "licenses",
+					"attributes": {}
+				}
+			}`,
+			expectedLicense: nil,
+			expectedError:   ErrUnexpectedResponse,
+		},
+		{
+			name: "attributes is an array",
+			responseBody: `{
+				"meta": {
+					"valid": true,
+					"code": "VALID"
+				},
+				"data": {
+					"id": "9d1e8df9-229f-4b5d-a207-945dcfa1e996",
+					"type": "licenses",
+					"attributes": []
+				}
+			}`,
+			expectedLicense: nil,
+			expectedError:   ErrUnexpectedResponse,
+		},
+		{
+			name: "invalid expiry",
+			responseBody: `{
+				"meta": {
+					"valid": true,
+					"code": "VALID"
+				},
+				"data": {
+					"id": "9d1e8df9-229f-4b5d-a207-945dcfa1e996",
+					"type": "licenses",
+					"attributes": {
+						"expiry": "tomorrow"
+					}
+				}
+			}`,
+			expectedLicense: nil,
+			expectedError:   ErrUnexpectedResponse,
+		},
+		{
+			name: "unknown meta code",
+			responseBody: `{
+				"meta": {
+					"valid": false,
+					"code": "SOMETHING_NEW"
+				},
+				"data": {
+					"id": "9d1e8df9-229f-4b5d-a207-945dcfa1e996",
+					"type": "licenses",
+					"attributes": {}
+				}
+			}`,
+			expectedLicense: nil,
+			expectedError:   ErrLicenseInvalid,
+		},
+		{
+			name: "suspended license",
+			responseBody: `{
+				"meta": {
+					"valid": false,
+					"detail": "is suspended",
+					"code": "SUSPENDED"
+				},
+				"data": {
+					"id": "9d1e8df9-229f-4b5d-a207-945dcfa1e996",
+					"type": "licenses",
+					"attributes": {
+						"status": "SUSPENDED"
+					}
+				}
+			}`,
+			expectedLicense: nil,
+			expectedError:   ErrLicenseSuspended,
+		},
+		{
+			name: "banned license",
+			responseBody: `{
+				"meta": {
+					"valid": false,
+					"detail": "is banned",
+					"code": "BANNED"
+				},
+				"data": {
+					"id": "9d1e8df9-229f-4b5d-a207-945dcfa1e996",
+					"type": "licenses",
+					"attributes": {
+						"status": "BANNED"
+					}
+				}
+			}`,
+			expectedLicense: nil,
+			expectedError:   ErrLicenseBanned,
+		},
+		{
+			name: "overdue license",
+			responseBody: `{
+				"meta": {
+					"valid": false,
+					"detail": "is overdue for check in",
+					"code": "OVERDUE"
+				},
+				"data": {
+					"id": "9d1e8df9-229f-4b5d-a207-945dcfa1e996",
+					"type": "licenses",
+					"attributes": {
+						"status": "ACTIVE"
+					}
+				}
+			}`,
+			expectedLicense: nil,
+			expectedError:   ErrLicenseOverdue,
+		},
+		{
+			name: "too many machines license",
+			responseBody: `{
+				"meta": {
+					"valid": false,
+					"detail": "has too many associated machines",
+					"code": "TOO_MANY_MACHINES"
+				},
+				"data": {
+					"id": "9d1e8df9-229f-4b5d-a207-945dcfa1e996",
+					"type": "licenses",
+					"attributes": {
+						"status": "ACTIVE"
+					}
+				}
+			}`,
+			expectedLicense: nil,
+			expectedError:   ErrLicenseTooManyMachines,
+		},
+		{
+			name: "product scope mismatch license",
+			responseBody: `{
+				"meta": {
+					"valid": false,
+					"detail": "product scope does not match",
+					"code": "PRODUCT_SCOPE_MISMATCH"
+				},
+				"data": {
+					"id": "9d1e8df9-229f-4b5d-a207-945dcfa1e996",
+					"type": "licenses",
+					"attributes": {
+						"status": "ACTIVE"
+					}
+				}
+			}`,
+			expectedLicense: nil,
+			expectedError:   ErrLicenseScopeMismatch,
+		},
+		{
+			name: "heartbeat dead license",
+			responseBody: `{
+				"meta": {
+					"valid": false,
+					"detail": "machine heartbeat is dead",
+					"code": "HEARTBEAT_DEAD"
+				},
+				"data": {
+					"id": "9d1e8df9-229f-4b5d-a207-945dcfa1e996",
+					"type": "licenses",
+					"attributes": {
+						"status": "ACTIVE"
+					}
+				}
+			}`,
+			expectedLicense: nil,
+			expectedError:   ErrLicenseInvalid,
+		},
 	}
 
 	for _, tt := range tests {
@@ -586,8 +796,7 @@ func TestParseValidateLicenseKeyResponseBody(t *testing.T) {
 			if tt.expectedError != nil {
 				if err == nil {
 					t.Errorf("expected error %v, got nil", tt.expectedError)
-				} else if !errors.Is(err, tt.expectedError) && err.Error() != tt.expectedError.Error() {
-					// Special case for JSON decoding errors which don't support errors.Is
+				} else if !errors.Is(err, tt.expectedError) {
 					t.Errorf("expected error %v, got %v", tt.expectedError, err)
 				}
 			} else if err != nil {
@@ -601,7 +810,494 @@ func TestParseValidateLicenseKeyResponseBody(t *testing.T) {
 	}
 }
 
+func TestParseCreateLicenseKeyResponseBody(t *testing.T) {
+	tests := []struct {
+		name               string
+		responseBody       string
+		expectedLicenseKey string
+		expectedError      error
+	}{
+		{
+			name: "license created",
+			responseBody: `{
+    "data": {
+        "id": "9d1e8df9-229f-4b5d-a207-945dcfa1e996",
+        "type": "licenses",
+        "attributes": {
+            "key": "8ECE46-C5CB99-263245-93E5CC-AD0361-V3",
+            "expiry": null,
+            "status": "ACTIVE",
+            "metadata": {
+                "stripeCustomerId": "cus_SC8kvfXLrODZlq",
+                "stripeCheckoutSessionId": "cs_test_a12FEQu82usfxGayomGKYubHZTA6NwjnFwdgTg1rIYKNdKh421wEQGhVXn"
+            }
+        }
+    }
+}`,
+			expectedLicenseKey: "8ECE46-C5CB99-263245-93E5CC-AD0361-V3",
+			expectedError:      nil,
+		},
+		{
+			name:               "invalid json",
+			responseBody:       `<html></html>`,
+			expectedLicenseKey: "",
+			expectedError:      ErrUnexpectedResponse,
+		},
+		{
+			name:               "null data",
+			responseBody:       `{"data": null}`,
+			expectedLicenseKey: "",
+			expectedError:      ErrUnexpectedResponse,
+		},
+		{
+			name:               "without key",
+			responseBody:       `{"data": {"id": "9d1e8df9-229f-4b5d-a207-945dcfa1e996", "type": "licenses", "attributes": {}}}`,
+			expectedLicenseKey: "",
+			expectedError:      ErrUnexpectedResponse,
+		},
+		{
+			name:               "key is not a string",
+			responseBody:       `{"data": {"id": "9d1e8df9-229f-4b5d-a207-945dcfa1e996", "type": "licenses", "attributes": {"key": 42}}}`,
+			expectedLicenseKey: "",
+			expectedError:      ErrUnexpectedResponse,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			licenseKey, err := parseCreateLicenseKeyResponseBody(strings.NewReader(tt.responseBody))
+
+			if tt.expectedError != nil {
+				if !errors.Is(err, tt.expectedError) {
+					t.Errorf("expected error %v, got %v", tt.expectedError, err)
+				}
+			} else if err != nil {
+				t.Errorf("expected no error, got %v", err)
+			}
+
+			if licenseKey != tt.expectedLicenseKey {
+				t.Errorf("expected %v == %v", licenseKey, tt.expectedLicenseKey)
+			}
+		})
+	}
+}
+
+func TestParseLicenseResponseBody(t *testing.T) {
+	tests := []struct {
+		name            string
+		responseBody    string
+		expectedLicense *License
+		expectedError   error
+	}{
+		{
+			name: "renewed license",
+			responseBody: `{
+    "data": {
+        "id": "9d1e8df9-229f-4b5d-a207-945dcfa1e996",
+        "type": "licenses",
+        "attributes": {
+            "key": "8ECE46-C5CB99-263245-93E5CC-AD0361-V3",
+            "expiry": "2026-05-29T07:02:09.922Z",
+            "status": "ACTIVE",
+            "suspended": false,
+            "metadata": {
+                "stripeCustomerId": "cus_SC8kvfXLrODZlq",
+                "stripeCheckoutSessionId": "cs_test_a12FEQu82usfxGayomGKYubHZTA6NwjnFwdgTg1rIYKNdKh421wEQGhVXn",
+                "lastRenewalStripeCheckoutSessionId": "cs_test_renewal"
+            }
+        },
+        "relationships": {
+            "policy": {
+                "links": {
+                    "related": "/v1/accounts/1b6b5b1e-1e5f-4c9a-9b8c-6c0d4e3f1a2b/licenses/9d1e8df9-229f-4b5d-a207-945dcfa1e996/policy"
+                },
+                "data": {
+                    "type": "policies",
+                    "id": "b3a6a4b1-0f5e-4f3c-9a0d-2c1e5d7f8a9b"
+                }
+            }
+        }
+    }
+}`,
+			expectedLicense: &License{
+				ID:        "9d1e8df9-229f-4b5d-a207-945dcfa1e996",
+				Key:       "8ECE46-C5CB99-263245-93E5CC-AD0361-V3",
+				PolicyID:  "b3a6a4b1-0f5e-4f3c-9a0d-2c1e5d7f8a9b",
+				Expiry:    timeDate(2026, 5, 29, 7, 2, 9, int(922*time.Millisecond), time.UTC),
+				Suspended: false,
+				Metadata: LicenseMetadata{
+					StripeCheckoutSessionID:            "cs_test_a12FEQu82usfxGayomGKYubHZTA6NwjnFwdgTg1rIYKNdKh421wEQGhVXn",
+					StripeCustomerID:                   "cus_SC8kvfXLrODZlq",
+					LastRenewalStripeCheckoutSessionID: "cs_test_renewal",
+				},
+			},
+			expectedError: nil,
+		},
+		{
+			name: "suspended license without metadata",
+			responseBody: `{
+    "data": {
+        "id": "9d1e8df9-229f-4b5d-a207-945dcfa1e996",
+        "type": "licenses",
+        "attributes": {
+            "key": "8ECE46-C5CB99-263245-93E5CC-AD0361-V3",
+            "status": "SUSPENDED",
+            "suspended": true
+        }
+    }
+}`,
+			expectedLicense: &License{
+				ID:        "9d1e8df9-229f-4b5d-a207-945dcfa1e996",
+				Key:       "8ECE46-C5CB99-263245-93E5CC-AD0361-V3",
+				Suspended: true,
+			},
+			expectedError: nil,
+		},
+		{
+			name:            "null data",
+			responseBody:    `{"data": null}`,
+			expectedLicense: nil,
+			expectedError:   ErrUnexpectedResponse,
+		},
+		{
+			name:            "suspended is not a boolean",
+			responseBody:    `{"data": {"id": "9d1e8df9-229f-4b5d-a207-945dcfa1e996", "type": "licenses", "attributes": {"key": "8ECE46-C5CB99-263245-93E5CC-AD0361-V3", "suspended": "no"}}}`,
+			expectedLicense: nil,
+			expectedError:   ErrUnexpectedResponse,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			license, err := parseLicenseResponseBody(strings.NewReader(tt.responseBody))
+
+			if tt.expectedError != nil {
+				if !errors.Is(err, tt.expectedError) {
+					t.Errorf("expected error %v, got %v", tt.expectedError, err)
+				}
+			} else if err != nil {
+				t.Errorf("expected no error, got %v", err)
+			}
+
+			if !reflect.DeepEqual(license, tt.expectedLicense) {
+				t.Errorf("expected %v == %v", license, tt.expectedLicense)
+			}
+		})
+	}
+}
+
+func TestParseCreateMachineResponseBody(t *testing.T) {
+	tests := []struct {
+		name          string
+		responseBody  string
+		expectedError error
+	}{
+		{
+			name: "machine created",
+			responseBody: `{
+    "data": {
+        "id": "74c5d5d9-5e72-4883-a154-9a7689e19604",
+        "type": "machines",
+        "attributes": {
+            "fingerprint": "fg1"
+        }
+    }
+}`,
+			expectedError: nil,
+		},
+		{
+			name: "machine limit exceeded",
+			responseBody: `{
+    "errors": [
+        {
+            "title": "Unprocessable resource",
+            "detail": "has already been taken",
+            "code": "FINGERPRINT_TAKEN",
+            "source": {
+                "pointer": "/data/attributes/fingerprint"
+            }
+        },
+        {
+            "title": "Unprocessable resource",
+            "detail": "machine count has exceeded maximum allowed for license (1)",
+            "code": "MACHINE_LIMIT_EXCEEDED",
+            "source": {
+                "pointer": "/data"
+            }
+        }
+    ],
+    "meta": {
+        "id": "0c154eb4-53c1-4dd7-ab36-5d65a0baaa93"
+    }
+}`,
+			expectedError: ErrLicenseKeyAlreadyActivated,
+		},
+		{
+			name:          "unknown error",
+			responseBody:  `{"errors": [{"title": "Unauthorized", "code": "TOKEN_INVALID"}]}`,
+			expectedError: ErrUnexpectedResponse,
+		},
+		{
+			name:          "error without code",
+			responseBody:  `{"errors": [{"title": "Unauthorized"}]}`,
+			expectedError: ErrUnexpectedResponse,
+		},
+		{
+			name:          "errors is an object",
+			responseBody:  `{"errors": {"code": "MACHINE_LIMIT_EXCEEDED"}}`,
+			expectedError: ErrUnexpectedResponse,
+		},
+		{
+			name:          "empty object",
+			responseBody:  `{}`,
+			expectedError: ErrUnexpectedResponse,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := parseCreateMachineResponseBody(strings.NewReader(tt.responseBody))
+
+			if tt.expectedError != nil {
+				if !errors.Is(err, tt.expectedError) {
+					t.Errorf("expected error %v, got %v", tt.expectedError, err)
+				}
+			} else if err != nil {
+				t.Errorf("expected no error, got %v", err)
+			}
+		})
+	}
+}
+
+func TestParseFindMachineResponseBody(t *testing.T) {
+	tests := []struct {
+		name              string
+		responseBody      string
+		fingerprint       string
+		expectedMachineID string
+		expectedError     error
+	}{
+		{
+			name: "machine found",
+			responseBody: `{
+    "data": [
+        {
+            "id": "74c5d5d9-5e72-4883-a154-9a7689e19604",
+            "type": "machines",
+            "attributes": {
+                "fingerprint": "fg1",
+                "metadata": {},
+                "created": "2025-04-28T07:17:26.725Z",
+                "updated": "2025-04-28T07:17:26.725Z"
+            }
+        }
+    ],
+    "meta": {
+        "count": 1
+    }
+}`,
+			fingerprint:       "fg1",
+			expectedMachineID: "74c5d5d9-5e72-4883-a154-9a7689e19604",
+			expectedError:     nil,
+		},
+		{
+			name: "machine with another fingerprint",
+			responseBody: `{
+    "data": [
+        {
+            "id": "74c5d5d9-5e72-4883-a154-9a7689e19604",
+            "type": "machines",
+            "attributes": {
+                "fingerprint": "fg2"
+            }
+        }
+    ]
+}`,
+			fingerprint:       "fg1",
+			expectedMachineID: "",
+			expectedError:     ErrMachineNotFound,
+		},
+		{
+			name:              "no machines",
+			responseBody:      `{"data": []}`,
+			fingerprint:       "fg1",
+			expectedMachineID: "",
+			expectedError:     ErrMachineNotFound,
+		},
+		{
+			name:              "null data",
+			responseBody:      `{"data": null}`,
+			fingerprint:       "fg1",
+			expectedMachineID: "",
+			expectedError:     ErrUnexpectedResponse,
+		},
+		{
+			name:              "data is an object",
+			responseBody:      `{"data": {"id": "74c5d5d9-5e72-4883-a154-9a7689e19604", "type": "machines"}}`,
+			fingerprint:       "fg1",
+			expectedMachineID: "",
+			expectedError:     ErrUnexpectedResponse,
+		},
+		{
+			name:              "machine without id",
+			responseBody:      `{"data": [{"attributes": {"fingerprint": "fg1"}}]}`,
+			fingerprint:       "fg1",
+			expectedMachineID: "",
+			expectedError:     ErrUnexpectedResponse,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			machineID, err := parseFindMachineResponseBody(strings.NewReader(tt.responseBody), tt.fingerprint)
+
+			if tt.expectedError != nil {
+				if !errors.Is(err, tt.expectedError) {
+					t.Errorf("expected error %v, got %v", tt.expectedError, err)
+				}
+			} else if err != nil {
+				t.Errorf("expected no error, got %v", err)
+			}
+
+			if machineID != tt.expectedMachineID {
+				t.Errorf("expected %v == %v", machineID, tt.expectedMachineID)
+			}
+		})
+	}
+}
+
+func TestParseGetLicenseByStripeCheckoutSessionIDResponseBody(t *testing.T) {
+	tests := []struct {
+		name                    string
+		responseBody            string
+		stripeCheckoutSessionID string
+		expectedLicense         *License
+		expectedError           error
+	}{
+		{
+			name: "license found",
+			responseBody: `{
+    "data": [
+        {
+            "id": "9d1e8df9-229f-4b5d-a207-945dcfa1e996",
+            "type": "licenses",
+            "attributes": {
+                "key": "8ECE46-C5CB99-263245-93E5CC-AD0361-V3",
+                "metadata": {
+                    "stripeCustomerId": "cus_SC8kvfXLrODZlq",
+                    "stripeCheckoutSessionId": "cs_test_a12FEQu82usfxGayomGKYubHZTA6NwjnFwdgTg1rIYKNdKh421wEQGhVXn"
+                }
+            }
+        }
+    ],
+    "meta": {
+        "count": 1
+    }
+}`,
+			stripeCheckoutSessionID: "cs_test_a12FEQu82usfxGayomGKYubHZTA6NwjnFwdgTg1rIYKNdKh421wEQGhVXn",
+			expectedLicense: &License{
+				ID:        "9d1e8df9-229f-4b5d-a207-945dcfa1e996",
+				Key:       "8ECE46-C5CB99-263245-93E5CC-AD0361-V3",
+				Suspended: false,
+				Metadata: LicenseMetadata{
+					StripeCheckoutSessionID: "cs_test_a12FEQu82usfxGayomGKYubHZTA6NwjnFwdgTg1rIYKNdKh421wEQGhVXn",
+					StripeCustomerID:        "cus_SC8kvfXLrODZlq",
+				},
+			},
+			expectedError: nil,
+		},
+		{
+			name: "license of another checkout session",
+			responseBody: `{
+    "data": [
+        {
+            "id": "9d1e8df9-229f-4b5d-a207-945dcfa1e996",
+            "type": "licenses",
+            "attributes": {
+                "key": "8ECE46-C5CB99-263245-93E5CC-AD0361-V3",
+                "metadata": {
+                    "stripeCheckoutSessionId": "cs_test_another"
+                }
+            }
+        }
+    ]
+}`,
+			stripeCheckoutSessionID: "cs_test_a12FEQu82usfxGayomGKYubHZTA6NwjnFwdgTg1rIYKNdKh421wEQGhVXn",
+			expectedLicense:         nil,
+			expectedError:           ErrLicenseKeyNotFound,
+		},
+		{
+			name:                    "no licenses",
+			responseBody:            `{"data": []}`,
+			stripeCheckoutSessionID: "cs_test_a12FEQu82usfxGayomGKYubHZTA6NwjnFwdgTg1rIYKNdKh421wEQGhVXn",
+			expectedLicense:         nil,
+			expectedError:           ErrLicenseKeyNotFound,
+		},
+		{
+			name:                    "null data",
+			responseBody:            `{"data": null}`,
+			stripeCheckoutSessionID: "cs_test_a12FEQu82usfxGayomGKYubHZTA6NwjnFwdgTg1rIYKNdKh421wEQGhVXn",
+			expectedLicense:         nil,
+			expectedError:           ErrUnexpectedResponse,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			license, err := parseGetLicenseByStripeCheckoutSessionIDResponseBody(strings.NewReader(tt.responseBody), tt.stripeCheckoutSessionID)
+
+			if tt.expectedError != nil {
+				if !errors.Is(err, tt.expectedError) {
+					t.Errorf("expected error %v, got %v", tt.expectedError, err)
+				}
+			} else if err != nil {
+				t.Errorf("expected no error, got %v", err)
+			}
+
+			if !reflect.DeepEqual(license, tt.expectedLicense) {
+				t.Errorf("expected %v == %v", license, tt.expectedLicense)
+			}
+		})
+	}
+}
+
 func timeDate(year int, month time.Month, day, hour, min, sec, nsec int, loc *time.Location) *time.Time {
 	t := time.Date(year, month, day, hour, min, sec, nsec, loc)
 	return &t
 }
+
+func TestNewMachineAttributes(t *testing.T) {
+	tests := []struct {
+		name     string
+		machine  *MachineDetails
+		expected string
+	}{
+		{
+			name:     "fingerprint only",
+			machine:  nil,
+			expected: `{"fingerprint":"fg1"}`,
+		},
+		{
+			name: "machine details",
+			machine: &MachineDetails{
+				Hostname:    "auth.example.com",
+				Platform:    "linux/amd64",
+				Cores:       4,
+				OnceVersion: "v1.0.0",
+			},
+			expected: `{"fingerprint":"fg1","hostname":"auth.example.com","platform":"linux/amd64","cores":4,"metadata":{"onceVersion":"v1.0.0"}}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := json.Marshal(newMachineAttributes("fg1", tt.machine))
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if string(b) != tt.expected {
+				t.Errorf("expected %v, got %v", tt.expected, string(b))
+			}
+		})
+	}
+}
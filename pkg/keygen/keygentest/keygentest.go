@@ -0,0 +1,656 @@
+// Package keygentest provides an in-process fake of the subset of the Keygen API that keygen.Client uses.
+// It is for tests only, so that activation and webhook flows can run without a real Keygen.
+package keygentest
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/authgear/authgear-once-license-server/pkg/keygen"
+)
+
+const AdminToken = "keygentest-admin-token"
+
+// Policy is the subset of a Keygen policy the fake server simulates.
+// The expiration basis is always FROM_FIRST_ACTIVATION, that is,
+// the expiry of a license is set when its first machine is created.
+type Policy struct {
+	ID string
+	// MaxMachines is the maximum number of machines of a license.
+	// 0 means unlimited.
+	MaxMachines int
+	// Duration is the duration of a license.
+	// 0 means the license never expires.
+	Duration time.Duration
+}
+
+type License struct {
+	ID        string
+	Key       string
+	PolicyID  string
+	Expiry    *time.Time
+	Suspended bool
+	Metadata  keygen.LicenseMetadata
+	// ExtraMetadata is the metadata that keygen.LicenseMetadata does not model,
+	// for example, keys added by hand in the Keygen dashboard.
+	ExtraMetadata map[string]any
+}
+
+// licenseAttributes is keygen.LicenseAttributes with metadata of any keys.
+// Keygen keeps whatever metadata it is given, and replaces the metadata entirely on update.
+type licenseAttributes struct {
+	keygen.LicenseAttributes
+	Metadata map[string]any `json:"metadata,omitempty"`
+}
+
+// licenseMetadataKeys are the metadata keys that keygen.LicenseMetadata models.
+var licenseMetadataKeys = func() (keys []string) {
+	t := reflect.TypeFor[keygen.LicenseMetadata]()
+	for i := range t.NumField() {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		keys = append(keys, name)
+	}
+	return
+}()
+
+func (l *License) metadata() map[string]any {
+	m := maps.Clone(l.ExtraMetadata)
+	if m == nil {
+		m = map[string]any{}
+	}
+	b, _ := json.Marshal(l.Metadata)
+	_ = json.Unmarshal(b, &m)
+	return m
+}
+
+func (l *License) setMetadata(m map[string]any) {
+	b, _ := json.Marshal(m)
+	l.Metadata = keygen.LicenseMetadata{}
+	_ = json.Unmarshal(b, &l.Metadata)
+
+	l.ExtraMetadata = nil
+	for k, v := range m {
+		if !slices.Contains(licenseMetadataKeys, k) {
+			if l.ExtraMetadata == nil {
+				l.ExtraMetadata = map[string]any{}
+			}
+			l.ExtraMetadata[k] = v
+		}
+	}
+}
+
+type Machine struct {
+	ID         string
+	LicenseID  string
+	Attributes keygen.MachineAttributes
+}
+
+// Server is a fake Keygen server.
+// Use Config to construct a keygen.Client that talks to it.
+type Server struct {
+	*httptest.Server
+
+	// Now is the clock of the server.
+	// It defaults to time.Now.
+	Now func() time.Time
+
+	mu       sync.Mutex
+	nextID   int
+	policies map[string]Policy
+	licenses []*License
+	machines []*Machine
+}
+
+func NewServer(policies ...Policy) *Server {
+	s := &Server{
+		Now:      time.Now,
+		policies: map[string]Policy{},
+	}
+	for _, p := range policies {
+		s.policies[p.ID] = p
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /v1/licenses", s.requireAdmin(s.handleCreateLicense))
+	mux.HandleFunc("GET /v1/licenses", s.requireAdmin(s.handleListLicenses))
+	mux.HandleFunc("GET /v1/licenses/{id}", s.requireAdmin(s.handleGetLicense))
+	mux.HandleFunc("PATCH /v1/licenses/{id}", s.requireAdmin(s.handleUpdateLicense))
+	mux.HandleFunc("POST /v1/licenses/{id}/actions/{action}", s.requireAdmin(s.handleLicenseAction))
+	mux.HandleFunc("POST /v1/licenses/actions/validate-key", s.handleValidateKey)
+	mux.HandleFunc("POST /v1/machines", s.handleCreateMachine)
+	mux.HandleFunc("GET /v1/machines", s.requireAdmin(s.handleListMachines))
+	mux.HandleFunc("DELETE /v1/machines/{id}", s.requireAdmin(s.handleDeleteMachine))
+
+	s.Server = httptest.NewServer(mux)
+	return s
+}
+
+func (s *Server) Config() keygen.KeygenConfig {
+	return keygen.KeygenConfig{
+		Endpoint:   s.URL,
+		AdminToken: AdminToken,
+	}
+}
+
+// AddLicense adds a license directly, as if it was created by the admin.
+// ID and Key are generated if they are empty.
+func (s *Server) AddLicense(l License) License {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if l.ID == "" {
+		l.ID = s.newID("license")
+	}
+	if l.Key == "" {
+		l.Key = s.newID("KEY")
+	}
+	s.licenses = append(s.licenses, &l)
+	return l
+}
+
+// GetLicense returns a copy of the license with the given ID or key.
+func (s *Server) GetLicense(idOrKey string) (License, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	l, ok := s.findLicense(idOrKey)
+	if !ok {
+		return License{}, false
+	}
+	return *l, true
+}
+
+// ListMachines returns a copy of the machines of the license.
+func (s *Server) ListMachines(licenseID string) []Machine {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var machines []Machine
+	for _, m := range s.machines {
+		if m.LicenseID == licenseID {
+			machines = append(machines, *m)
+		}
+	}
+	return machines
+}
+
+func (s *Server) newID(prefix string) string {
+	s.nextID++
+	return fmt.Sprintf("%v-%v", prefix, s.nextID)
+}
+
+func (s *Server) findLicense(idOrKey string) (*License, bool) {
+	for _, l := range s.licenses {
+		if l.ID == idOrKey || l.Key == idOrKey {
+			return l, true
+		}
+	}
+	return nil, false
+}
+
+func (s *Server) machinesOf(licenseID string) []*Machine {
+	var machines []*Machine
+	for _, m := range s.machines {
+		if m.LicenseID == licenseID {
+			machines = append(machines, m)
+		}
+	}
+	return machines
+}
+
+func (s *Server) requireAdmin(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != fmt.Sprintf("Bearer %v", AdminToken) {
+			writeErrors(w, http.StatusUnauthorized, keygen.JSONAPIError{
+				Title: "Unauthorized",
+				Code:  "TOKEN_INVALID",
+			})
+			return
+		}
+		h(w, r)
+	}
+}
+
+func (s *Server) licenseResource(l *License) *keygen.JSONAPIResource[licenseAttributes] {
+	return &keygen.JSONAPIResource[licenseAttributes]{
+		ID:   l.ID,
+		Type: "licenses",
+		Attributes: licenseAttributes{
+			LicenseAttributes: keygen.LicenseAttributes{
+				Key:       l.Key,
+				Expiry:    l.Expiry,
+				Status:    s.licenseStatus(l),
+				Suspended: l.Suspended,
+			},
+			Metadata: l.metadata(),
+		},
+		Relationships: map[string]keygen.JSONAPIRelationship{
+			"policy": {
+				Data: &keygen.JSONAPIResourceIdentifier{
+					Type: "policies",
+					ID:   l.PolicyID,
+				},
+			},
+		},
+	}
+}
+
+func (s *Server) licenseStatus(l *License) string {
+	switch {
+	case l.Suspended:
+		return "SUSPENDED"
+	case l.Expiry != nil && !s.Now().Before(*l.Expiry):
+		return "EXPIRED"
+	default:
+		return "ACTIVE"
+	}
+}
+
+func machineResource(m *Machine) *keygen.JSONAPIResource[keygen.MachineAttributes] {
+	return &keygen.JSONAPIResource[keygen.MachineAttributes]{
+		ID:         m.ID,
+		Type:       "machines",
+		Attributes: m.Attributes,
+		Relationships: map[string]keygen.JSONAPIRelationship{
+			"license": {
+				Data: &keygen.JSONAPIResourceIdentifier{
+					Type: "licenses",
+					ID:   m.LicenseID,
+				},
+			},
+		},
+	}
+}
+
+func (s *Server) handleCreateLicense(w http.ResponseWriter, r *http.Request) {
+	var body keygen.JSONAPIDocument[*keygen.JSONAPIResource[licenseAttributes], any]
+	if !readJSON(w, r, &body) || body.Data == nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	policy := body.Data.Relationships["policy"].Data
+	if policy == nil {
+		writeErrors(w, http.StatusUnprocessableEntity, keygen.JSONAPIError{
+			Title:  "Unprocessable resource",
+			Detail: "must exist",
+			Code:   "POLICY_BLANK",
+		})
+		return
+	}
+	if _, ok := s.policies[policy.ID]; !ok {
+		writeErrors(w, http.StatusNotFound, keygen.JSONAPIError{
+			Title:  "Not found",
+			Detail: "The requested policy was not found",
+			Code:   "NOT_FOUND",
+		})
+		return
+	}
+
+	l := &License{
+		ID:       s.newID("license"),
+		Key:      s.newID("KEY"),
+		PolicyID: policy.ID,
+	}
+	if body.Data.Attributes.Metadata != nil {
+		l.setMetadata(body.Data.Attributes.Metadata)
+	}
+	s.licenses = append(s.licenses, l)
+
+	writeJSON(w, http.StatusCreated, keygen.JSONAPIDocument[*keygen.JSONAPIResource[licenseAttributes], any]{
+		Data: s.licenseResource(l),
+	})
+}
+
+func (s *Server) handleListLicenses(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	q := r.URL.Query()
+	data := []keygen.JSONAPIResource[licenseAttributes]{}
+	for _, l := range s.licenses {
+		if v := q.Get("policy"); v != "" && l.PolicyID != v {
+			continue
+		}
+		if v := q.Get("metadata[stripeCheckoutSessionId]"); v != "" && l.Metadata.StripeCheckoutSessionID != v {
+			continue
+		}
+		data = append(data, *s.licenseResource(l))
+	}
+
+	pageSize, _ := strconv.Atoi(q.Get("page[size]"))
+	if pageSize <= 0 {
+		pageSize = 10
+	}
+	pageNumber, _ := strconv.Atoi(q.Get("page[number]"))
+	if pageNumber <= 0 {
+		pageNumber = 1
+	}
+	start := min((pageNumber-1)*pageSize, len(data))
+	end := min(start+pageSize, len(data))
+	data = data[start:end]
+
+	writeJSON(w, http.StatusOK, keygen.JSONAPIDocument[[]keygen.JSONAPIResource[licenseAttributes], any]{
+		Data: data,
+	})
+}
+
+func (s *Server) handleGetLicense(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	l, ok := s.findLicense(r.PathValue("id"))
+	if !ok {
+		writeLicenseNotFound(w)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, keygen.JSONAPIDocument[*keygen.JSONAPIResource[licenseAttributes], any]{
+		Data: s.licenseResource(l),
+	})
+}
+
+func (s *Server) handleUpdateLicense(w http.ResponseWriter, r *http.Request) {
+	var body keygen.JSONAPIDocument[*keygen.JSONAPIResource[licenseAttributes], any]
+	if !readJSON(w, r, &body) || body.Data == nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	l, ok := s.findLicense(r.PathValue("id"))
+	if !ok {
+		writeLicenseNotFound(w)
+		return
+	}
+	if body.Data.Attributes.Metadata != nil {
+		l.setMetadata(body.Data.Attributes.Metadata)
+	}
+
+	writeJSON(w, http.StatusOK, keygen.JSONAPIDocument[*keygen.JSONAPIResource[licenseAttributes], any]{
+		Data: s.licenseResource(l),
+	})
+}
+
+func (s *Server) handleLicenseAction(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	l, ok := s.findLicense(r.PathValue("id"))
+	if !ok {
+		writeLicenseNotFound(w)
+		return
+	}
+
+	switch r.PathValue("action") {
+	case "suspend":
+		if l.Suspended {
+			writeErrors(w, http.StatusUnprocessableEntity, keygen.JSONAPIError{
+				Title:  "Unprocessable resource",
+				Detail: "is already suspended",
+				Code:   "SUSPENDED_INVALID",
+			})
+			return
+		}
+		l.Suspended = true
+	case "reinstate":
+		if !l.Suspended {
+			writeErrors(w, http.StatusUnprocessableEntity, keygen.JSONAPIError{
+				Title:  "Unprocessable resource",
+				Detail: "is not suspended",
+				Code:   "SUSPENDED_INVALID",
+			})
+			return
+		}
+		l.Suspended = false
+	case "renew":
+		duration := s.policies[l.PolicyID].Duration
+		if duration == 0 {
+			writeErrors(w, http.StatusUnprocessableEntity, keygen.JSONAPIError{
+				Title:  "Unprocessable resource",
+				Detail: "cannot be renewed because the policy does not have a duration",
+				Code:   "EXPIRY_INVALID",
+			})
+			return
+		}
+		// Keygen extends the current expiry, or sets the expiry from now if the license has none.
+		expiry := s.Now()
+		if l.Expiry != nil {
+			expiry = *l.Expiry
+		}
+		expiry = expiry.Add(duration).UTC()
+		l.Expiry = &expiry
+	default:
+		writeErrors(w, http.StatusNotFound, keygen.JSONAPIError{
+			Title: "Not found",
+			Code:  "NOT_FOUND",
+		})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, keygen.JSONAPIDocument[*keygen.JSONAPIResource[licenseAttributes], any]{
+		Data: s.licenseResource(l),
+	})
+}
+
+// handleValidateKey simulates validate-key with the fingerprint scope.
+// See https://keygen.sh/docs/api/licenses/#licenses-actions-validate-key
+func (s *Server) handleValidateKey(w http.ResponseWriter, r *http.Request) {
+	var body keygen.JSONAPIDocument[any, keygen.ValidateKeyRequestMeta]
+	if !readJSON(w, r, &body) {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	type response = keygen.JSONAPIDocument[*keygen.JSONAPIResource[licenseAttributes], keygen.ValidateKeyResponseMeta]
+
+	l, ok := s.findLicense(body.Meta.Key)
+	if !ok || l.Key != body.Meta.Key {
+		writeJSON(w, http.StatusOK, response{
+			Meta: keygen.ValidateKeyResponseMeta{
+				Valid:  false,
+				Detail: "does not exist",
+				Code:   "NOT_FOUND",
+			},
+		})
+		return
+	}
+
+	valid, code := s.validate(l, body.Meta.Scope.Fingerprint)
+	writeJSON(w, http.StatusOK, response{
+		Data: s.licenseResource(l),
+		Meta: keygen.ValidateKeyResponseMeta{
+			Valid:  valid,
+			Detail: strings.ToLower(strings.ReplaceAll(code, "_", " ")),
+			Code:   code,
+		},
+	})
+}
+
+func (s *Server) validate(l *License, fingerprint string) (valid bool, code string) {
+	if l.Suspended {
+		return false, "SUSPENDED"
+	}
+
+	machines := s.machinesOf(l.ID)
+	if len(machines) == 0 {
+		return false, "NO_MACHINE"
+	}
+	if maxMachines := s.policies[l.PolicyID].MaxMachines; maxMachines > 0 && len(machines) > maxMachines {
+		return false, "TOO_MANY_MACHINES"
+	}
+	if fingerprint != "" {
+		found := slices.ContainsFunc(machines, func(m *Machine) bool {
+			return m.Attributes.Fingerprint == fingerprint
+		})
+		if !found {
+			return false, "FINGERPRINT_SCOPE_MISMATCH"
+		}
+	}
+	// The expiration strategy is MAINTAIN_ACCESS, so an expired license is still valid.
+	if l.Expiry != nil && !s.Now().Before(*l.Expiry) {
+		return true, "EXPIRED"
+	}
+	return true, "VALID"
+}
+
+func (s *Server) handleCreateMachine(w http.ResponseWriter, r *http.Request) {
+	var body keygen.JSONAPIDocument[*keygen.JSONAPIResource[keygen.MachineAttributes], any]
+	if !readJSON(w, r, &body) || body.Data == nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var l *License
+	if rel := body.Data.Relationships["license"].Data; rel != nil {
+		l, _ = s.findLicense(rel.ID)
+	}
+
+	// This endpoint accepts either the admin token or the key of the license.
+	authorization := r.Header.Get("Authorization")
+	authorized := authorization == fmt.Sprintf("Bearer %v", AdminToken) ||
+		(l != nil && authorization == fmt.Sprintf("License %v", l.Key))
+	if !authorized {
+		writeErrors(w, http.StatusUnauthorized, keygen.JSONAPIError{
+			Title: "Unauthorized",
+			Code:  "LICENSE_INVALID",
+		})
+		return
+	}
+	if l == nil {
+		writeLicenseNotFound(w)
+		return
+	}
+
+	machines := s.machinesOf(l.ID)
+	var errs []keygen.JSONAPIError
+	if slices.ContainsFunc(machines, func(m *Machine) bool {
+		return m.Attributes.Fingerprint == body.Data.Attributes.Fingerprint
+	}) {
+		errs = append(errs, keygen.JSONAPIError{
+			Title:  "Unprocessable resource",
+			Detail: "has already been taken",
+			Code:   "FINGERPRINT_TAKEN",
+			Source: &keygen.JSONAPIErrorSource{Pointer: "/data/attributes/fingerprint"},
+		})
+	}
+	if maxMachines := s.policies[l.PolicyID].MaxMachines; maxMachines > 0 && len(machines) >= maxMachines {
+		errs = append(errs, keygen.JSONAPIError{
+			Title:  "Unprocessable resource",
+			Detail: fmt.Sprintf("machine count has exceeded maximum allowed for license (%v)", maxMachines),
+			Code:   "MACHINE_LIMIT_EXCEEDED",
+			Source: &keygen.JSONAPIErrorSource{Pointer: "/data"},
+		})
+	}
+	if len(errs) > 0 {
+		writeErrors(w, http.StatusUnprocessableEntity, errs...)
+		return
+	}
+
+	m := &Machine{
+		ID:         s.newID("machine"),
+		LicenseID:  l.ID,
+		Attributes: body.Data.Attributes,
+	}
+	s.machines = append(s.machines, m)
+
+	// The expiration basis is FROM_FIRST_ACTIVATION.
+	if duration := s.policies[l.PolicyID].Duration; l.Expiry == nil && duration > 0 {
+		expiry := s.Now().Add(duration).UTC()
+		l.Expiry = &expiry
+	}
+
+	writeJSON(w, http.StatusCreated, keygen.JSONAPIDocument[*keygen.JSONAPIResource[keygen.MachineAttributes], any]{
+		Data: machineResource(m),
+	})
+}
+
+func (s *Server) handleListMachines(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	q := r.URL.Query()
+	data := []keygen.JSONAPIResource[keygen.MachineAttributes]{}
+	for _, m := range s.machines {
+		if v := q.Get("license"); v != "" && m.LicenseID != v {
+			continue
+		}
+		if v := q.Get("fingerprint"); v != "" && m.Attributes.Fingerprint != v {
+			continue
+		}
+		data = append(data, *machineResource(m))
+	}
+
+	writeJSON(w, http.StatusOK, keygen.JSONAPIDocument[[]keygen.JSONAPIResource[keygen.MachineAttributes], any]{
+		Data: data,
+	})
+}
+
+func (s *Server) handleDeleteMachine(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id := r.PathValue("id")
+	i := slices.IndexFunc(s.machines, func(m *Machine) bool {
+		return m.ID == id
+	})
+	if i < 0 {
+		writeErrors(w, http.StatusNotFound, keygen.JSONAPIError{
+			Title:  "Not found",
+			Detail: "The requested machine was not found",
+			Code:   "NOT_FOUND",
+		})
+		return
+	}
+	s.machines = slices.Delete(s.machines, i, i+1)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func readJSON(w http.ResponseWriter, r *http.Request, v any) bool {
+	err := json.NewDecoder(r.Body).Decode(v)
+	if err != nil {
+		writeErrors(w, http.StatusBadRequest, keygen.JSONAPIError{
+			Title:  "Bad request",
+			Detail: err.Error(),
+		})
+		return false
+	}
+	return true
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/vnd.api+json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeErrors(w http.ResponseWriter, status int, errs ...keygen.JSONAPIError) {
+	writeJSON(w, status, keygen.JSONAPIDocument[any, any]{
+		Errors: errs,
+	})
+}
+
+func writeLicenseNotFound(w http.ResponseWriter) {
+	writeErrors(w, http.StatusNotFound, keygen.JSONAPIError{
+		Title:  "Not found",
+		Detail: "The requested license was not found",
+		Code:   "NOT_FOUND",
+	})
+}
@@ -0,0 +1,135 @@
+package keygen
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httputil"
+	"strings"
+)
+
+const redacted = "[REDACTED]"
+
+// sensitiveHeaders are redacted from dumped responses.
+var sensitiveHeaders = []string{
+	"Authorization",
+	"Proxy-Authorization",
+	"Cookie",
+	"Set-Cookie",
+	"Keygen-Signature",
+	"Digest",
+}
+
+// sensitiveJSONKeys are the keys of JSON object members whose values are redacted.
+// They are compared case-insensitively.
+var sensitiveJSONKeys = map[string]struct{}{
+	"key":         {},
+	"fingerprint": {},
+	"email":       {},
+	"token":       {},
+	"digest":      {},
+	"hostname":    {},
+	"ip":          {},
+	// Every value in metadata is redacted, because metadata is where we store customer information.
+	"metadata": {},
+}
+
+// RedactDumpedResponse returns a copy of dumpedResponse, the output of httputil.DumpResponse,
+// with license keys, fingerprints, emails, tokens and metadata replaced by [REDACTED].
+// A JSON body is redacted structurally, so that the shape of the response is retained for debugging.
+// A body that is not JSON is redacted entirely.
+func RedactDumpedResponse(dumpedResponse []byte) []byte {
+	resp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(dumpedResponse)), nil)
+	if err != nil {
+		return []byte(redacted)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return []byte(redacted)
+	}
+
+	for _, name := range sensitiveHeaders {
+		if _, ok := resp.Header[http.CanonicalHeaderKey(name)]; ok {
+			resp.Header.Set(name, redacted)
+		}
+	}
+
+	body = redactBody(body)
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	resp.ContentLength = int64(len(body))
+	resp.TransferEncoding = nil
+	resp.Header.Del("Content-Length")
+
+	out, err := httputil.DumpResponse(resp, true)
+	if err != nil {
+		return []byte(redacted)
+	}
+	return out
+}
+
+func redactBody(body []byte) []byte {
+	if len(bytes.TrimSpace(body)) == 0 {
+		return body
+	}
+
+	var v any
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	err := decoder.Decode(&v)
+	if err != nil {
+		return []byte(fmt.Sprintf("%v non-JSON body of %v bytes", redacted, len(body)))
+	}
+
+	out, err := json.Marshal(redactJSONValue(v))
+	if err != nil {
+		return []byte(redacted)
+	}
+	return out
+}
+
+func redactJSONValue(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for k, child := range v {
+			if _, ok := sensitiveJSONKeys[strings.ToLower(k)]; ok {
+				v[k] = redactAll(child)
+			} else {
+				v[k] = redactJSONValue(child)
+			}
+		}
+		return v
+	case []any:
+		for i, child := range v {
+			v[i] = redactJSONValue(child)
+		}
+		return v
+	default:
+		return v
+	}
+}
+
+// redactAll replaces every string and number in v.
+// null, booleans and the structure of v are retained.
+func redactAll(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for k, child := range v {
+			v[k] = redactAll(child)
+		}
+		return v
+	case []any:
+		for i, child := range v {
+			v[i] = redactAll(child)
+		}
+		return v
+	case string, json.Number:
+		return redacted
+	default:
+		return v
+	}
+}
@@ -0,0 +1,75 @@
+package keygen
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRedactDumpedResponse(t *testing.T) {
+	tests := []struct {
+		name        string
+		dump        string
+		contains    []string
+		notContains []string
+	}{
+		{
+			name: "json body",
+			dump: "HTTP/1.1 200 OK\r\nContent-Type: application/vnd.api+json\r\nSet-Cookie: session=secret\r\n\r\n" +
+				`{"data":{"id":"9d1e8df9-229f-4b5d-a207-945dcfa1e996","type":"licenses","attributes":{"key":"8ECE46-C5CB99-263245-93E5CC-AD0361-V3","status":"ACTIVE","metadata":{"stripeCustomerId":"cus_foobar","licenseeEmail":"user@example.com"}}},"meta":{"valid":true,"code":"VALID","scope":{"fingerprint":"fg1"}}}`,
+			contains: []string{
+				"HTTP/1.1 200 OK",
+				"9d1e8df9-229f-4b5d-a207-945dcfa1e996",
+				`"status":"ACTIVE"`,
+				`"code":"VALID"`,
+				`"key":"[REDACTED]"`,
+				`"stripeCustomerId":"[REDACTED]"`,
+				`"fingerprint":"[REDACTED]"`,
+				"Set-Cookie: [REDACTED]",
+			},
+			notContains: []string{
+				"8ECE46-C5CB99-263245-93E5CC-AD0361-V3",
+				"cus_foobar",
+				"user@example.com",
+				"fg1",
+				"session=secret",
+			},
+		},
+		{
+			name: "chunked json body",
+			dump: "HTTP/1.1 422 Unprocessable Entity\r\nTransfer-Encoding: chunked\r\n\r\n" +
+				"1d\r\n" + `{"errors":[{"title":"bad","so` + "\r\n" +
+				"2a\r\n" + `urce":{"pointer":"/data"}}],"token":"tok"}` + "\r\n" +
+				"0\r\n\r\n",
+			contains:    []string{"422 Unprocessable Entity", `"title":"bad"`, `"token":"[REDACTED]"`},
+			notContains: []string{`"tok"`},
+		},
+		{
+			name:        "non-json body",
+			dump:        "HTTP/1.1 502 Bad Gateway\r\nContent-Length: 31\r\n\r\nkey 8ECE46-C5CB99-263245-93E5CC",
+			contains:    []string{"502 Bad Gateway", "[REDACTED] non-JSON body of 31 bytes"},
+			notContains: []string{"8ECE46"},
+		},
+		{
+			name:        "not a response",
+			dump:        "8ECE46-C5CB99-263245-93E5CC-AD0361-V3",
+			contains:    []string{"[REDACTED]"},
+			notContains: []string{"8ECE46"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := string(RedactDumpedResponse([]byte(tt.dump)))
+			for _, s := range tt.contains {
+				if !strings.Contains(got, s) {
+					t.Errorf("expected %v to contain %v", got, s)
+				}
+			}
+			for _, s := range tt.notContains {
+				if strings.Contains(got, s) {
+					t.Errorf("expected %v not to contain %v", got, s)
+				}
+			}
+		})
+	}
+}
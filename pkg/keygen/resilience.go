@@ -0,0 +1,210 @@
+package keygen
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"net/http/httputil"
+	"sync"
+	"time"
+)
+
+// ErrServiceUnavailable means Keygen cannot be reached, or it is considered unhealthy by the circuit breaker.
+var ErrServiceUnavailable = errors.New("service unavailable")
+
+const (
+	DefaultTimeout                 = 10 * time.Second
+	DefaultMaxRetries              = 2
+	DefaultCircuitBreakerThreshold = 5
+	DefaultCircuitBreakerCooldown  = 30 * time.Second
+)
+
+// retryBaseDelay is the delay before the first retry.
+// The delay doubles on each retry, with full jitter.
+var retryBaseDelay = 100 * time.Millisecond
+
+// circuitBreaker opens after threshold consecutive failures.
+// When it is open, requests fail fast with ErrServiceUnavailable until cooldown has passed.
+// After cooldown, one request is let through to probe Keygen.
+// The breaker closes if the probe succeeds, and opens again if it fails.
+type circuitBreaker struct {
+	threshold int
+	cooldown  time.Duration
+	now       func() time.Time
+
+	mu                  sync.Mutex
+	consecutiveFailures int
+	openedAt            time.Time
+	probing             bool
+}
+
+func newCircuitBreaker(threshold int, cooldown time.Duration) *circuitBreaker {
+	return &circuitBreaker{
+		threshold: threshold,
+		cooldown:  cooldown,
+		now:       time.Now,
+	}
+}
+
+// allow reports whether a request can be made.
+func (b *circuitBreaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.consecutiveFailures < b.threshold {
+		return true
+	}
+	if b.probing || b.now().Sub(b.openedAt) < b.cooldown {
+		return false
+	}
+	b.probing = true
+	return true
+}
+
+func (b *circuitBreaker) record(success bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+	if success {
+		b.consecutiveFailures = 0
+		return
+	}
+	b.consecutiveFailures++
+	if b.consecutiveFailures >= b.threshold {
+		b.openedAt = b.now()
+	}
+}
+
+// release lets another probe through without recording the outcome of the request.
+// It is used when the request is abandoned by the caller, which says nothing about the health of Keygen.
+func (b *circuitBreaker) release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+}
+
+type doOptions struct {
+	// Retryable is true if the request does not change anything in Keygen.
+	Retryable bool
+}
+
+// do sends req with the timeout, the retries and the circuit breaker configured in c.Config.
+// A failure to reach Keygen, or a response of status 5xx or 429 after the retries are exhausted,
+// results in ErrServiceUnavailable.
+// A failure due to the context of req being canceled or exceeding its deadline
+// is not counted by the circuit breaker.
+func (c *Client) do(req *http.Request, opts doOptions) (resp *http.Response, err error) {
+	maxRetries := 0
+	if opts.Retryable {
+		maxRetries = c.Config.MaxRetries
+	}
+
+	for attempt := 0; ; attempt++ {
+		if c.breaker != nil && !c.breaker.allow() {
+			err = ErrServiceUnavailable
+			return
+		}
+
+		resp, err = c.doOnce(req)
+		failed := err != nil || resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests
+		if c.breaker != nil {
+			if failed && req.Context().Err() != nil {
+				c.breaker.release()
+			} else {
+				c.breaker.record(!failed)
+			}
+		}
+		if !failed {
+			return
+		}
+
+		if attempt >= maxRetries || req.Context().Err() != nil {
+			if err != nil {
+				err = errors.Join(ErrServiceUnavailable, err)
+				return
+			}
+			err = c.unavailableResponseError(resp)
+			resp = nil
+			return
+		}
+
+		if resp != nil {
+			_, _ = io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+			resp = nil
+		}
+
+		err = sleep(req.Context(), retryDelay(attempt))
+		if err != nil {
+			err = errors.Join(ErrServiceUnavailable, err)
+			return
+		}
+	}
+}
+
+func (c *Client) unavailableResponseError(resp *http.Response) error {
+	defer resp.Body.Close()
+	dumpedResponse, err := httputil.DumpResponse(resp, true)
+	if err != nil {
+		return errors.Join(ErrServiceUnavailable, err)
+	}
+	return errors.Join(ErrServiceUnavailable, c.newKeygenResponseError(dumpedResponse))
+}
+
+func (c *Client) doOnce(req *http.Request) (resp *http.Response, err error) {
+	ctx := req.Context()
+	cancel := context.CancelFunc(func() {})
+	if c.Config.Timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, c.Config.Timeout)
+	}
+
+	attemptReq := req.Clone(ctx)
+	if req.GetBody != nil {
+		attemptReq.Body, err = req.GetBody()
+		if err != nil {
+			cancel()
+			return
+		}
+	}
+
+	resp, err = c.HTTPClient.Do(attemptReq)
+	if err != nil {
+		cancel()
+		return
+	}
+
+	// The timeout covers reading the body, so cancel only when the body is closed.
+	resp.Body = &cancelOnClose{ReadCloser: resp.Body, cancel: cancel}
+	return
+}
+
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (r *cancelOnClose) Close() error {
+	err := r.ReadCloser.Close()
+	r.cancel()
+	return err
+}
+
+// retryDelay returns a random delay in [0, retryBaseDelay * 2^attempt).
+func retryDelay(attempt int) time.Duration {
+	return rand.N(retryBaseDelay << attempt)
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,221 @@
+package keygen
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newFlakyServer(t *testing.T, failures int32, handler http.HandlerFunc) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	var count atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := count.Add(1)
+		if n <= failures {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		handler(w, r)
+	}))
+	t.Cleanup(server.Close)
+	return server, &count
+}
+
+func writeLicense(w http.ResponseWriter, r *http.Request) {
+	_, _ = w.Write([]byte(`{"data":{"id":"license-1","type":"licenses","attributes":{"key":"KEY-1"}}}`))
+}
+
+func TestClientRetries(t *testing.T) {
+	retryBaseDelay = time.Millisecond
+
+	tests := []struct {
+		name          string
+		failures      int32
+		call          func(c *Client) error
+		expectedCount int32
+		expectedError error
+	}{
+		{
+			name:     "read succeeds after retries",
+			failures: 2,
+			call: func(c *Client) error {
+				_, err := c.GetLicense(context.Background(), GetLicenseOptions{LicenseIDOrKey: "license-1"})
+				return err
+			},
+			expectedCount: 3,
+		},
+		{
+			name:     "read fails after retries are exhausted",
+			failures: 3,
+			call: func(c *Client) error {
+				_, err := c.GetLicense(context.Background(), GetLicenseOptions{LicenseIDOrKey: "license-1"})
+				return err
+			},
+			expectedCount: 3,
+			expectedError: ErrServiceUnavailable,
+		},
+		{
+			name:     "write is not retried",
+			failures: 1,
+			call: func(c *Client) error {
+				_, err := c.RenewLicense(context.Background(), LicenseActionOptions{LicenseID: "license-1"})
+				return err
+			},
+			expectedCount: 1,
+			expectedError: ErrServiceUnavailable,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, count := newFlakyServer(t, tt.failures, writeLicense)
+			c := NewClient(server.Client(), KeygenConfig{
+				Endpoint:   server.URL,
+				MaxRetries: 2,
+			})
+
+			err := tt.call(c)
+			if tt.expectedError == nil && err != nil {
+				t.Errorf("expected no error, got %v", err)
+			}
+			if tt.expectedError != nil && !errors.Is(err, tt.expectedError) {
+				t.Errorf("expected error %v, got %v", tt.expectedError, err)
+			}
+			if got := count.Load(); got != tt.expectedCount {
+				t.Errorf("expected %v requests, got %v", tt.expectedCount, got)
+			}
+		})
+	}
+}
+
+func TestClientTimeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Second):
+		}
+	}))
+	defer server.Close()
+
+	c := NewClient(server.Client(), KeygenConfig{
+		Endpoint: server.URL,
+		Timeout:  10 * time.Millisecond,
+	})
+
+	_, err := c.GetLicense(context.Background(), GetLicenseOptions{LicenseIDOrKey: "license-1"})
+	if !errors.Is(err, ErrServiceUnavailable) {
+		t.Errorf("expected ErrServiceUnavailable, got %v", err)
+	}
+}
+
+func TestClientCircuitBreaker(t *testing.T) {
+	server, count := newFlakyServer(t, 2, writeLicense)
+	c := NewClient(server.Client(), KeygenConfig{
+		Endpoint:                server.URL,
+		CircuitBreakerThreshold: 2,
+		CircuitBreakerCooldown:  time.Minute,
+	})
+	now := time.Date(2025, 5, 1, 0, 0, 0, 0, time.UTC)
+	c.breaker.now = func() time.Time { return now }
+
+	getLicense := func() error {
+		_, err := c.GetLicense(context.Background(), GetLicenseOptions{LicenseIDOrKey: "license-1"})
+		return err
+	}
+
+	for range 2 {
+		if err := getLicense(); !errors.Is(err, ErrServiceUnavailable) {
+			t.Fatalf("expected ErrServiceUnavailable, got %v", err)
+		}
+	}
+
+	// The breaker is open, so Keygen is not called.
+	if err := getLicense(); !errors.Is(err, ErrServiceUnavailable) {
+		t.Errorf("expected ErrServiceUnavailable, got %v", err)
+	}
+	if got := count.Load(); got != 2 {
+		t.Errorf("expected 2 requests, got %v", got)
+	}
+
+	// After the cooldown, a probe is let through, and its success closes the breaker.
+	now = now.Add(time.Minute)
+	if err := getLicense(); err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+	if err := getLicense(); err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+	if got := count.Load(); got != 4 {
+		t.Errorf("expected 4 requests, got %v", got)
+	}
+}
+
+func TestCircuitBreakerProbeFailure(t *testing.T) {
+	b := newCircuitBreaker(1, time.Minute)
+	now := time.Date(2025, 5, 1, 0, 0, 0, 0, time.UTC)
+	b.now = func() time.Time { return now }
+
+	b.record(false)
+	if b.allow() {
+		t.Fatalf("expected breaker to be open")
+	}
+
+	now = now.Add(time.Minute)
+	if !b.allow() {
+		t.Fatalf("expected a probe to be allowed")
+	}
+	if b.allow() {
+		t.Fatalf("expected only one probe to be allowed")
+	}
+
+	b.record(false)
+	if b.allow() {
+		t.Fatalf("expected breaker to be open again")
+	}
+}
+
+func TestClientCircuitBreakerContextDone(t *testing.T) {
+	var block atomic.Bool
+	block.Store(true)
+	var count atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		count.Add(1)
+		if block.Load() {
+			<-r.Context().Done()
+			return
+		}
+		writeLicense(w, r)
+	}))
+	defer server.Close()
+
+	c := NewClient(server.Client(), KeygenConfig{
+		Endpoint:                server.URL,
+		CircuitBreakerThreshold: 1,
+		CircuitBreakerCooldown:  time.Minute,
+	})
+
+	canceledCtx, cancel := context.WithCancel(context.Background())
+	cancel()
+	deadlineCtx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	for _, ctx := range []context.Context{canceledCtx, deadlineCtx} {
+		_, err := c.GetLicense(ctx, GetLicenseOptions{LicenseIDOrKey: "license-1"})
+		if !errors.Is(err, ctx.Err()) {
+			t.Errorf("expected %v, got %v", ctx.Err(), err)
+		}
+	}
+
+	// The breaker is still closed, so Keygen is called.
+	block.Store(false)
+	if _, err := c.GetLicense(context.Background(), GetLicenseOptions{LicenseIDOrKey: "license-1"}); err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+	if got := count.Load(); got < 2 {
+		t.Errorf("expected Keygen to be called after the canceled requests, got %v requests", got)
+	}
+}
@@ -0,0 +1,133 @@
+package licensecache
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/authgear/authgear-once-license-server/pkg/keygen"
+	"github.com/authgear/authgear-once-license-server/pkg/slogging"
+)
+
+// DefaultRefreshInterval is the default of Backend.RefreshInterval.
+const DefaultRefreshInterval = time.Hour
+
+// Backend remembers the result of every successful activate, check and deactivate.
+// When CheckLicense fails with keygen.ErrServiceUnavailable,
+// it returns the last known status instead, if it was retrieved within GracePeriod.
+type Backend struct {
+	keygen.LicenseBackend
+	Store       Store
+	GracePeriod time.Duration
+	// RefreshInterval is how often an unchanged status is written to Store again.
+	// Installations check their license periodically, so an unchanged status is not written on every check.
+	// As a result, the age of a stale status is overestimated by up to RefreshInterval.
+	RefreshInterval time.Duration
+	Now             func() time.Time
+}
+
+var _ keygen.LicenseBackend = (*Backend)(nil)
+
+func NewBackend(backend keygen.LicenseBackend, store Store, gracePeriod time.Duration) *Backend {
+	return &Backend{
+		LicenseBackend:  backend,
+		Store:           store,
+		GracePeriod:     gracePeriod,
+		RefreshInterval: DefaultRefreshInterval,
+		Now:             time.Now,
+	}
+}
+
+func (b *Backend) ActivateLicense(ctx context.Context, opts keygen.LicenseOptions) (licenseID *keygen.LicenseID, err error) {
+	licenseID, err = b.LicenseBackend.ActivateLicense(ctx, opts)
+	b.remember(ctx, opts, licenseID, err)
+	return
+}
+
+func (b *Backend) DeactivateLicense(ctx context.Context, opts keygen.LicenseOptions) (licenseID *keygen.LicenseID, err error) {
+	licenseID, err = b.LicenseBackend.DeactivateLicense(ctx, opts)
+	b.remember(ctx, opts, licenseID, err)
+	return
+}
+
+func (b *Backend) CheckLicense(ctx context.Context, opts keygen.LicenseOptions) (licenseID *keygen.LicenseID, err error) {
+	licenseID, err = b.LicenseBackend.CheckLicense(ctx, opts)
+	b.remember(ctx, opts, licenseID, err)
+	if err == nil || !errors.Is(err, keygen.ErrServiceUnavailable) {
+		return
+	}
+
+	logger := slogging.GetLogger(ctx)
+	entry, getErr := b.Store.Get(ctx, NewKey(opts.LicenseKey, opts.Fingerprint))
+	if getErr != nil {
+		slogging.Error(ctx, logger, "failed to read license cache",
+			"error", getErr)
+		return
+	}
+	if entry == nil {
+		return
+	}
+
+	now := b.Now()
+	age := now.Sub(entry.CheckedAt)
+	if age > b.GracePeriod {
+		return
+	}
+
+	ageSeconds := int64(age / time.Second)
+	licenseID = &keygen.LicenseID{
+		ID:                      entry.LicenseID,
+		ExpireAt:                entry.ExpireAt,
+		IsActivated:             entry.IsActivated,
+		IsExpired:               entry.IsExpired || (entry.ExpireAt != nil && !now.Before(*entry.ExpireAt)),
+		StripeCheckoutSessionID: entry.StripeCheckoutSessionID,
+		StripeCustomerID:        entry.StripeCustomerID,
+		Stale:                   true,
+		StaleAgeSeconds:         &ageSeconds,
+	}
+	slogging.Warn(ctx, logger, "serve stale license status",
+		"keygen_license_id", entry.LicenseID,
+		"stale_age_seconds", ageSeconds,
+		"error", err)
+	err = nil
+	return
+}
+
+// remember stores a successful result, and forgets the entry when Keygen says the license is no longer good.
+// An unchanged status is stored again only after RefreshInterval.
+// A failure of the store is logged only, because the cache must not fail the request.
+func (b *Backend) remember(ctx context.Context, opts keygen.LicenseOptions, licenseID *keygen.LicenseID, err error) {
+	logger := slogging.GetLogger(ctx)
+	key := NewKey(opts.LicenseKey, opts.Fingerprint)
+
+	var storeErr error
+	switch {
+	case err == nil:
+		entry := Entry{
+			LicenseID:               licenseID.ID,
+			ExpireAt:                licenseID.ExpireAt,
+			IsActivated:             licenseID.IsActivated,
+			IsExpired:               licenseID.IsExpired,
+			StripeCheckoutSessionID: licenseID.StripeCheckoutSessionID,
+			StripeCustomerID:        licenseID.StripeCustomerID,
+			CheckedAt:               b.Now(),
+		}
+		var existing *Entry
+		existing, storeErr = b.Store.Get(ctx, key)
+		if storeErr != nil {
+			break
+		}
+		if existing != nil && existing.IsSameStatus(entry) && entry.CheckedAt.Sub(existing.CheckedAt) < b.RefreshInterval {
+			return
+		}
+		storeErr = b.Store.Set(ctx, key, entry)
+	case errors.Is(err, keygen.ErrServiceUnavailable):
+		return
+	default:
+		storeErr = b.Store.Delete(ctx, key)
+	}
+	if storeErr != nil {
+		slogging.Error(ctx, logger, "failed to write license cache",
+			"error", storeErr)
+	}
+}
@@ -0,0 +1,165 @@
+package licensecache
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/authgear/authgear-once-license-server/pkg/keygen"
+)
+
+// stubBackend returns licenseID and err from CheckLicense.
+type stubBackend struct {
+	keygen.LicenseBackend
+	licenseID *keygen.LicenseID
+	err       error
+}
+
+func (b *stubBackend) CheckLicense(ctx context.Context, opts keygen.LicenseOptions) (*keygen.LicenseID, error) {
+	return b.licenseID, b.err
+}
+
+func TestBackendCheckLicense(t *testing.T) {
+	ctx := context.Background()
+	opts := keygen.LicenseOptions{LicenseKey: "KEY-1", Fingerprint: "fg1"}
+	expireAt := time.Date(2026, 5, 1, 0, 0, 0, 0, time.UTC)
+	now := time.Date(2025, 5, 1, 0, 0, 0, 0, time.UTC)
+
+	stub := &stubBackend{
+		licenseID: &keygen.LicenseID{ID: "license-1", ExpireAt: &expireAt, IsActivated: true},
+	}
+	b := NewBackend(stub, NewFileStore(filepath.Join(t.TempDir(), "cache.json"), 0), 72*time.Hour)
+	b.Now = func() time.Time { return now }
+
+	// Keygen is unavailable, and nothing is remembered.
+	stub.err = keygen.ErrServiceUnavailable
+	_, err := b.CheckLicense(ctx, opts)
+	if !errors.Is(err, keygen.ErrServiceUnavailable) {
+		t.Fatalf("expected ErrServiceUnavailable, got %v", err)
+	}
+
+	// A successful check is remembered.
+	stub.err = nil
+	licenseID, err := b.CheckLicense(ctx, opts)
+	if err != nil || licenseID.Stale {
+		t.Fatalf("expected fresh status, got %v, %v", licenseID, err)
+	}
+
+	// Keygen is unavailable within the grace period.
+	stub.licenseID = nil
+	stub.err = keygen.ErrServiceUnavailable
+	now = now.Add(time.Hour)
+	licenseID, err = b.CheckLicense(ctx, opts)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if !licenseID.Stale || licenseID.StaleAgeSeconds == nil || *licenseID.StaleAgeSeconds != 3600 {
+		t.Errorf("expected stale status of age 3600, got %+v", licenseID)
+	}
+	if licenseID.ID != "license-1" || !licenseID.IsActivated || licenseID.IsExpired {
+		t.Errorf("expected the last known status, got %+v", licenseID)
+	}
+
+	// Another installation is not served the status.
+	_, err = b.CheckLicense(ctx, keygen.LicenseOptions{LicenseKey: "KEY-1", Fingerprint: "fg2"})
+	if !errors.Is(err, keygen.ErrServiceUnavailable) {
+		t.Errorf("expected ErrServiceUnavailable, got %v", err)
+	}
+
+	// Keygen is unavailable beyond the grace period.
+	now = now.Add(72 * time.Hour)
+	_, err = b.CheckLicense(ctx, opts)
+	if !errors.Is(err, keygen.ErrServiceUnavailable) {
+		t.Errorf("expected ErrServiceUnavailable, got %v", err)
+	}
+}
+
+// countingStore counts the calls to Set.
+type countingStore struct {
+	Store
+	sets int
+}
+
+func (s *countingStore) Set(ctx context.Context, key Key, entry Entry) error {
+	s.sets++
+	return s.Store.Set(ctx, key, entry)
+}
+
+func TestBackendWritesOnlyChanges(t *testing.T) {
+	ctx := context.Background()
+	opts := keygen.LicenseOptions{LicenseKey: "KEY-1", Fingerprint: "fg1"}
+	expireAt := time.Date(2026, 5, 1, 0, 0, 0, 0, time.UTC)
+	now := time.Date(2025, 5, 1, 0, 0, 0, 0, time.UTC)
+
+	stub := &stubBackend{
+		licenseID: &keygen.LicenseID{ID: "license-1", ExpireAt: &expireAt, IsActivated: true},
+	}
+	store := &countingStore{Store: NewFileStore(filepath.Join(t.TempDir(), "cache.json"), 0)}
+	b := NewBackend(stub, store, 72*time.Hour)
+	b.Now = func() time.Time { return now }
+
+	check := func() {
+		t.Helper()
+		_, err := b.CheckLicense(ctx, opts)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	}
+
+	check()
+	if store.sets != 1 {
+		t.Fatalf("expected the first status to be written, got %v writes", store.sets)
+	}
+
+	// An unchanged status is not written again within the refresh interval.
+	now = now.Add(30 * time.Minute)
+	check()
+	if store.sets != 1 {
+		t.Errorf("expected an unchanged status not to be written, got %v writes", store.sets)
+	}
+
+	// A changed status is written.
+	renewedExpireAt := expireAt.AddDate(1, 0, 0)
+	stub.licenseID = &keygen.LicenseID{ID: "license-1", ExpireAt: &renewedExpireAt, IsActivated: true}
+	check()
+	if store.sets != 2 {
+		t.Errorf("expected a changed status to be written, got %v writes", store.sets)
+	}
+
+	// An unchanged status is written after the refresh interval.
+	now = now.Add(DefaultRefreshInterval)
+	check()
+	if store.sets != 3 {
+		t.Errorf("expected an unchanged status to be refreshed, got %v writes", store.sets)
+	}
+}
+
+func TestBackendForgetsOnDefinitiveError(t *testing.T) {
+	ctx := context.Background()
+	opts := keygen.LicenseOptions{LicenseKey: "KEY-1", Fingerprint: "fg1"}
+
+	stub := &stubBackend{
+		licenseID: &keygen.LicenseID{ID: "license-1", IsActivated: true},
+	}
+	b := NewBackend(stub, NewFileStore(filepath.Join(t.TempDir(), "cache.json"), 0), 72*time.Hour)
+
+	_, err := b.CheckLicense(ctx, opts)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	stub.licenseID = nil
+	stub.err = keygen.ErrLicenseSuspended
+	_, err = b.CheckLicense(ctx, opts)
+	if !errors.Is(err, keygen.ErrLicenseSuspended) {
+		t.Fatalf("expected ErrLicenseSuspended, got %v", err)
+	}
+
+	stub.err = keygen.ErrServiceUnavailable
+	_, err = b.CheckLicense(ctx, opts)
+	if !errors.Is(err, keygen.ErrServiceUnavailable) {
+		t.Errorf("expected suspended license not to be served from cache, got %v", err)
+	}
+}
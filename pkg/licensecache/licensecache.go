@@ -0,0 +1,119 @@
+// Package licensecache remembers the last successful license status of each installation,
+// so that /v1/license/check keeps working during a Keygen outage.
+package licensecache
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+
+	"github.com/authgear/authgear-once-license-server/pkg/filestore"
+)
+
+// Entry is the last successful license status of an installation.
+// The licensee email is not stored. A stale status is served without it,
+// and the handler looks it up in Stripe by StripeCustomerID instead.
+type Entry struct {
+	LicenseID               string     `json:"license_id"`
+	ExpireAt                *time.Time `json:"expire_at"`
+	IsActivated             bool       `json:"is_activated"`
+	IsExpired               bool       `json:"is_expired"`
+	StripeCheckoutSessionID string     `json:"stripe_checkout_session_id,omitempty"`
+	StripeCustomerID        string     `json:"stripe_customer_id,omitempty"`
+	CheckedAt               time.Time  `json:"checked_at"`
+}
+
+// IsSameStatus tells whether e and other are the same license status, regardless of CheckedAt.
+func (e Entry) IsSameStatus(other Entry) bool {
+	isSameTime := func(a *time.Time, b *time.Time) bool {
+		if a == nil || b == nil {
+			return a == nil && b == nil
+		}
+		return a.Equal(*b)
+	}
+	return e.LicenseID == other.LicenseID &&
+		isSameTime(e.ExpireAt, other.ExpireAt) &&
+		e.IsActivated == other.IsActivated &&
+		e.IsExpired == other.IsExpired &&
+		e.StripeCheckoutSessionID == other.StripeCheckoutSessionID &&
+		e.StripeCustomerID == other.StripeCustomerID
+}
+
+// Key identifies an installation.
+// It is a hash of the license key and the fingerprint, so that the store does not contain license keys.
+type Key string
+
+func NewKey(licenseKey string, fingerprint string) Key {
+	h := sha256.New()
+	h.Write([]byte(licenseKey))
+	h.Write([]byte{0})
+	h.Write([]byte(fingerprint))
+	return Key(hex.EncodeToString(h.Sum(nil)))
+}
+
+type Store interface {
+	// Get returns nil if there is no entry for key.
+	Get(ctx context.Context, key Key) (*Entry, error)
+	Set(ctx context.Context, key Key, entry Entry) error
+	Delete(ctx context.Context, key Key) error
+}
+
+// FileStore is a Store backed by a JSON file.
+type FileStore struct {
+	// MaxAge is how long an entry is kept after CheckedAt.
+	// Older entries are dropped when the file is written. 0 means forever.
+	MaxAge time.Duration
+	Now    func() time.Time
+
+	entries *filestore.Map[Key, Entry]
+}
+
+var _ Store = (*FileStore)(nil)
+
+func NewFileStore(path string, maxAge time.Duration) *FileStore {
+	return &FileStore{
+		MaxAge:  maxAge,
+		Now:     time.Now,
+		entries: filestore.NewMap[Key, Entry](path),
+	}
+}
+
+func (s *FileStore) Get(ctx context.Context, key Key) (*Entry, error) {
+	entry, ok, err := s.entries.Get(key)
+	if err != nil || !ok {
+		return nil, err
+	}
+	return &entry, nil
+}
+
+func (s *FileStore) Set(ctx context.Context, key Key, entry Entry) error {
+	return s.entries.Update(func(entries map[Key]Entry) (bool, error) {
+		entries[key] = entry
+		s.dropOldEntries(entries)
+		return true, nil
+	})
+}
+
+func (s *FileStore) Delete(ctx context.Context, key Key) error {
+	return s.entries.Update(func(entries map[Key]Entry) (bool, error) {
+		if _, ok := entries[key]; !ok {
+			return false, nil
+		}
+		delete(entries, key)
+		s.dropOldEntries(entries)
+		return true, nil
+	})
+}
+
+func (s *FileStore) dropOldEntries(entries map[Key]Entry) {
+	if s.MaxAge <= 0 {
+		return
+	}
+	checkedBefore := s.Now().Add(-s.MaxAge)
+	for key, entry := range entries {
+		if entry.CheckedAt.Before(checkedBefore) {
+			delete(entries, key)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package licensecache
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestNewKey(t *testing.T) {
+	if NewKey("KEY-1", "fg1") != NewKey("KEY-1", "fg1") {
+		t.Errorf("expected key to be deterministic")
+	}
+	if NewKey("KEY-1", "fg1") == NewKey("KEY-1", "fg2") {
+		t.Errorf("expected key to depend on fingerprint")
+	}
+	// The separator prevents ambiguity.
+	if NewKey("KEY-1f", "g1") == NewKey("KEY-1", "fg1") {
+		t.Errorf("expected key to be unambiguous")
+	}
+}
+
+func TestFileStore(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "cache.json")
+	key := NewKey("KEY-1", "fg1")
+	expireAt := time.Date(2026, 5, 1, 0, 0, 0, 0, time.UTC)
+	entry := Entry{
+		LicenseID:   "license-1",
+		ExpireAt:    &expireAt,
+		IsActivated: true,
+		CheckedAt:   time.Date(2025, 5, 1, 0, 0, 0, 0, time.UTC),
+	}
+
+	s := NewFileStore(path, 0)
+	got, err := s.Get(ctx, key)
+	if err != nil || got != nil {
+		t.Fatalf("expected no entry, got %v, %v", got, err)
+	}
+
+	err = s.Set(ctx, key, entry)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	// Another store reads the entry from the file.
+	got, err = NewFileStore(path, 0).Get(ctx, key)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if !reflect.DeepEqual(*got, entry) {
+		t.Errorf("expected %v, got %v", entry, *got)
+	}
+
+	err = s.Delete(ctx, key)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	got, err = NewFileStore(path, 0).Get(ctx, key)
+	if err != nil || got != nil {
+		t.Fatalf("expected no entry, got %v, %v", got, err)
+	}
+}
+
+func TestFileStoreMaxAge(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2025, 5, 1, 0, 0, 0, 0, time.UTC)
+	path := filepath.Join(t.TempDir(), "cache.json")
+	s := NewFileStore(path, 72*time.Hour)
+	s.Now = func() time.Time { return now }
+
+	oldKey := NewKey("KEY-1", "fg1")
+	err := s.Set(ctx, oldKey, Entry{LicenseID: "license-1", CheckedAt: now.Add(-73 * time.Hour)})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	newKey := NewKey("KEY-2", "fg2")
+	err = s.Set(ctx, newKey, Entry{LicenseID: "license-2", CheckedAt: now})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	// The entry older than MaxAge is dropped when the file is written.
+	s = NewFileStore(path, 72*time.Hour)
+	if got, _ := s.Get(ctx, oldKey); got != nil {
+		t.Errorf("expected old entry to be dropped, got %v", got)
+	}
+	if got, _ := s.Get(ctx, newKey); got == nil {
+		t.Errorf("expected new entry to be kept")
+	}
+}
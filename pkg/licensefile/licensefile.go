@@ -0,0 +1,128 @@
+package licensefile
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const AlgorithmEd25519 = "ed25519"
+
+var ErrInvalidSigningKey = errors.New("licensefile: invalid signing key")
+var ErrInvalidLicenseFile = errors.New("licensefile: invalid license file")
+var ErrInvalidSignature = errors.New("licensefile: invalid signature")
+var ErrFingerprintMismatch = errors.New("licensefile: fingerprint mismatch")
+var ErrLicenseFileExpired = errors.New("licensefile: license file expired")
+
+// DefaultValidity is how long a license file is valid after it is issued.
+// A license file is valid for a bounded time even if the license never expires,
+// so that a suspension of the license reaches an offline installation when it fetches the file again.
+const DefaultValidity = 30 * 24 * time.Hour
+
+// Payload is the signed content of a license file.
+// It carries the fields of keygen.LicenseID, plus the fingerprint the license is activated on.
+type Payload struct {
+	LicenseKey    string     `json:"license_key"`
+	Fingerprint   string     `json:"fingerprint"`
+	ExpireAt      *time.Time `json:"expire_at"`
+	IsActivated   bool       `json:"is_activated"`
+	IsExpired     bool       `json:"is_expired"`
+	LicenseeEmail *string    `json:"licensee_email"`
+	IssuedAt      time.Time  `json:"issued_at"`
+	// ValidUntil is when the license file expires, independent of ExpireAt.
+	// If it is zero, the license file expires at IssuedAt + DefaultValidity.
+	ValidUntil time.Time `json:"valid_until,omitzero"`
+}
+
+// LicenseFile is an API object.
+// Payload is the base64url-encoded JSON of Payload.
+// Signature is the base64url-encoded signature of the bytes of Payload, that is, the encoded string.
+type LicenseFile struct {
+	Algorithm string `json:"alg"`
+	Payload   string `json:"payload"`
+	Signature string `json:"signature"`
+}
+
+// ParseSigningKey parses a base64-encoded Ed25519 seed.
+// A seed can be generated with `openssl rand -base64 32`.
+func ParseSigningKey(base64Seed string) (ed25519.PrivateKey, error) {
+	seed, err := base64.StdEncoding.DecodeString(base64Seed)
+	if err != nil {
+		return nil, errors.Join(ErrInvalidSigningKey, err)
+	}
+	if len(seed) != ed25519.SeedSize {
+		return nil, fmt.Errorf("%w: expected %v bytes, got %v", ErrInvalidSigningKey, ed25519.SeedSize, len(seed))
+	}
+	return ed25519.NewKeyFromSeed(seed), nil
+}
+
+func Sign(privateKey ed25519.PrivateKey, payload Payload) (*LicenseFile, error) {
+	payloadBytes, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	encodedPayload := base64.RawURLEncoding.EncodeToString(payloadBytes)
+	signature := ed25519.Sign(privateKey, []byte(encodedPayload))
+
+	return &LicenseFile{
+		Algorithm: AlgorithmEd25519,
+		Payload:   encodedPayload,
+		Signature: base64.RawURLEncoding.EncodeToString(signature),
+	}, nil
+}
+
+type VerifyOptions struct {
+	PublicKey   ed25519.PublicKey
+	Fingerprint string
+	Now         time.Time
+}
+
+// Verify is what the authgear-once command does to verify a license file without network access.
+// It returns the following errors:
+// - ErrInvalidLicenseFile
+// - ErrInvalidSignature
+// - ErrFingerprintMismatch
+// - ErrLicenseFileExpired
+func Verify(f *LicenseFile, opts VerifyOptions) (*Payload, error) {
+	if f.Algorithm != AlgorithmEd25519 {
+		return nil, fmt.Errorf("%w: unsupported alg %v", ErrInvalidLicenseFile, f.Algorithm)
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(f.Signature)
+	if err != nil {
+		return nil, errors.Join(ErrInvalidLicenseFile, err)
+	}
+	if !ed25519.Verify(opts.PublicKey, []byte(f.Payload), signature) {
+		return nil, ErrInvalidSignature
+	}
+
+	payloadBytes, err := base64.RawURLEncoding.DecodeString(f.Payload)
+	if err != nil {
+		return nil, errors.Join(ErrInvalidLicenseFile, err)
+	}
+	var payload Payload
+	err = json.Unmarshal(payloadBytes, &payload)
+	if err != nil {
+		return nil, errors.Join(ErrInvalidLicenseFile, err)
+	}
+
+	if payload.Fingerprint != opts.Fingerprint {
+		return nil, ErrFingerprintMismatch
+	}
+	if payload.ExpireAt != nil && !opts.Now.Before(*payload.ExpireAt) {
+		return nil, ErrLicenseFileExpired
+	}
+	validUntil := payload.ValidUntil
+	if validUntil.IsZero() {
+		validUntil = payload.IssuedAt.Add(DefaultValidity)
+	}
+	if !opts.Now.Before(validUntil) {
+		return nil, ErrLicenseFileExpired
+	}
+
+	return &payload, nil
+}
@@ -0,0 +1,229 @@
+package licensefile
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseSigningKey(t *testing.T) {
+	seed := strings.Repeat("a", ed25519.SeedSize)
+
+	tests := []struct {
+		name          string
+		input         string
+		expectedError error
+	}{
+		{
+			name:          "valid seed",
+			input:         base64.StdEncoding.EncodeToString([]byte(seed)),
+			expectedError: nil,
+		},
+		{
+			name:          "not base64",
+			input:         "not base64!",
+			expectedError: ErrInvalidSigningKey,
+		},
+		{
+			name:          "too short",
+			input:         base64.StdEncoding.EncodeToString([]byte("short")),
+			expectedError: ErrInvalidSigningKey,
+		},
+		{
+			name:          "empty",
+			input:         "",
+			expectedError: ErrInvalidSigningKey,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			privateKey, err := ParseSigningKey(tt.input)
+			if tt.expectedError != nil {
+				if !errors.Is(err, tt.expectedError) {
+					t.Errorf("expected error %v, got %v", tt.expectedError, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if !privateKey.Equal(ed25519.NewKeyFromSeed([]byte(seed))) {
+				t.Errorf("expected private key to be derived from the seed")
+			}
+		})
+	}
+}
+
+func TestSignAndVerify(t *testing.T) {
+	privateKey := ed25519.NewKeyFromSeed([]byte(strings.Repeat("a", ed25519.SeedSize)))
+	publicKey := privateKey.Public().(ed25519.PublicKey)
+	otherPublicKey := ed25519.NewKeyFromSeed([]byte(strings.Repeat("b", ed25519.SeedSize))).Public().(ed25519.PublicKey)
+
+	email := "user@example.com"
+	expireAt := time.Date(2026, 5, 1, 0, 0, 0, 0, time.UTC)
+	payload := Payload{
+		LicenseKey:    "8ECE46-C5CB99-263245-93E5CC-AD0361-V3",
+		Fingerprint:   "fg1",
+		ExpireAt:      &expireAt,
+		IsActivated:   true,
+		IsExpired:     false,
+		LicenseeEmail: &email,
+		IssuedAt:      time.Date(2025, 5, 1, 0, 0, 0, 0, time.UTC),
+		ValidUntil:    expireAt.AddDate(0, 1, 0),
+	}
+
+	f, err := Sign(privateKey, payload)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	tamperedPayload := payload
+	tamperedExpireAt := expireAt.AddDate(10, 0, 0)
+	tamperedPayload.ExpireAt = &tamperedExpireAt
+	tampered, err := Sign(privateKey, tamperedPayload)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	tampered.Signature = f.Signature
+
+	tests := []struct {
+		name          string
+		file          *LicenseFile
+		opts          VerifyOptions
+		expectedError error
+	}{
+		{
+			name: "valid",
+			file: f,
+			opts: VerifyOptions{
+				PublicKey:   publicKey,
+				Fingerprint: "fg1",
+				Now:         expireAt.Add(-time.Second),
+			},
+			expectedError: nil,
+		},
+		{
+			name: "expired",
+			file: f,
+			opts: VerifyOptions{
+				PublicKey:   publicKey,
+				Fingerprint: "fg1",
+				Now:         expireAt,
+			},
+			expectedError: ErrLicenseFileExpired,
+		},
+		{
+			name: "another fingerprint",
+			file: f,
+			opts: VerifyOptions{
+				PublicKey:   publicKey,
+				Fingerprint: "fg2",
+				Now:         expireAt.Add(-time.Second),
+			},
+			expectedError: ErrFingerprintMismatch,
+		},
+		{
+			name: "another public key",
+			file: f,
+			opts: VerifyOptions{
+				PublicKey:   otherPublicKey,
+				Fingerprint: "fg1",
+				Now:         expireAt.Add(-time.Second),
+			},
+			expectedError: ErrInvalidSignature,
+		},
+		{
+			name: "tampered payload",
+			file: tampered,
+			opts: VerifyOptions{
+				PublicKey:   publicKey,
+				Fingerprint: "fg1",
+				Now:         expireAt.Add(-time.Second),
+			},
+			expectedError: ErrInvalidSignature,
+		},
+		{
+			name: "unknown alg",
+			file: &LicenseFile{
+				Algorithm: "none",
+				Payload:   f.Payload,
+				Signature: f.Signature,
+			},
+			opts: VerifyOptions{
+				PublicKey:   publicKey,
+				Fingerprint: "fg1",
+				Now:         expireAt.Add(-time.Second),
+			},
+			expectedError: ErrInvalidLicenseFile,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			verified, err := Verify(tt.file, tt.opts)
+			if tt.expectedError != nil {
+				if !errors.Is(err, tt.expectedError) {
+					t.Errorf("expected error %v, got %v", tt.expectedError, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if !reflect.DeepEqual(*verified, payload) {
+				t.Errorf("expected %v == %v", *verified, payload)
+			}
+		})
+	}
+}
+
+// TestVerifyValidity tests that a license file is valid for a bounded time, even if the license never expires.
+func TestVerifyValidity(t *testing.T) {
+	privateKey := ed25519.NewKeyFromSeed([]byte(strings.Repeat("a", ed25519.SeedSize)))
+	publicKey := privateKey.Public().(ed25519.PublicKey)
+	issuedAt := time.Date(2025, 5, 1, 0, 0, 0, 0, time.UTC)
+	validUntil := issuedAt.Add(7 * 24 * time.Hour)
+
+	tests := []struct {
+		name          string
+		validUntil    time.Time
+		now           time.Time
+		expectedError error
+	}{
+		{"before valid_until", validUntil, validUntil.Add(-time.Second), nil},
+		{"at valid_until", validUntil, validUntil, ErrLicenseFileExpired},
+		{"without valid_until", time.Time{}, issuedAt.Add(DefaultValidity - time.Second), nil},
+		{"without valid_until after default validity", time.Time{}, issuedAt.Add(DefaultValidity), ErrLicenseFileExpired},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The license never expires.
+			f, err := Sign(privateKey, Payload{
+				LicenseKey:  "8ECE46-C5CB99-263245-93E5CC-AD0361-V3",
+				Fingerprint: "fg1",
+				ExpireAt:    nil,
+				IsActivated: true,
+				IssuedAt:    issuedAt,
+				ValidUntil:  tt.validUntil,
+			})
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+
+			_, err = Verify(f, VerifyOptions{
+				PublicKey:   publicKey,
+				Fingerprint: "fg1",
+				Now:         tt.now,
+			})
+			if !errors.Is(err, tt.expectedError) {
+				t.Errorf("expected error %v, got %v", tt.expectedError, err)
+			}
+		})
+	}
+}
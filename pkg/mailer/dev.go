@@ -0,0 +1,90 @@
+package mailer
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/authgear/authgear-once-license-server/pkg/slogging"
+)
+
+// FileMailer writes each email to a .eml file in Dir, instead of sending it.
+// It is for development.
+type FileMailer struct {
+	Dir string
+	Now func() time.Time
+}
+
+var _ Mailer = (*FileMailer)(nil)
+
+func NewFileMailer(dir string) *FileMailer {
+	return &FileMailer{
+		Dir: dir,
+		Now: time.Now,
+	}
+}
+
+func (m *FileMailer) SendEmail(ctx context.Context, options EmailOptions) error {
+	logger := slogging.GetLogger(ctx)
+
+	err := os.MkdirAll(m.Dir, 0o755)
+	if err != nil {
+		return err
+	}
+
+	suffix := make([]byte, 4)
+	_, err = rand.Read(suffix)
+	if err != nil {
+		return err
+	}
+	// The name sorts by time.
+	name := fmt.Sprintf("%v-%v.eml", m.Now().UTC().Format("20060102T150405.000000000Z"), hex.EncodeToString(suffix))
+	path := filepath.Join(m.Dir, name)
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	err = WriteEML(f, options)
+	if err != nil {
+		f.Close()
+		return err
+	}
+	err = f.Close()
+	if err != nil {
+		return err
+	}
+
+	slogging.Info(ctx, logger, "wrote email to file",
+		"to", options.To,
+		"subject", options.Subject,
+		"path", path)
+	return nil
+}
+
+// LogMailer logs each email, instead of sending it.
+// It is for development.
+type LogMailer struct{}
+
+var _ Mailer = LogMailer{}
+
+func (LogMailer) SendEmail(ctx context.Context, options EmailOptions) error {
+	logger := slogging.GetLogger(ctx)
+
+	var buf strings.Builder
+	err := WriteEML(&buf, options)
+	if err != nil {
+		return err
+	}
+
+	slogging.Info(ctx, logger, "email",
+		"to", options.To,
+		"subject", options.Subject,
+		"eml", buf.String())
+	return nil
+}
@@ -0,0 +1,71 @@
+package mailer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+var ErrHTTPMailerUnexpectedResponse = errors.New("mailer: unexpected response from mail API")
+
+// HTTPMailer sends emails through a generic HTTP mail API.
+// The email is POSTed to Endpoint as a JSON object with the fields from, to, subject, html and text.
+// text is omitted if the email has no plain-text alternative.
+// Any 2xx response means the email is accepted.
+type HTTPMailer struct {
+	HTTPClient *http.Client
+	Endpoint   string
+	// Token is sent as a bearer token, if it is non-empty.
+	Token string
+}
+
+var _ Mailer = (*HTTPMailer)(nil)
+
+type httpMailerRequestBody struct {
+	From    string `json:"from"`
+	To      string `json:"to"`
+	Subject string `json:"subject"`
+	HTML    string `json:"html"`
+	Text    string `json:"text,omitempty"`
+}
+
+func (m *HTTPMailer) SendEmail(ctx context.Context, options EmailOptions) error {
+	body, err := json.Marshal(httpMailerRequestBody{
+		From:    options.Sender,
+		To:      options.To,
+		Subject: options.Subject,
+		HTML:    options.HTMLBody,
+		Text:    options.TextBody,
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", m.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if m.Token != "" {
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %v", m.Token))
+	}
+
+	resp, err := m.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		// Keep the error short, the response may be a whole HTML page.
+		b, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%w: status %v: %s", ErrHTTPMailerUnexpectedResponse, resp.StatusCode, b)
+	}
+
+	_, _ = io.Copy(io.Discard, resp.Body)
+	return nil
+}
@@ -0,0 +1,50 @@
+// Package mailer sends emails through a configurable transport.
+package mailer
+
+import (
+	"context"
+	"io"
+
+	"gopkg.in/gomail.v2"
+)
+
+type EmailOptions struct {
+	Sender   string
+	Subject  string
+	HTMLBody string
+	// TextBody is the plain-text alternative of HTMLBody.
+	// If it is set, the email is sent as multipart/alternative.
+	TextBody string
+	To       string
+}
+
+// Mailer sends an email.
+type Mailer interface {
+	SendEmail(ctx context.Context, options EmailOptions) error
+}
+
+func newMessage(options EmailOptions) *gomail.Message {
+	m := gomail.NewMessage()
+
+	m.SetHeader("From", options.Sender)
+
+	m.SetHeader("To", options.To)
+
+	m.SetHeader("Subject", options.Subject)
+
+	// The last part of multipart/alternative is the preferred one, so the HTML part comes last.
+	if options.TextBody != "" {
+		m.SetBody("text/plain", options.TextBody)
+		m.AddAlternative("text/html", options.HTMLBody)
+	} else {
+		m.SetBody("text/html", options.HTMLBody)
+	}
+
+	return m
+}
+
+// WriteEML writes the email in the Internet Message Format, the content of a .eml file.
+func WriteEML(w io.Writer, options EmailOptions) error {
+	_, err := newMessage(options).WriteTo(w)
+	return err
+}
@@ -0,0 +1,269 @@
+package mailer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/mail"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+var testEmail = EmailOptions{
+	Sender:   "noreply@example.com",
+	To:       "user@example.com",
+	Subject:  "Installing Authgear ONCE",
+	HTMLBody: "<p>Hello</p>",
+}
+
+// fakeSMTPServer accepts every message and keeps the recipients.
+type fakeSMTPServer struct {
+	listener net.Listener
+
+	mu         sync.Mutex
+	recipients []string
+}
+
+func newFakeSMTPServer(t *testing.T) *fakeSMTPServer {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	s := &fakeSMTPServer{listener: l}
+	t.Cleanup(func() { l.Close() })
+	go s.serve()
+	return s
+}
+
+func (s *fakeSMTPServer) Options() NewSMTPMailerOptions {
+	host, port, _ := net.SplitHostPort(s.listener.Addr().String())
+	p, _ := strconv.Atoi(port)
+	return NewSMTPMailerOptions{SMTPHost: host, SMTPPort: p}
+}
+
+func (s *fakeSMTPServer) Recipients() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.recipients...)
+}
+
+func (s *fakeSMTPServer) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *fakeSMTPServer) handle(conn net.Conn) {
+	defer conn.Close()
+	c := textproto.NewConn(conn)
+	_ = c.PrintfLine("220 localhost")
+	for {
+		line, err := c.ReadLine()
+		if err != nil {
+			return
+		}
+		cmd := strings.ToUpper(line)
+		switch {
+		case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+			_ = c.PrintfLine("250 localhost")
+		case strings.HasPrefix(cmd, "RCPT TO:"):
+			s.mu.Lock()
+			s.recipients = append(s.recipients, strings.Trim(line[len("RCPT TO:"):], "<> "))
+			s.mu.Unlock()
+			_ = c.PrintfLine("250 OK")
+		case strings.HasPrefix(cmd, "DATA"):
+			_ = c.PrintfLine("354 Go ahead")
+			_, err = c.ReadDotBytes()
+			if err != nil {
+				return
+			}
+			_ = c.PrintfLine("250 OK")
+		case strings.HasPrefix(cmd, "QUIT"):
+			_ = c.PrintfLine("221 Bye")
+			return
+		default:
+			_ = c.PrintfLine("250 OK")
+		}
+	}
+}
+
+func TestSMTPMailer(t *testing.T) {
+	server := newFakeSMTPServer(t)
+	m := NewSMTPMailer(server.Options())
+
+	err := m.SendEmail(context.Background(), testEmail)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if got := server.Recipients(); len(got) != 1 || got[0] != testEmail.To {
+		t.Errorf("expected recipients [%v], got %v", testEmail.To, got)
+	}
+}
+
+func TestHTTPMailer(t *testing.T) {
+	tests := []struct {
+		name          string
+		statusCode    int
+		expectedError error
+	}{
+		{"accepted", http.StatusAccepted, nil},
+		{"rejected", http.StatusUnprocessableEntity, ErrHTTPMailerUnexpectedResponse},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got httpMailerRequestBody
+			var authorization string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				authorization = r.Header.Get("Authorization")
+				_ = json.NewDecoder(r.Body).Decode(&got)
+				w.WriteHeader(tt.statusCode)
+			}))
+			defer server.Close()
+
+			m := &HTTPMailer{
+				HTTPClient: server.Client(),
+				Endpoint:   server.URL,
+				Token:      "token",
+			}
+			err := m.SendEmail(context.Background(), testEmail)
+			if tt.expectedError == nil && err != nil {
+				t.Errorf("expected no error, got %v", err)
+			}
+			if tt.expectedError != nil && !errors.Is(err, tt.expectedError) {
+				t.Errorf("expected error %v, got %v", tt.expectedError, err)
+			}
+
+			expected := httpMailerRequestBody{
+				From:    testEmail.Sender,
+				To:      testEmail.To,
+				Subject: testEmail.Subject,
+				HTML:    testEmail.HTMLBody,
+				Text:    testEmail.TextBody,
+			}
+			if got != expected {
+				t.Errorf("expected request body %+v, got %+v", expected, got)
+			}
+			if authorization != "Bearer token" {
+				t.Errorf("expected bearer token, got %q", authorization)
+			}
+		})
+	}
+}
+
+func TestFileMailer(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "mail")
+	m := NewFileMailer(dir)
+	m.Now = func() time.Time { return time.Date(2025, 5, 1, 0, 0, 0, 0, time.UTC) }
+
+	err := m.SendEmail(context.Background(), testEmail)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	matches, err := filepath.Glob(filepath.Join(dir, "20250501T000000.000000000Z-*.eml"))
+	if err != nil || len(matches) != 1 {
+		t.Fatalf("expected 1 .eml file, got %v, %v", matches, err)
+	}
+	b, err := os.ReadFile(matches[0])
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	eml := string(b)
+	for _, expected := range []string{
+		"From: noreply@example.com",
+		"To: user@example.com",
+		"Subject: Installing Authgear ONCE",
+		"<p>Hello</p>",
+	} {
+		if !strings.Contains(eml, expected) {
+			t.Errorf("expected %q in %v", expected, eml)
+		}
+	}
+}
+
+func TestWriteEML(t *testing.T) {
+	tests := []struct {
+		name          string
+		textBody      string
+		expectedParts []string
+	}{
+		{"html only", "", []string{"text/html"}},
+		{"with text", "Hello", []string{"text/plain", "text/html"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options := testEmail
+			options.TextBody = tt.textBody
+
+			var buf bytes.Buffer
+			err := WriteEML(&buf, options)
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			msg, err := mail.ReadMessage(&buf)
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+
+			if len(tt.expectedParts) == 1 {
+				if mediaType != tt.expectedParts[0] {
+					t.Errorf("expected %v, got %v", tt.expectedParts[0], mediaType)
+				}
+				return
+			}
+
+			if mediaType != "multipart/alternative" {
+				t.Fatalf("expected multipart/alternative, got %v", mediaType)
+			}
+			var parts []string
+			bodies := map[string]string{}
+			r := multipart.NewReader(msg.Body, params["boundary"])
+			for {
+				part, err := r.NextPart()
+				if errors.Is(err, io.EOF) {
+					break
+				}
+				if err != nil {
+					t.Fatalf("expected no error, got %v", err)
+				}
+				partType, _, _ := mime.ParseMediaType(part.Header.Get("Content-Type"))
+				b, _ := io.ReadAll(part)
+				parts = append(parts, partType)
+				bodies[partType] = string(b)
+			}
+			if strings.Join(parts, ",") != strings.Join(tt.expectedParts, ",") {
+				t.Errorf("expected parts %v, got %v", tt.expectedParts, parts)
+			}
+			if bodies["text/plain"] != options.TextBody {
+				t.Errorf("expected text part %q, got %q", options.TextBody, bodies["text/plain"])
+			}
+			if bodies["text/html"] != options.HTMLBody {
+				t.Errorf("expected html part %q, got %q", options.HTMLBody, bodies["text/html"])
+			}
+		})
+	}
+}
@@ -0,0 +1,36 @@
+package mailer
+
+import (
+	"context"
+
+	"gopkg.in/gomail.v2"
+)
+
+type NewSMTPMailerOptions struct {
+	SMTPHost     string
+	SMTPPort     int
+	SMTPUsername string
+	SMTPPassword string
+}
+
+// SMTPMailer sends emails through an SMTP server.
+type SMTPMailer struct {
+	Dialer *gomail.Dialer
+}
+
+var _ Mailer = (*SMTPMailer)(nil)
+
+func NewSMTPMailer(options NewSMTPMailerOptions) *SMTPMailer {
+	return &SMTPMailer{
+		Dialer: gomail.NewDialer(options.SMTPHost, options.SMTPPort, options.SMTPUsername, options.SMTPPassword),
+	}
+}
+
+func (m *SMTPMailer) SendEmail(ctx context.Context, options EmailOptions) error {
+	err := m.Dialer.DialAndSend(newMessage(options))
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
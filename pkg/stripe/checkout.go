@@ -2,6 +2,7 @@ package stripe
 
 import (
 	"context"
+	"time"
 
 	stripe "github.com/stripe/stripe-go/v82"
 	"github.com/stripe/stripe-go/v82/client"
@@ -9,11 +10,17 @@ import (
 
 const MetadataKeyMarker = "authgear_once_license_server"
 
+// MetadataKeyRenewLicenseID is present when the checkout session is to renew an existing license.
+const MetadataKeyRenewLicenseID = "authgear_once_renew_license_id"
+
 type CheckoutSessionParams struct {
 	MarkerValue string
 	SuccessURL  string
 	CancelURL   string
 	PriceID     string
+	// RenewLicenseID is the Keygen license ID to renew.
+	// It is empty when the checkout session is to purchase a new license.
+	RenewLicenseID string
 }
 
 func NewCheckoutSession(ctx context.Context, client *client.API, params *CheckoutSessionParams) (*stripe.CheckoutSession, error) {
@@ -37,6 +44,10 @@ func NewCheckoutSession(ctx context.Context, client *client.API, params *Checkou
 		},
 	}
 
+	if params.RenewLicenseID != "" {
+		sessParams.Metadata[MetadataKeyRenewLicenseID] = params.RenewLicenseID
+	}
+
 	sess, err := client.CheckoutSessions.New(sessParams)
 	if err != nil {
 		return nil, err
@@ -44,3 +55,45 @@ func NewCheckoutSession(ctx context.Context, client *client.API, params *Checkou
 
 	return sess, nil
 }
+
+// GetCheckoutSession retrieves the checkout session with its line items expanded.
+func GetCheckoutSession(ctx context.Context, client *client.API, checkoutSessionID string) (*stripe.CheckoutSession, error) {
+	return client.CheckoutSessions.Get(checkoutSessionID, &stripe.CheckoutSessionParams{
+		Expand: []*string{
+			stripe.String("line_items"),
+		},
+	})
+}
+
+type ListCompletedCheckoutSessionsOptions struct {
+	MarkerValue string
+	// CreatedFrom is inclusive.
+	CreatedFrom time.Time
+	// CreatedTo is exclusive.
+	CreatedTo time.Time
+}
+
+// ListCompletedCheckoutSessions lists the completed checkout sessions created by us in the given period.
+// The line items of the checkout sessions are not expanded.
+func ListCompletedCheckoutSessions(ctx context.Context, client *client.API, opts ListCompletedCheckoutSessionsOptions) ([]*stripe.CheckoutSession, error) {
+	iter := client.CheckoutSessions.List(&stripe.CheckoutSessionListParams{
+		CreatedRange: &stripe.RangeQueryParams{
+			GreaterThanOrEqual: opts.CreatedFrom.Unix(),
+			LesserThan:         opts.CreatedTo.Unix(),
+		},
+		Status: stripe.String(string(stripe.CheckoutSessionStatusComplete)),
+	})
+
+	var sessions []*stripe.CheckoutSession
+	for iter.Next() {
+		sess := iter.CheckoutSession()
+		if sess.Metadata[MetadataKeyMarker] != opts.MarkerValue {
+			continue
+		}
+		sessions = append(sessions, sess)
+	}
+	if err := iter.Err(); err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
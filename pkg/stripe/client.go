@@ -1,9 +1,27 @@
 package stripe
 
 import (
+	"net/http"
+	"time"
+
+	stripe "github.com/stripe/stripe-go/v82"
 	"github.com/stripe/stripe-go/v82/client"
 )
 
-func NewClient(secretKey string) *client.API {
-	return client.New(secretKey, nil)
+type ClientOptions struct {
+	// Timeout is the timeout of each request to Stripe.
+	Timeout time.Duration
+	// MaxNetworkRetries is the maximum number of retries the Stripe library makes.
+	// The library retries only requests that are safe to retry, with idempotency keys.
+	MaxNetworkRetries int64
+}
+
+func NewClient(secretKey string, opts ClientOptions) *client.API {
+	backends := stripe.NewBackendsWithConfig(&stripe.BackendConfig{
+		HTTPClient: &http.Client{
+			Timeout: opts.Timeout,
+		},
+		MaxNetworkRetries: stripe.Int64(opts.MaxNetworkRetries),
+	})
+	return client.New(secretKey, backends)
 }
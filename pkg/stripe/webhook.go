@@ -19,38 +19,192 @@ type ConstructEventOptions struct {
 	MarkerValue   string
 }
 
-func ConstructEvent(ctx context.Context, client *client.API, r *http.Request, opts ConstructEventOptions) (*stripe.Event, error) {
+// Event is a webhook event about a checkout session created by us.
+type Event struct {
+	*stripe.Event
+	CheckoutSession *stripe.CheckoutSession
+}
+
+type LicenseAction string
+
+const (
+	LicenseActionNone      LicenseAction = ""
+	LicenseActionIssue     LicenseAction = "issue"
+	LicenseActionRenew     LicenseAction = "renew"
+	LicenseActionSuspend   LicenseAction = "suspend"
+	LicenseActionReinstate LicenseAction = "reinstate"
+	// LicenseActionNotifyPaymentFailed means no license is issued or renewed because the payment failed.
+	// The customer is told so.
+	LicenseActionNotifyPaymentFailed LicenseAction = "notify_payment_failed"
+)
+
+// ConstructEvent verifies the webhook request, and resolves the event with ResolveEvent.
+func ConstructEvent(ctx context.Context, client *client.API, r *http.Request, opts ConstructEventOptions) (*Event, error) {
+	e, err := VerifyEvent(r, opts.SigningSecret)
+	if err != nil {
+		return nil, err
+	}
+	return ResolveEvent(ctx, client, e, opts.MarkerValue)
+}
+
+// VerifyEvent verifies the signature of the webhook request, and returns the event in it.
+// It does not call Stripe.
+func VerifyEvent(r *http.Request, signingSecret string) (*stripe.Event, error) {
 	body, err := io.ReadAll(r.Body)
 	if err != nil {
 		return nil, err
 	}
 
 	sig := r.Header.Get("Stripe-Signature")
-	e, err := webhook.ConstructEvent(body, sig, opts.SigningSecret)
+	e, err := webhook.ConstructEvent(body, sig, signingSecret)
 	if err != nil {
 		return nil, err
 	}
+	return &e, nil
+}
+
+// ResolveEvent retrieves the checkout session of a verified event.
+// It returns ErrUnknownEvent if the event is not about a checkout session created by us.
+func ResolveEvent(ctx context.Context, client *client.API, e *stripe.Event, markerValue string) (*Event, error) {
+	event := &Event{Event: e}
+
+	var err error
+	var checkoutSession *stripe.CheckoutSession
+	switch e.Type {
+	case stripe.EventTypeCheckoutSessionCompleted,
+		stripe.EventTypeCheckoutSessionAsyncPaymentSucceeded,
+		stripe.EventTypeCheckoutSessionAsyncPaymentFailed:
+		checkoutSessionID := GetEventDataID(e)
+		checkoutSession, err = GetCheckoutSession(ctx, client, checkoutSessionID)
+		if err != nil {
+			return nil, err
+		}
+	case stripe.EventTypeChargeRefunded,
+		stripe.EventTypeChargeDisputeCreated,
+		stripe.EventTypeChargeDisputeClosed,
+		stripe.EventTypeRadarEarlyFraudWarningCreated:
+		// The data object of these events is a charge, a dispute, or an early fraud warning.
+		// All of them have payment_intent, which we use to find the checkout session.
+		paymentIntentID, ok := GetPaymentIntentID(e)
+		if !ok {
+			return event, ErrUnknownEvent
+		}
+		checkoutSession, err = getCheckoutSessionByPaymentIntentID(client, paymentIntentID)
+		if err != nil {
+			return nil, err
+		}
+		if checkoutSession == nil {
+			return event, ErrUnknownEvent
+		}
+	default:
+		return event, ErrUnknownEvent
+	}
 
-	if e.Type != stripe.EventTypeCheckoutSessionCompleted {
-		return &e, ErrUnknownEvent
+	marker := checkoutSession.Metadata[MetadataKeyMarker]
+	if marker == markerValue {
+		event.CheckoutSession = checkoutSession
+		return event, nil
 	}
 
-	checkoutSessionID := GetEventDataID(&e)
-	checkoutSession, err := client.CheckoutSessions.Get(checkoutSessionID, &stripe.CheckoutSessionParams{
-		Expand: []*string{
-			stripe.String("line_items"),
-		},
+	return event, ErrUnknownEvent
+}
+
+func getCheckoutSessionByPaymentIntentID(client *client.API, paymentIntentID string) (*stripe.CheckoutSession, error) {
+	iter := client.CheckoutSessions.List(&stripe.CheckoutSessionListParams{
+		PaymentIntent: stripe.String(paymentIntentID),
 	})
-	if err != nil {
+	for iter.Next() {
+		return iter.CheckoutSession(), nil
+	}
+	if err := iter.Err(); err != nil {
 		return nil, err
 	}
+	return nil, nil
+}
 
-	marker := checkoutSession.Metadata[MetadataKeyMarker]
-	if marker == opts.MarkerValue {
-		return &e, nil
+// NewCheckoutSessionCompletedEvent returns an Event as if checkout.session.completed was delivered for checkoutSession.
+// It is for handling a checkout session whose webhook event was missed.
+// checkoutSession must have its line items expanded.
+func NewCheckoutSessionCompletedEvent(checkoutSession *stripe.CheckoutSession) *Event {
+	object := map[string]any{
+		"id":     checkoutSession.ID,
+		"object": "checkout.session",
+	}
+	if checkoutSession.Customer != nil {
+		object["customer"] = checkoutSession.Customer.ID
+	}
+	if checkoutSession.CustomerDetails != nil {
+		object["customer_details"] = map[string]any{
+			"email": checkoutSession.CustomerDetails.Email,
+		}
+	}
+	if checkoutSession.PaymentIntent != nil {
+		object["payment_intent"] = checkoutSession.PaymentIntent.ID
+	}
+
+	return &Event{
+		Event: &stripe.Event{
+			ID:   "reconcile_" + checkoutSession.ID,
+			Type: stripe.EventTypeCheckoutSessionCompleted,
+			Data: &stripe.EventData{
+				Object: object,
+			},
+		},
+		CheckoutSession: checkoutSession,
+	}
+}
+
+// GetLicenseAction tells what to do with the license of the checkout session of the event.
+func GetLicenseAction(e *Event) LicenseAction {
+	switch e.Type {
+	case stripe.EventTypeCheckoutSessionCompleted:
+		// With a delayed payment method, the session is completed before the payment succeeds.
+		// The license is issued on checkout.session.async_payment_succeeded instead.
+		if !IsPaymentSettled(e) {
+			return LicenseActionNone
+		}
+		return issueOrRenew(e)
+	case stripe.EventTypeCheckoutSessionAsyncPaymentSucceeded:
+		return issueOrRenew(e)
+	case stripe.EventTypeCheckoutSessionAsyncPaymentFailed:
+		return LicenseActionNotifyPaymentFailed
+	case stripe.EventTypeChargeRefunded:
+		// A partial refund does not revoke the license.
+		if refunded, _ := e.Data.Object["refunded"].(bool); refunded {
+			return LicenseActionSuspend
+		}
+		return LicenseActionNone
+	case stripe.EventTypeChargeDisputeCreated, stripe.EventTypeRadarEarlyFraudWarningCreated:
+		return LicenseActionSuspend
+	case stripe.EventTypeChargeDisputeClosed:
+		if status, _ := e.Data.Object["status"].(string); status == string(stripe.DisputeStatusWon) {
+			return LicenseActionReinstate
+		}
+		return LicenseActionNone
+	default:
+		return LicenseActionNone
 	}
+}
 
-	return &e, ErrUnknownEvent
+func issueOrRenew(e *Event) LicenseAction {
+	if _, ok := GetRenewLicenseID(e); ok {
+		return LicenseActionRenew
+	}
+	return LicenseActionIssue
+}
+
+// IsPaymentSettled tells whether the checkout session of the event requires no further payment.
+// It is the case when the session is paid, or when nothing has to be paid, for example, with a 100% off promotion code.
+func IsPaymentSettled(e *Event) bool {
+	if e.CheckoutSession == nil {
+		return false
+	}
+	switch e.CheckoutSession.PaymentStatus {
+	case stripe.CheckoutSessionPaymentStatusPaid, stripe.CheckoutSessionPaymentStatusNoPaymentRequired:
+		return true
+	default:
+		return false
+	}
 }
 
 func IsWebhookClientError(err error) bool {
@@ -225,6 +379,55 @@ func GetCustomerEmail(e *stripe.Event) (string, bool) {
 	return email, true
 }
 
+func GetRenewLicenseID(e *Event) (string, bool) {
+	if e.CheckoutSession == nil {
+		return "", false
+	}
+	id := e.CheckoutSession.Metadata[MetadataKeyRenewLicenseID]
+	if id == "" {
+		return "", false
+	}
+	return id, true
+}
+
+// GetCustomerLocale returns the locale of the checkout session, and the country of the customer's address.
+// Either is empty when it is unknown.
+func GetCustomerLocale(e *Event) (locale string, country string) {
+	if e.CheckoutSession == nil {
+		return
+	}
+	// auto means Stripe detected the locale of the browser, but the detected locale is not returned.
+	if e.CheckoutSession.Locale != "auto" {
+		locale = e.CheckoutSession.Locale
+	}
+	if details := e.CheckoutSession.CustomerDetails; details != nil && details.Address != nil {
+		country = details.Address.Country
+	}
+	return
+}
+
+// GetPriceID returns the price of the purchased line item.
+// The checkout session is created with exactly 1 line item.
+func GetPriceID(e *Event) (string, bool) {
+	if e.CheckoutSession == nil || e.CheckoutSession.LineItems == nil {
+		return "", false
+	}
+	for _, item := range e.CheckoutSession.LineItems.Data {
+		if item.Price != nil && item.Price.ID != "" {
+			return item.Price.ID, true
+		}
+	}
+	return "", false
+}
+
+func GetPaymentIntentID(e *stripe.Event) (string, bool) {
+	id, ok := e.Data.Object["payment_intent"].(string)
+	if !ok || id == "" {
+		return "", false
+	}
+	return id, true
+}
+
 func GetEventDataID(e *stripe.Event) string {
 	id := e.Data.Object["id"].(string)
 	if id == "" {
@@ -0,0 +1,271 @@
+package stripe
+
+import (
+	"testing"
+
+	"github.com/stripe/stripe-go/v82"
+)
+
+func TestGetLicenseAction(t *testing.T) {
+	tests := []struct {
+		name            string
+		eventType       stripe.EventType
+		object          map[string]any
+		checkoutSession *stripe.CheckoutSession
+		expected        LicenseAction
+	}{
+		{
+			name:      "checkout session completed",
+			eventType: stripe.EventTypeCheckoutSessionCompleted,
+			object:    map[string]any{"object": "checkout.session"},
+			checkoutSession: &stripe.CheckoutSession{
+				Metadata:      map[string]string{MetadataKeyMarker: "marker"},
+				PaymentStatus: stripe.CheckoutSessionPaymentStatusPaid,
+			},
+			expected: LicenseActionIssue,
+		},
+		{
+			name:      "checkout session completed without payment required",
+			eventType: stripe.EventTypeCheckoutSessionCompleted,
+			object:    map[string]any{"object": "checkout.session"},
+			checkoutSession: &stripe.CheckoutSession{
+				Metadata:      map[string]string{MetadataKeyMarker: "marker"},
+				PaymentStatus: stripe.CheckoutSessionPaymentStatusNoPaymentRequired,
+			},
+			expected: LicenseActionIssue,
+		},
+		{
+			name:      "checkout session completed with payment pending",
+			eventType: stripe.EventTypeCheckoutSessionCompleted,
+			object:    map[string]any{"object": "checkout.session"},
+			checkoutSession: &stripe.CheckoutSession{
+				Metadata:      map[string]string{MetadataKeyMarker: "marker"},
+				PaymentStatus: stripe.CheckoutSessionPaymentStatusUnpaid,
+			},
+			expected: LicenseActionNone,
+		},
+		{
+			name:      "renewal checkout session completed",
+			eventType: stripe.EventTypeCheckoutSessionCompleted,
+			object:    map[string]any{"object": "checkout.session"},
+			checkoutSession: &stripe.CheckoutSession{
+				Metadata: map[string]string{
+					MetadataKeyMarker:         "marker",
+					MetadataKeyRenewLicenseID: "9d1e8df9-229f-4b5d-a207-945dcfa1e996",
+				},
+				PaymentStatus: stripe.CheckoutSessionPaymentStatusPaid,
+			},
+			expected: LicenseActionRenew,
+		},
+		{
+			name:      "async payment succeeded",
+			eventType: stripe.EventTypeCheckoutSessionAsyncPaymentSucceeded,
+			object:    map[string]any{"object": "checkout.session"},
+			checkoutSession: &stripe.CheckoutSession{
+				Metadata:      map[string]string{MetadataKeyMarker: "marker"},
+				PaymentStatus: stripe.CheckoutSessionPaymentStatusPaid,
+			},
+			expected: LicenseActionIssue,
+		},
+		{
+			name:      "renewal async payment succeeded",
+			eventType: stripe.EventTypeCheckoutSessionAsyncPaymentSucceeded,
+			object:    map[string]any{"object": "checkout.session"},
+			checkoutSession: &stripe.CheckoutSession{
+				Metadata: map[string]string{
+					MetadataKeyMarker:         "marker",
+					MetadataKeyRenewLicenseID: "9d1e8df9-229f-4b5d-a207-945dcfa1e996",
+				},
+				PaymentStatus: stripe.CheckoutSessionPaymentStatusPaid,
+			},
+			expected: LicenseActionRenew,
+		},
+		{
+			name:      "async payment failed",
+			eventType: stripe.EventTypeCheckoutSessionAsyncPaymentFailed,
+			object:    map[string]any{"object": "checkout.session"},
+			checkoutSession: &stripe.CheckoutSession{
+				Metadata:      map[string]string{MetadataKeyMarker: "marker"},
+				PaymentStatus: stripe.CheckoutSessionPaymentStatusUnpaid,
+			},
+			expected: LicenseActionNotifyPaymentFailed,
+		},
+		{
+			name:      "charge fully refunded",
+			eventType: stripe.EventTypeChargeRefunded,
+			object:    map[string]any{"object": "charge", "refunded": true},
+			expected:  LicenseActionSuspend,
+		},
+		{
+			name:      "charge partially refunded",
+			eventType: stripe.EventTypeChargeRefunded,
+			object:    map[string]any{"object": "charge", "refunded": false},
+			expected:  LicenseActionNone,
+		},
+		{
+			name:      "dispute created",
+			eventType: stripe.EventTypeChargeDisputeCreated,
+			object:    map[string]any{"object": "dispute", "status": "needs_response"},
+			expected:  LicenseActionSuspend,
+		},
+		{
+			name:      "dispute won",
+			eventType: stripe.EventTypeChargeDisputeClosed,
+			object:    map[string]any{"object": "dispute", "status": "won"},
+			expected:  LicenseActionReinstate,
+		},
+		{
+			name:      "dispute lost",
+			eventType: stripe.EventTypeChargeDisputeClosed,
+			object:    map[string]any{"object": "dispute", "status": "lost"},
+			expected:  LicenseActionNone,
+		},
+		{
+			name:      "early fraud warning",
+			eventType: stripe.EventTypeRadarEarlyFraudWarningCreated,
+			object:    map[string]any{"object": "radar.early_fraud_warning"},
+			expected:  LicenseActionSuspend,
+		},
+		{
+			name:      "other event",
+			eventType: stripe.EventTypeCustomerCreated,
+			object:    map[string]any{"object": "customer"},
+			expected:  LicenseActionNone,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := &Event{
+				Event: &stripe.Event{
+					Type: tt.eventType,
+					Data: &stripe.EventData{
+						Object: tt.object,
+					},
+				},
+				CheckoutSession: tt.checkoutSession,
+			}
+			if got := GetLicenseAction(e); got != tt.expected {
+				t.Errorf("GetLicenseAction() = %q, want %q", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestGetPriceID(t *testing.T) {
+	tests := []struct {
+		name            string
+		checkoutSession *stripe.CheckoutSession
+		expected        string
+		expectedOK      bool
+	}{
+		{
+			name:            "no checkout session",
+			checkoutSession: nil,
+		},
+		{
+			name:            "line items not expanded",
+			checkoutSession: &stripe.CheckoutSession{},
+		},
+		{
+			name: "line item",
+			checkoutSession: &stripe.CheckoutSession{
+				LineItems: &stripe.LineItemList{
+					Data: []*stripe.LineItem{
+						{Price: &stripe.Price{ID: "price_3y"}},
+					},
+				},
+			},
+			expected:   "price_3y",
+			expectedOK: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := GetPriceID(&Event{CheckoutSession: tt.checkoutSession})
+			if got != tt.expected || ok != tt.expectedOK {
+				t.Errorf("GetPriceID() = (%q, %v), want (%q, %v)", got, ok, tt.expected, tt.expectedOK)
+			}
+		})
+	}
+}
+
+func TestGetCustomerLocale(t *testing.T) {
+	tests := []struct {
+		name            string
+		checkoutSession *stripe.CheckoutSession
+		expectedLocale  string
+		expectedCountry string
+	}{
+		{
+			name:            "no checkout session",
+			checkoutSession: nil,
+		},
+		{
+			name: "locale and country",
+			checkoutSession: &stripe.CheckoutSession{
+				Locale: "zh-HK",
+				CustomerDetails: &stripe.CheckoutSessionCustomerDetails{
+					Address: &stripe.Address{Country: "HK"},
+				},
+			},
+			expectedLocale:  "zh-HK",
+			expectedCountry: "HK",
+		},
+		{
+			name: "auto locale",
+			checkoutSession: &stripe.CheckoutSession{
+				Locale: "auto",
+				CustomerDetails: &stripe.CheckoutSessionCustomerDetails{
+					Address: &stripe.Address{Country: "JP"},
+				},
+			},
+			expectedCountry: "JP",
+		},
+		{
+			name: "no address",
+			checkoutSession: &stripe.CheckoutSession{
+				Locale:          "ja",
+				CustomerDetails: &stripe.CheckoutSessionCustomerDetails{},
+			},
+			expectedLocale: "ja",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			locale, country := GetCustomerLocale(&Event{CheckoutSession: tt.checkoutSession})
+			if locale != tt.expectedLocale || country != tt.expectedCountry {
+				t.Errorf("GetCustomerLocale() = (%q, %q), want (%q, %q)", locale, country, tt.expectedLocale, tt.expectedCountry)
+			}
+		})
+	}
+}
+
+func TestNewCheckoutSessionCompletedEvent(t *testing.T) {
+	e := NewCheckoutSessionCompletedEvent(&stripe.CheckoutSession{
+		ID:              "cs_1",
+		Customer:        &stripe.Customer{ID: "cus_1"},
+		CustomerDetails: &stripe.CheckoutSessionCustomerDetails{Email: "user@example.com"},
+		PaymentIntent:   &stripe.PaymentIntent{ID: "pi_1"},
+		PaymentStatus:   stripe.CheckoutSessionPaymentStatusPaid,
+		Metadata:        map[string]string{MetadataKeyMarker: "marker"},
+	})
+
+	if got := GetLicenseAction(e); got != LicenseActionIssue {
+		t.Errorf("GetLicenseAction() = %q, want %q", got, LicenseActionIssue)
+	}
+	if got, _ := GetCustomerID(e.Event); got != "cus_1" {
+		t.Errorf("GetCustomerID() = %q, want %q", got, "cus_1")
+	}
+	if got, _ := GetCustomerEmail(e.Event); got != "user@example.com" {
+		t.Errorf("GetCustomerEmail() = %q, want %q", got, "user@example.com")
+	}
+	if got, _ := GetPaymentIntentID(e.Event); got != "pi_1" {
+		t.Errorf("GetPaymentIntentID() = %q, want %q", got, "pi_1")
+	}
+	if got := GetEventDataID(e.Event); got != "cs_1" {
+		t.Errorf("GetEventDataID() = %q, want %q", got, "cs_1")
+	}
+}
@@ -0,0 +1,177 @@
+// Package webhookevent records the Stripe webhook events handled by the server,
+// so that duplicate deliveries are not processed twice, and the outcome of each event can be inspected.
+package webhookevent
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"time"
+
+	"github.com/authgear/authgear-once-license-server/pkg/filestore"
+)
+
+type Outcome string
+
+const (
+	// OutcomeSucceeded means the event was processed successfully.
+	OutcomeSucceeded Outcome = "succeeded"
+	// OutcomeIgnored means the event required no action.
+	OutcomeIgnored Outcome = "ignored"
+	// OutcomeFailed means the event failed to be processed. Stripe delivers it again later.
+	OutcomeFailed Outcome = "failed"
+	// OutcomeProcessing means a delivery of the event is being processed.
+	OutcomeProcessing Outcome = "processing"
+)
+
+// ProcessingTimeout is how long an event can be OutcomeProcessing.
+// After that, the processing is considered abandoned, for example, the process crashed,
+// and the event can be processed again.
+const ProcessingTimeout = 10 * time.Minute
+
+var (
+	// ErrEventProcessed means the event has a final outcome.
+	ErrEventProcessed = errors.New("webhookevent: event has been processed")
+	// ErrEventProcessing means another delivery of the event is being processed.
+	ErrEventProcessing = errors.New("webhookevent: event is being processed")
+)
+
+// IsFinal tells whether an event with the outcome must not be processed again.
+func (o Outcome) IsFinal() bool {
+	return o == OutcomeSucceeded || o == OutcomeIgnored
+}
+
+// Event is the record of a Stripe webhook event.
+type Event struct {
+	ID                string `json:"id"`
+	Type              string `json:"type"`
+	CheckoutSessionID string `json:"checkout_session_id,omitempty"`
+	// LicenseID is the Keygen license the event acted on, if known.
+	LicenseID string  `json:"license_id,omitempty"`
+	Outcome   Outcome `json:"outcome"`
+	// Error is the error of the last failed attempt.
+	Error string `json:"error,omitempty"`
+	// Attempts is the number of deliveries processed.
+	Attempts int `json:"attempts"`
+	// ReceivedAt is the time of the first delivery.
+	ReceivedAt time.Time `json:"received_at"`
+	// ProcessedAt is the time of the last delivery.
+	ProcessedAt time.Time `json:"processed_at"`
+	// ProcessingStartedAt is the time the current delivery started to be processed, when Outcome is OutcomeProcessing.
+	ProcessingStartedAt *time.Time `json:"processing_started_at,omitempty"`
+}
+
+type ListOptions struct {
+	// CheckoutSessionID limits the events to the checkout session, if it is non-empty.
+	CheckoutSessionID string
+	// Outcome limits the events to the outcome, if it is non-empty.
+	Outcome Outcome
+	// Limit is the maximum number of events to return. 0 means unlimited.
+	Limit int
+}
+
+type Store interface {
+	// Get returns nil if the event is not recorded.
+	Get(ctx context.Context, id string) (*Event, error)
+	// Start records that event is being processed, so that concurrent deliveries of the same event are not processed.
+	// It returns ErrEventProcessed if the event has a final outcome,
+	// and ErrEventProcessing if the event started to be processed within ProcessingTimeout.
+	// Otherwise, it returns the record, which is event if it is not recorded yet.
+	// The caller must Put the record with the outcome when it is done.
+	Start(ctx context.Context, event Event) (*Event, error)
+	Put(ctx context.Context, event Event) error
+	// List returns the events, the most recently received first.
+	List(ctx context.Context, opts ListOptions) ([]Event, error)
+}
+
+// FileStore is a Store backed by a JSON file.
+type FileStore struct {
+	Now func() time.Time
+
+	events *filestore.Map[string, Event]
+}
+
+var _ Store = (*FileStore)(nil)
+
+func NewFileStore(path string) *FileStore {
+	return &FileStore{
+		Now:    time.Now,
+		events: filestore.NewMap[string, Event](path),
+	}
+}
+
+func (s *FileStore) Get(ctx context.Context, id string) (*Event, error) {
+	event, ok, err := s.events.Get(id)
+	if err != nil || !ok {
+		return nil, err
+	}
+	return &event, nil
+}
+
+func (s *FileStore) Start(ctx context.Context, event Event) (record *Event, err error) {
+	err = s.events.Update(func(events map[string]Event) (bool, error) {
+		now := s.Now().UTC()
+		r, ok := events[event.ID]
+		switch {
+		case !ok:
+			r = event
+		case r.Outcome.IsFinal():
+			return false, ErrEventProcessed
+		case r.Outcome == OutcomeProcessing && r.ProcessingStartedAt != nil && now.Sub(*r.ProcessingStartedAt) < ProcessingTimeout:
+			return false, ErrEventProcessing
+		}
+
+		r.Outcome = OutcomeProcessing
+		r.ProcessingStartedAt = &now
+		events[r.ID] = r
+		record = &r
+		return true, nil
+	})
+	if err != nil {
+		record = nil
+	}
+	return
+}
+
+func (s *FileStore) Put(ctx context.Context, event Event) error {
+	return s.events.Update(func(events map[string]Event) (bool, error) {
+		events[event.ID] = event
+		return true, nil
+	})
+}
+
+func (s *FileStore) List(ctx context.Context, opts ListOptions) ([]Event, error) {
+	all, err := s.events.Values()
+	if err != nil {
+		return nil, err
+	}
+
+	var events []Event
+	for _, event := range all {
+		if opts.CheckoutSessionID != "" && event.CheckoutSessionID != opts.CheckoutSessionID {
+			continue
+		}
+		if opts.Outcome != "" && event.Outcome != opts.Outcome {
+			continue
+		}
+		events = append(events, event)
+	}
+
+	slices.SortFunc(events, func(a, b Event) int {
+		if c := b.ReceivedAt.Compare(a.ReceivedAt); c != 0 {
+			return c
+		}
+		if a.ID < b.ID {
+			return -1
+		}
+		if a.ID > b.ID {
+			return 1
+		}
+		return 0
+	})
+
+	if opts.Limit > 0 && len(events) > opts.Limit {
+		events = events[:opts.Limit]
+	}
+	return events, nil
+}
@@ -0,0 +1,197 @@
+package webhookevent
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestOutcomeIsFinal(t *testing.T) {
+	tests := []struct {
+		outcome  Outcome
+		expected bool
+	}{
+		{OutcomeSucceeded, true},
+		{OutcomeIgnored, true},
+		{OutcomeFailed, false},
+		{OutcomeProcessing, false},
+	}
+	for _, tt := range tests {
+		if got := tt.outcome.IsFinal(); got != tt.expected {
+			t.Errorf("%v: expected %v, got %v", tt.outcome, tt.expected, got)
+		}
+	}
+}
+
+func TestFileStore(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "events.json")
+	t0 := time.Date(2025, 5, 1, 0, 0, 0, 0, time.UTC)
+
+	events := []Event{
+		{
+			ID:                "evt_1",
+			Type:              "checkout.session.completed",
+			CheckoutSessionID: "cs_1",
+			Outcome:           OutcomeSucceeded,
+			Attempts:          1,
+			ReceivedAt:        t0,
+			ProcessedAt:       t0,
+		},
+		{
+			ID:                "evt_2",
+			Type:              "charge.refunded",
+			CheckoutSessionID: "cs_1",
+			LicenseID:         "license-1",
+			Outcome:           OutcomeFailed,
+			Error:             "failed to suspend license",
+			Attempts:          2,
+			ReceivedAt:        t0.Add(time.Hour),
+			ProcessedAt:       t0.Add(2 * time.Hour),
+		},
+		{
+			ID:                "evt_3",
+			Type:              "checkout.session.completed",
+			CheckoutSessionID: "cs_2",
+			Outcome:           OutcomeIgnored,
+			Attempts:          1,
+			ReceivedAt:        t0.Add(2 * time.Hour),
+			ProcessedAt:       t0.Add(2 * time.Hour),
+		},
+	}
+
+	s := NewFileStore(path)
+	got, err := s.Get(ctx, "evt_1")
+	if err != nil || got != nil {
+		t.Fatalf("expected no event, got %v, %v", got, err)
+	}
+
+	for _, e := range events {
+		err = s.Put(ctx, e)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	}
+
+	// Another store reads the events from the file.
+	s = NewFileStore(path)
+	got, err = s.Get(ctx, "evt_2")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if !reflect.DeepEqual(*got, events[1]) {
+		t.Errorf("expected %v, got %v", events[1], *got)
+	}
+
+	listTests := []struct {
+		name        string
+		opts        ListOptions
+		expectedIDs []string
+	}{
+		{"all", ListOptions{}, []string{"evt_3", "evt_2", "evt_1"}},
+		{"checkout session", ListOptions{CheckoutSessionID: "cs_1"}, []string{"evt_2", "evt_1"}},
+		{"outcome", ListOptions{Outcome: OutcomeFailed}, []string{"evt_2"}},
+		{"limit", ListOptions{Limit: 1}, []string{"evt_3"}},
+	}
+	for _, tt := range listTests {
+		t.Run(tt.name, func(t *testing.T) {
+			list, err := s.List(ctx, tt.opts)
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			var ids []string
+			for _, e := range list {
+				ids = append(ids, e.ID)
+			}
+			if !reflect.DeepEqual(ids, tt.expectedIDs) {
+				t.Errorf("expected %v, got %v", tt.expectedIDs, ids)
+			}
+		})
+	}
+}
+
+func TestFileStoreStart(t *testing.T) {
+	ctx := context.Background()
+	t0 := time.Date(2025, 5, 1, 0, 0, 0, 0, time.UTC)
+	now := t0
+
+	s := NewFileStore(filepath.Join(t.TempDir(), "events.json"))
+	s.Now = func() time.Time { return now }
+
+	steps := []struct {
+		name             string
+		now              time.Time
+		before           func()
+		expectedErr      error
+		expectedStarted  time.Time
+		expectedAttempts int
+	}{
+		{
+			name:            "new event",
+			now:             t0,
+			expectedStarted: t0,
+		},
+		{
+			name:            "event being processed",
+			now:             t0.Add(time.Minute),
+			expectedErr:     ErrEventProcessing,
+			expectedStarted: t0,
+		},
+		{
+			name:            "processing is abandoned",
+			now:             t0.Add(ProcessingTimeout),
+			expectedStarted: t0.Add(ProcessingTimeout),
+		},
+		{
+			name: "event failed",
+			now:  t0.Add(ProcessingTimeout + time.Minute),
+			before: func() {
+				_ = s.Put(ctx, Event{ID: "evt_1", Outcome: OutcomeFailed, Attempts: 1})
+			},
+			expectedStarted:  t0.Add(ProcessingTimeout + time.Minute),
+			expectedAttempts: 1,
+		},
+		{
+			name: "event processed",
+			now:  t0.Add(ProcessingTimeout + 2*time.Minute),
+			before: func() {
+				_ = s.Put(ctx, Event{ID: "evt_1", Outcome: OutcomeSucceeded, Attempts: 2})
+			},
+			expectedErr:      ErrEventProcessed,
+			expectedAttempts: 2,
+		},
+	}
+
+	for _, step := range steps {
+		now = step.now
+		if step.before != nil {
+			step.before()
+		}
+
+		got, err := s.Start(ctx, Event{ID: "evt_1", Type: "charge.refunded"})
+		if !errors.Is(err, step.expectedErr) {
+			t.Errorf("%v: expected error %v, got %v", step.name, step.expectedErr, err)
+		}
+		if err == nil && (got == nil || got.Outcome != OutcomeProcessing) {
+			t.Errorf("%v: expected a processing record, got %v", step.name, got)
+		}
+
+		record, err := s.Get(ctx, "evt_1")
+		if err != nil || record == nil {
+			t.Fatalf("%v: expected event to be recorded, got %v, %v", step.name, record, err)
+		}
+		if record.Attempts != step.expectedAttempts {
+			t.Errorf("%v: expected attempts %v, got %v", step.name, step.expectedAttempts, record.Attempts)
+		}
+		var started time.Time
+		if record.ProcessingStartedAt != nil {
+			started = *record.ProcessingStartedAt
+		}
+		if !started.Equal(step.expectedStarted) {
+			t.Errorf("%v: expected processing started at %v, got %v", step.name, step.expectedStarted, started)
+		}
+	}
+}